@@ -0,0 +1,106 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bandwidth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/goblob/logging"
+)
+
+// Controller sets a limiter's rate from, in order of precedence, a control
+// file, a schedule and a default rate
+type Controller struct {
+	limiter     *Limiter
+	defaultRate int64
+	schedule    Schedule
+	controlFile string
+	now         func() time.Time
+}
+
+// NewController creates a controller for limiter. controlFile may be empty,
+// in which case only the schedule and default rate are used.
+func NewController(limiter *Limiter, defaultRate int64, schedule Schedule, controlFile string) *Controller {
+	return &Controller{
+		limiter:     limiter,
+		defaultRate: defaultRate,
+		schedule:    schedule,
+		controlFile: controlFile,
+		now:         time.Now,
+	}
+}
+
+// Update sets the limiter to the rate that currently applies. The control
+// file overrides the schedule while it exists and is not empty; an invalid
+// control file leaves the rate unchanged.
+func (c *Controller) Update() error {
+	rate, err := c.currentRate()
+	if err != nil {
+		return err
+	}
+	c.limiter.SetRate(rate)
+	return nil
+}
+
+func (c *Controller) currentRate() (int64, error) {
+	if c.controlFile != "" {
+		contents, err := ioutil.ReadFile(c.controlFile)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("error reading bandwidth control file: %s", err)
+		}
+		if value := strings.TrimSpace(string(contents)); value != "" {
+			rate, err := ParseRate(value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid bandwidth control file %s: %s", c.controlFile, err)
+			}
+			return rate, nil
+		}
+	}
+
+	if rate, ok := c.schedule.RateAt(c.now()); ok {
+		return rate, nil
+	}
+	return c.defaultRate, nil
+}
+
+// Run updates the rate every interval, so that schedule windows and control
+// file changes take effect, and straight away whenever a signal arrives on
+// signals. It returns when done is closed.
+func (c *Controller) Run(interval time.Duration, signals <-chan os.Signal, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		case <-signals:
+		}
+
+		previous := c.limiter.Rate()
+		if err := c.Update(); err != nil {
+			logging.Error("error updating bandwidth limit", "error", err)
+			continue
+		}
+		if rate := c.limiter.Rate(); rate != previous {
+			logging.Info("bandwidth limit changed", "from", FormatRate(previous), "to", FormatRate(rate))
+		}
+	}
+}
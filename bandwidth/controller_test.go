@@ -0,0 +1,89 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bandwidth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		dir         string
+		controlFile string
+		limiter     *bandwidth.Limiter
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "bandwidth")
+		Expect(err).NotTo(HaveOccurred())
+		controlFile = filepath.Join(dir, "bandwidth")
+		limiter = bandwidth.NewLimiter(0)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("uses the default rate outside the schedule", func() {
+		controller := bandwidth.NewController(limiter, 1000, nil, controlFile)
+		Expect(controller.Update()).To(Succeed())
+		Expect(limiter.Rate()).To(BeEquivalentTo(1000))
+	})
+
+	It("uses the control file while it is not empty", func() {
+		controller := bandwidth.NewController(limiter, 1000, nil, controlFile)
+
+		Expect(ioutil.WriteFile(controlFile, []byte("2KB/s\n"), 0644)).To(Succeed())
+		Expect(controller.Update()).To(Succeed())
+		Expect(limiter.Rate()).To(BeEquivalentTo(2000))
+
+		Expect(ioutil.WriteFile(controlFile, nil, 0644)).To(Succeed())
+		Expect(controller.Update()).To(Succeed())
+		Expect(limiter.Rate()).To(BeEquivalentTo(1000))
+	})
+
+	It("keeps the rate when the control file is invalid", func() {
+		controller := bandwidth.NewController(limiter, 1000, nil, controlFile)
+		Expect(controller.Update()).To(Succeed())
+
+		Expect(ioutil.WriteFile(controlFile, []byte("fast"), 0644)).To(Succeed())
+		Expect(controller.Update()).To(MatchError(ContainSubstring("invalid bandwidth control file")))
+		Expect(limiter.Rate()).To(BeEquivalentTo(1000))
+	})
+
+	It("updates the rate when signalled", func() {
+		controller := bandwidth.NewController(limiter, 1000, nil, controlFile)
+		Expect(controller.Update()).To(Succeed())
+
+		signals := make(chan os.Signal)
+		done := make(chan struct{})
+		defer close(done)
+		go controller.Run(time.Hour, signals, done)
+
+		Expect(ioutil.WriteFile(controlFile, []byte("unlimited"), 0644)).To(Succeed())
+		signals <- syscall.SIGHUP
+		Eventually(limiter.Rate).Should(BeZero())
+	})
+})
@@ -0,0 +1,158 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bandwidth limits how fast goblob reads and writes blobs.
+package bandwidth
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket shared by every reader it throttles. It holds
+// at most one second of tokens, so idle periods allow only a short burst.
+// A rate of zero means unlimited.
+type Limiter struct {
+	mutex   sync.Mutex
+	rate    int64
+	tokens  float64
+	last    time.Time
+	changed chan struct{}
+}
+
+// NewLimiter creates a limiter allowing rate bytes per second
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}
+}
+
+// Rate returns the bytes per second currently allowed, or zero when
+// unlimited
+func (l *Limiter) Rate() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rate
+}
+
+// SetRate changes the bytes per second allowed. Readers waiting under the
+// old rate are released and continue at the new one.
+func (l *Limiter) SetRate(rate int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if rate == l.rate {
+		return
+	}
+	l.rate = rate
+	l.tokens = 0
+	l.last = time.Now()
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Wait blocks until n bytes may be transferred
+func (l *Limiter) Wait(n int) {
+	l.mutex.Lock()
+	if l.rate <= 0 {
+		l.mutex.Unlock()
+		return
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+	l.last = now
+
+	// Tokens may go negative; the debt is what the caller sleeps off, and
+	// later callers queue behind it.
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		l.mutex.Unlock()
+		return
+	}
+	delay := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	changed := l.changed
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-changed:
+	}
+}
+
+// chunkSize is the most a single Read asks for, so that a slow rate
+// never puts a reader more than a second into debt
+func (l *Limiter) chunkSize(n int) int {
+	rate := l.Rate()
+	if rate > 0 && int64(n) > rate {
+		return int(rate)
+	}
+	return n
+}
+
+type reader struct {
+	io.Reader
+	limiter *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p[:r.limiter.chunkSize(len(p))])
+	if n > 0 {
+		r.limiter.Wait(n)
+	}
+	return n, err
+}
+
+type readCloser struct {
+	reader
+	io.Closer
+}
+
+type readSeekCloser struct {
+	readCloser
+	io.Seeker
+}
+
+// NewReader throttles reads from r. The result can still be closed and
+// seeked when r can, since uploaders seek to find the length of a body and
+// to rewind it for retries.
+func NewReader(r io.Reader, limiter *Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+
+	throttled := reader{Reader: r, limiter: limiter}
+	closer, ok := r.(io.Closer)
+	if !ok {
+		return &throttled
+	}
+
+	rc := readCloser{reader: throttled, Closer: closer}
+	if seeker, ok := r.(io.Seeker); ok {
+		return &readSeekCloser{readCloser: rc, Seeker: seeker}
+	}
+	return &rc
+}
+
+// NewReadCloser throttles reads from rc
+func NewReadCloser(rc io.ReadCloser, limiter *Limiter) io.ReadCloser {
+	return NewReader(rc, limiter).(io.ReadCloser)
+}
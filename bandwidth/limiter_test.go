@@ -0,0 +1,94 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bandwidth_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	It("reads at about the rate allowed", func() {
+		limiter := bandwidth.NewLimiter(100000)
+		reader := bandwidth.NewReader(bytes.NewReader(make([]byte, 50000)), limiter)
+
+		start := time.Now()
+		n, err := io.Copy(ioutil.Discard, reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeEquivalentTo(50000))
+		Expect(time.Since(start)).To(BeNumerically("~", 500*time.Millisecond, 200*time.Millisecond))
+	})
+
+	It("shares the rate between readers", func() {
+		limiter := bandwidth.NewLimiter(100000)
+
+		start := time.Now()
+		done := make(chan struct{})
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				_, err := io.Copy(ioutil.Discard, bandwidth.NewReader(bytes.NewReader(make([]byte, 25000)), limiter))
+				Expect(err).NotTo(HaveOccurred())
+				done <- struct{}{}
+			}()
+		}
+		Eventually(done, 2).Should(Receive())
+		Eventually(done, 2).Should(Receive())
+		Expect(time.Since(start)).To(BeNumerically("~", 500*time.Millisecond, 200*time.Millisecond))
+	})
+
+	It("does not wait when unlimited", func() {
+		limiter := bandwidth.NewLimiter(0)
+
+		start := time.Now()
+		_, err := io.Copy(ioutil.Discard, bandwidth.NewReader(bytes.NewReader(make([]byte, 1<<20)), limiter))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+	})
+
+	It("releases waiting readers when the rate changes", func() {
+		limiter := bandwidth.NewLimiter(1000)
+
+		done := make(chan struct{})
+		go func() {
+			io.Copy(ioutil.Discard, bandwidth.NewReader(bytes.NewReader(make([]byte, 10000)), limiter))
+			close(done)
+		}()
+
+		Consistently(done, 200*time.Millisecond).ShouldNot(BeClosed())
+		limiter.SetRate(0)
+		Eventually(done).Should(BeClosed())
+		Expect(limiter.Rate()).To(BeZero())
+	})
+
+	It("keeps files seekable and closable", func() {
+		file, err := ioutil.TempFile("", "bandwidth")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(file.Name())
+
+		reader := bandwidth.NewReader(file, bandwidth.NewLimiter(1000))
+		_, ok := reader.(io.ReadSeeker)
+		Expect(ok).To(BeTrue())
+		Expect(reader.(io.Closer).Close()).To(Succeed())
+	})
+})
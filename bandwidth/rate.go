@@ -0,0 +1,96 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bandwidth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var units = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"kb", 1e3},
+	{"mb", 1e6},
+	{"gb", 1e9},
+	{"k", 1e3},
+	{"m", 1e6},
+	{"g", 1e9},
+	{"b", 1},
+}
+
+// ParseRate parses a rate such as 200MB/s, 50MiB or 1048576 into bytes per
+// second. "unlimited" and 0 both mean no limit.
+func ParseRate(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	if s == "unlimited" {
+		return 0, nil
+	}
+
+	rate, err := ParseBytes(strings.TrimSuffix(s, "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 200MB/s, 50MiB/s or unlimited", value)
+	}
+	return rate, nil
+}
+
+// ParseBytes parses a size such as 10MB, 1.5GiB or 1048576 into bytes
+func ParseBytes(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			multiplier = unit.bytes
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(s, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 10MB, 1.5GiB or 1048576", value)
+	}
+	return int64(number * multiplier), nil
+}
+
+// FormatRate formats bytes per second for display
+func FormatRate(rate int64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	return FormatBytes(rate) + "/s"
+}
+
+// FormatBytes formats a number of bytes for display
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1e12:
+		return fmt.Sprintf("%.4gTB", float64(n)/1e12)
+	case n >= 1e9:
+		return fmt.Sprintf("%.4gGB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.4gMB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.4gKB", float64(n)/1e3)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bandwidth_test
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseRate", func() {
+	It("parses rates", func() {
+		for value, expected := range map[string]int64{
+			"1048576":   1048576,
+			"200MB/s":   200000000,
+			"50MiB":     50 * 1024 * 1024,
+			"1.5 GB/s":  1500000000,
+			"unlimited": 0,
+		} {
+			rate, err := bandwidth.ParseRate(value)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rate).To(Equal(expected), value)
+		}
+	})
+
+	It("rejects invalid rates", func() {
+		_, err := bandwidth.ParseRate("fast")
+		Expect(err).To(MatchError(`invalid rate "fast", expected e.g. 200MB/s, 50MiB/s or unlimited`))
+
+		_, err = bandwidth.ParseRate("-1MB/s")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("parses sizes", func() {
+		size, err := bandwidth.ParseBytes("1.5GiB")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size).To(BeEquivalentTo(1.5 * 1024 * 1024 * 1024))
+
+		_, err = bandwidth.ParseBytes("10MB/s")
+		Expect(err).To(MatchError(`invalid size "10MB/s", expected e.g. 10MB, 1.5GiB or 1048576`))
+	})
+
+	It("formats rates", func() {
+		Expect(bandwidth.FormatRate(0)).To(Equal("unlimited"))
+		Expect(bandwidth.FormatRate(200000000)).To(Equal("200MB/s"))
+		Expect(bandwidth.FormatRate(512)).To(Equal("512B/s"))
+	})
+
+	It("formats sizes", func() {
+		Expect(bandwidth.FormatBytes(0)).To(Equal("0B"))
+		Expect(bandwidth.FormatBytes(1500)).To(Equal("1.5KB"))
+		Expect(bandwidth.FormatBytes(2147483648)).To(Equal("2.147GB"))
+	})
+})
+
+var _ = Describe("Schedule", func() {
+	at := func(clock string) time.Time {
+		t, err := time.Parse("15:04", clock)
+		Expect(err).NotTo(HaveOccurred())
+		return t
+	}
+
+	It("uses the first window containing the time", func() {
+		schedule, err := bandwidth.ParseSchedule([]string{"08:00-18:00=50MB/s", "20:00-06:00=unlimited"})
+		Expect(err).NotTo(HaveOccurred())
+
+		rate, ok := schedule.RateAt(at("12:30"))
+		Expect(ok).To(BeTrue())
+		Expect(rate).To(BeEquivalentTo(50000000))
+
+		rate, ok = schedule.RateAt(at("02:00"))
+		Expect(ok).To(BeTrue())
+		Expect(rate).To(BeZero())
+
+		_, ok = schedule.RateAt(at("18:00"))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("rejects invalid windows", func() {
+		_, err := bandwidth.ParseSchedule([]string{"08:00=50MB/s"})
+		Expect(err).To(MatchError(`invalid schedule window "08:00=50MB/s", expected e.g. 08:00-18:00=50MB/s`))
+
+		_, err = bandwidth.ParseSchedule([]string{"8am-6pm=50MB/s"})
+		Expect(err).To(MatchError(`invalid time of day "8am", expected HH:MM`))
+
+		_, err = bandwidth.ParseSchedule([]string{"08:00-08:00=50MB/s"})
+		Expect(err).To(MatchError(`schedule window "08:00-08:00=50MB/s" is empty`))
+	})
+})
@@ -0,0 +1,96 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bandwidth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a time of day, in minutes since midnight, during which a rate
+// applies. Windows where End is before Start run past midnight.
+type Window struct {
+	Start int
+	End   int
+	Rate  int64
+}
+
+func (w Window) contains(minute int) bool {
+	if w.Start <= w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// Schedule is a list of windows; the first one containing the current
+// time sets the rate
+type Schedule []Window
+
+// ParseSchedule parses windows of the form 08:00-18:00=50MB/s
+func ParseSchedule(windows []string) (Schedule, error) {
+	var schedule Schedule
+	for _, value := range windows {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid schedule window %q, expected e.g. 08:00-18:00=50MB/s", value)
+		}
+
+		times := strings.SplitN(parts[0], "-", 2)
+		if len(times) != 2 {
+			return nil, fmt.Errorf("invalid schedule window %q, expected e.g. 08:00-18:00=50MB/s", value)
+		}
+
+		start, err := parseTimeOfDay(times[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(times[1])
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("schedule window %q is empty", value)
+		}
+
+		rate, err := ParseRate(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		schedule = append(schedule, Window{Start: start, End: end, Rate: rate})
+	}
+	return schedule, nil
+}
+
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// RateAt returns the rate of the first window containing t, or false when
+// no window does
+func (s Schedule) RateAt(t time.Time) (int64, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range s {
+		if window.contains(minute) {
+			return window.Rate, true
+		}
+	}
+	return 0, false
+}
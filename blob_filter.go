@@ -0,0 +1,154 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+// BlobFilterConfig selects the blobs to migrate. Patterns are globs matched
+// against blob paths, e.g. cc-droplets/buildpack_cache/**, where * does not
+// match / and ** does, or regular expressions prefixed with re:. Zero sizes
+// and times are not checked.
+type BlobFilterConfig struct {
+	Include        []string
+	Exclude        []string
+	MinSize        int64
+	MaxSize        int64
+	ModifiedBefore time.Time
+	ModifiedAfter  time.Time
+}
+
+// BlobFilter decides whether a blob is migrated
+type BlobFilter struct {
+	config   BlobFilterConfig
+	includes []pathPattern
+	excludes []pathPattern
+}
+
+type pathPattern struct {
+	value  string
+	regexp *regexp.Regexp
+}
+
+// NewBlobFilter compiles the patterns of config
+func NewBlobFilter(config BlobFilterConfig) (*BlobFilter, error) {
+	includes, err := compilePatterns(config.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	excludes, err := compilePatterns(config.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.MaxSize > 0 && config.MinSize > config.MaxSize {
+		return nil, fmt.Errorf("minimum size %d is larger than maximum size %d", config.MinSize, config.MaxSize)
+	}
+
+	return &BlobFilter{
+		config:   config,
+		includes: includes,
+		excludes: excludes,
+	}, nil
+}
+
+func compilePatterns(values []string) ([]pathPattern, error) {
+	var patterns []pathPattern
+	for _, value := range values {
+		expression := globToRegexp(value)
+		if strings.HasPrefix(value, "re:") {
+			expression = strings.TrimPrefix(value, "re:")
+		}
+
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", value, err)
+		}
+		patterns = append(patterns, pathPattern{value: value, regexp: re})
+	}
+	return patterns, nil
+}
+
+func globToRegexp(glob string) string {
+	var expression bytes.Buffer
+	expression.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expression.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expression.WriteString("[^/]*")
+		case glob[i] == '?':
+			expression.WriteString("[^/]")
+		default:
+			expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expression.WriteString("$")
+	return expression.String()
+}
+
+// Skip returns why blob should not be migrated, or false when it should be.
+// Blobs without a modification time are never skipped for their age.
+func (f *BlobFilter) Skip(blob *blobstore.Blob) (string, bool) {
+	for _, pattern := range f.excludes {
+		if pattern.regexp.MatchString(blob.Path) {
+			return "excluded by " + pattern.value, true
+		}
+	}
+
+	if len(f.includes) > 0 {
+		included := false
+		for _, pattern := range f.includes {
+			if pattern.regexp.MatchString(blob.Path) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "not included", true
+		}
+	}
+
+	if f.config.MinSize > 0 && blob.Size < f.config.MinSize {
+		return fmt.Sprintf("smaller than %d bytes", f.config.MinSize), true
+	}
+	if f.config.MaxSize > 0 && blob.Size > f.config.MaxSize {
+		return fmt.Sprintf("larger than %d bytes", f.config.MaxSize), true
+	}
+
+	if !blob.ModTime.IsZero() {
+		if !f.config.ModifiedBefore.IsZero() && !blob.ModTime.Before(f.config.ModifiedBefore) {
+			return "modified after " + f.config.ModifiedBefore.Format(time.RFC3339), true
+		}
+		if !f.config.ModifiedAfter.IsZero() && !blob.ModTime.After(f.config.ModifiedAfter) {
+			return "modified before " + f.config.ModifiedAfter.Format(time.RFC3339), true
+		}
+	}
+
+	return "", false
+}
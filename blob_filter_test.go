@@ -0,0 +1,99 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BlobFilter", func() {
+	newFilter := func(config goblob.BlobFilterConfig) *goblob.BlobFilter {
+		filter, err := goblob.NewBlobFilter(config)
+		Expect(err).NotTo(HaveOccurred())
+		return filter
+	}
+
+	skip := func(filter *goblob.BlobFilter, blob *blobstore.Blob) string {
+		reason, skipped := filter.Skip(blob)
+		Expect(skipped).To(Equal(reason != ""))
+		return reason
+	}
+
+	It("migrates everything by default", func() {
+		filter := newFilter(goblob.BlobFilterConfig{})
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet"})).To(BeEmpty())
+	})
+
+	It("skips blobs matching an exclude glob", func() {
+		filter := newFilter(goblob.BlobFilterConfig{
+			Exclude: []string{"cc-resources", "cc-droplets/buildpack_cache/**", "**/*.tmp"},
+		})
+
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-droplets/buildpack_cache/ab/cd/some-cache"})).To(Equal("excluded by cc-droplets/buildpack_cache/**"))
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-packages/ab/cd/upload.tmp"})).To(Equal("excluded by **/*.tmp"))
+		Expect(skip(filter, &blobstore.Blob{Path: "upload.tmp"})).To(Equal("excluded by **/*.tmp"))
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet"})).To(BeEmpty())
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-resources/ab/cd/some-resource"})).To(BeEmpty())
+	})
+
+	It("does not let * match a /", func() {
+		filter := newFilter(goblob.BlobFilterConfig{Exclude: []string{"cc-droplets/*"}})
+
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-droplets/some-droplet"})).NotTo(BeEmpty())
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-droplets/ab/some-droplet"})).To(BeEmpty())
+	})
+
+	It("migrates only blobs matching an include pattern", func() {
+		filter := newFilter(goblob.BlobFilterConfig{
+			Include: []string{"re:^cc-droplets/.*/3f1c[0-9a-f-]+"},
+		})
+
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-droplets/3f/1c/3f1c2b7a-guid/some-sha"})).To(BeEmpty())
+		Expect(skip(filter, &blobstore.Blob{Path: "cc-droplets/ab/cd/abcd-guid/some-sha"})).To(Equal("not included"))
+	})
+
+	It("skips blobs outside the size range", func() {
+		filter := newFilter(goblob.BlobFilterConfig{MinSize: 10, MaxSize: 100})
+
+		Expect(skip(filter, &blobstore.Blob{Path: "a/b", Size: 9})).To(Equal("smaller than 10 bytes"))
+		Expect(skip(filter, &blobstore.Blob{Path: "a/b", Size: 101})).To(Equal("larger than 100 bytes"))
+		Expect(skip(filter, &blobstore.Blob{Path: "a/b", Size: 100})).To(BeEmpty())
+	})
+
+	It("skips blobs outside the modification time range", func() {
+		after := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		before := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+		filter := newFilter(goblob.BlobFilterConfig{ModifiedAfter: after, ModifiedBefore: before})
+
+		Expect(skip(filter, &blobstore.Blob{Path: "a/b", ModTime: after.Add(-time.Hour)})).To(Equal("modified before 2018-01-01T00:00:00Z"))
+		Expect(skip(filter, &blobstore.Blob{Path: "a/b", ModTime: before.Add(time.Hour)})).To(Equal("modified after 2018-06-01T00:00:00Z"))
+		Expect(skip(filter, &blobstore.Blob{Path: "a/b", ModTime: after.Add(time.Hour)})).To(BeEmpty())
+		Expect(skip(filter, &blobstore.Blob{Path: "a/b"})).To(BeEmpty())
+	})
+
+	It("rejects invalid configuration", func() {
+		_, err := goblob.NewBlobFilter(goblob.BlobFilterConfig{Include: []string{"re:("}})
+		Expect(err).To(MatchError(ContainSubstring(`invalid pattern "re:("`)))
+
+		_, err = goblob.NewBlobFilter(goblob.BlobFilterConfig{MinSize: 10, MaxSize: 5})
+		Expect(err).To(MatchError("minimum size 10 is larger than maximum size 5"))
+	})
+})
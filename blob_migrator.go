@@ -16,6 +16,7 @@ package goblob
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pivotal-cf/goblob/blobstore"
 )
@@ -27,30 +28,63 @@ type BlobMigrator interface {
 }
 
 type blobMigrator struct {
-	dst blobstore.Blobstore
-	src blobstore.Blobstore
+	dst      blobstore.Blobstore
+	src      blobstore.Blobstore
+	progress func(blob *blobstore.Blob, bytes int64)
+	timer    PhaseTimer
 }
 
-func NewBlobMigrator(dst blobstore.Blobstore, src blobstore.Blobstore) BlobMigrator {
-	return &blobMigrator{
+// BlobMigratorOption configures optional behaviour of a BlobMigrator
+type BlobMigratorOption func(*blobMigrator)
+
+// WithTransferProgress calls progress as each part of a blob is read from
+// the source to be uploaded. Server-side copies report nothing, as their
+// bytes never pass through goblob.
+func WithTransferProgress(progress func(blob *blobstore.Blob, bytes int64)) BlobMigratorOption {
+	return func(m *blobMigrator) {
+		m.progress = progress
+	}
+}
+
+// WithPhaseTimer tells timer how long reading, writing or copying, and
+// verifying each blob took
+func WithPhaseTimer(timer PhaseTimer) BlobMigratorOption {
+	return func(m *blobMigrator) {
+		m.timer = timer
+	}
+}
+
+func NewBlobMigrator(dst blobstore.Blobstore, src blobstore.Blobstore, opts ...BlobMigratorOption) BlobMigrator {
+	migrator := &blobMigrator{
 		dst: dst,
 		src: src,
 	}
+	for _, opt := range opts {
+		opt(migrator)
+	}
+	return migrator
 }
 
 func (m *blobMigrator) Migrate(blob *blobstore.Blob) error {
-	reader, err := m.src.Read(blob)
-	if err != nil {
-		return fmt.Errorf("error reading blob at %s: %s", blob.Path, err)
+	checksumOf := m.dst.Checksum
+	if copier, ok := m.dst.(blobstore.ServerSideCopier); ok && copier.CanCopyFrom(m.src) {
+		start := time.Now()
+		err := copier.CopyFrom(m.src, blob)
+		m.time(blob, PhaseCopy, time.Since(start))
+		if err != nil {
+			return fmt.Errorf("error copying blob at %s: %s", blob.Path, err)
+		}
+		checksumOf = copier.CopiedChecksum
+	} else {
+		err := m.stream(blob)
+		if err != nil {
+			return err
+		}
 	}
-	defer reader.Close()
 
-	err = m.dst.Write(blob, reader)
-	if err != nil {
-		return fmt.Errorf("error writing blob at %s: %s", blob.Path, err)
-	}
-
-	checksum, err := m.dst.Checksum(blob)
+	start := time.Now()
+	checksum, err := checksumOf(blob)
+	m.time(blob, PhaseVerify, time.Since(start))
 	if err != nil {
 		return fmt.Errorf("error checksumming blob at %s: %s", blob.Path, err)
 	}
@@ -66,3 +100,50 @@ func (m *blobMigrator) Migrate(blob *blobstore.Blob) error {
 
 	return nil
 }
+
+// stream returns blobstore.ErrBlobChanged itself, rather than wrapped, when
+// the source blob changed while it was read, so that callers can retry it
+func (m *blobMigrator) stream(blob *blobstore.Blob) error {
+	start := time.Now()
+	reader, err := m.src.Read(blob)
+	opened := time.Since(start)
+	if err == blobstore.ErrBlobChanged {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error reading blob at %s: %s", blob.Path, err)
+	}
+	defer reader.Close()
+
+	var progress *progressReader
+	if m.progress != nil || m.timer != nil {
+		progress = newProgressReader(reader, func(n int64) {
+			if m.progress != nil {
+				m.progress(blob, n)
+			}
+		})
+		reader = progress.readCloser()
+	}
+
+	start = time.Now()
+	err = m.dst.Write(blob, reader)
+	if progress != nil {
+		m.time(blob, PhaseRead, opened+progress.elapsed)
+		m.time(blob, PhaseWrite, time.Since(start)-progress.elapsed)
+	}
+	if err != nil {
+		// destinations wrap read errors in their own, so ask the source
+		if detector, ok := m.src.(blobstore.ChangeDetector); ok && detector.Changed(blob) {
+			return blobstore.ErrBlobChanged
+		}
+		return fmt.Errorf("error writing blob at %s: %s", blob.Path, err)
+	}
+
+	return nil
+}
+
+func (m *blobMigrator) time(blob *blobstore.Blob, phase Phase, duration time.Duration) {
+	if m.timer != nil {
+		m.timer(blob, phase, duration)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"io/ioutil"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,6 +28,25 @@ import (
 	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
 )
 
+// copyingBlobstore is a blobstore that can also copy blobs server side
+type copyingBlobstore struct {
+	*blobstorefakes.FakeBlobstore
+	*blobstorefakes.FakeServerSideCopier
+}
+
+// seekableContent is blob content an upload can seek back through
+type seekableContent struct {
+	*strings.Reader
+}
+
+func (seekableContent) Close() error { return nil }
+
+// changingBlobstore is a blobstore whose blobs can change while they are read
+type changingBlobstore struct {
+	*blobstorefakes.FakeBlobstore
+	*blobstorefakes.FakeChangeDetector
+}
+
 var _ = Describe("BlobMigrator", func() {
 	var (
 		blobMigrator goblob.BlobMigrator
@@ -135,5 +155,161 @@ var _ = Describe("BlobMigrator", func() {
 				Expect(err.Error()).To(Equal("error at some-path/some-filename: checksum [other-checksum] does not match [some-checksum]"))
 			})
 		})
+
+		Context("when the source blob changes", func() {
+			var detector *blobstorefakes.FakeChangeDetector
+
+			BeforeEach(func() {
+				detector = &blobstorefakes.FakeChangeDetector{}
+				blobMigrator = goblob.NewBlobMigrator(dstStore, changingBlobstore{srcStore, detector})
+			})
+
+			It("returns ErrBlobChanged when the source says so on read", func() {
+				srcStore.ReadReturns(nil, blobstore.ErrBlobChanged)
+
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).To(Equal(blobstore.ErrBlobChanged))
+			})
+
+			It("returns ErrBlobChanged when writing fails because the blob changed", func() {
+				dstStore.WriteReturns(errors.New("ReadRequestBody: blob changed"))
+				detector.ChangedReturns(true)
+
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).To(Equal(blobstore.ErrBlobChanged))
+				Expect(detector.ChangedArgsForCall(0)).To(Equal(controlBlob))
+			})
+
+			It("returns the write error when the blob did not change", func() {
+				dstStore.WriteReturns(errors.New("write-error"))
+
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).To(MatchError("error writing blob at some-path/some-filename: write-error"))
+			})
+		})
+
+		Context("when transfer progress is reported", func() {
+			var reported map[*blobstore.Blob]int64
+
+			BeforeEach(func() {
+				reported = map[*blobstore.Blob]int64{}
+				blobMigrator = goblob.NewBlobMigrator(dstStore, srcStore, goblob.WithTransferProgress(func(blob *blobstore.Blob, n int64) {
+					reported[blob] += n
+				}))
+			})
+
+			It("reports the bytes read from the source", func() {
+				dstStore.WriteStub = func(blob *blobstore.Blob, src io.Reader) error {
+					_, err := ioutil.ReadAll(src)
+					return err
+				}
+
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reported).To(Equal(map[*blobstore.Blob]int64{controlBlob: 12}))
+			})
+
+			It("counts content read again after seeking back once", func() {
+				srcStore.ReadReturns(seekableContent{strings.NewReader("some content")}, nil)
+				dstStore.WriteStub = func(blob *blobstore.Blob, src io.Reader) error {
+					if _, err := ioutil.ReadAll(src); err != nil {
+						return err
+					}
+					seeker, ok := src.(io.Seeker)
+					Expect(ok).To(BeTrue())
+					if _, err := seeker.Seek(5, io.SeekStart); err != nil {
+						return err
+					}
+					_, err := ioutil.ReadAll(src)
+					return err
+				}
+
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reported[controlBlob]).To(Equal(int64(len("some content"))))
+			})
+		})
+
+		Context("when phases are timed", func() {
+			var phases []goblob.Phase
+
+			BeforeEach(func() {
+				phases = nil
+				blobMigrator = goblob.NewBlobMigrator(dstStore, srcStore, goblob.WithPhaseTimer(func(blob *blobstore.Blob, phase goblob.Phase, duration time.Duration) {
+					Expect(blob).To(Equal(controlBlob))
+					Expect(duration).To(BeNumerically(">=", 0))
+					phases = append(phases, phase)
+				}))
+			})
+
+			It("times reading, writing and verifying the blob", func() {
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(phases).To(Equal([]goblob.Phase{goblob.PhaseRead, goblob.PhaseWrite, goblob.PhaseVerify}))
+			})
+		})
+
+		Context("when the destination can copy from the source server side", func() {
+			var copier *blobstorefakes.FakeServerSideCopier
+
+			BeforeEach(func() {
+				copier = &blobstorefakes.FakeServerSideCopier{}
+				copier.CanCopyFromReturns(true)
+				copier.CopiedChecksumReturns("some-checksum", nil)
+				blobMigrator = goblob.NewBlobMigrator(copyingBlobstore{dstStore, copier}, srcStore)
+			})
+
+			It("copies the blob instead of streaming it", func() {
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(copier.CanCopyFromArgsForCall(0)).To(Equal(srcStore))
+				Expect(copier.CopyFromCallCount()).To(Equal(1))
+				src, blob := copier.CopyFromArgsForCall(0)
+				Expect(src).To(Equal(srcStore))
+				Expect(blob).To(Equal(controlBlob))
+
+				Expect(srcStore.ReadCallCount()).To(Equal(0))
+				Expect(dstStore.WriteCallCount()).To(Equal(0))
+			})
+
+			It("verifies the checksum of the copied content", func() {
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(copier.CopiedChecksumCallCount()).To(Equal(1))
+				Expect(copier.CopiedChecksumArgsForCall(0)).To(Equal(controlBlob))
+				Expect(dstStore.ChecksumCallCount()).To(Equal(0))
+			})
+
+			It("returns an error when the copied content does not match", func() {
+				copier.CopiedChecksumReturns("other-checksum", nil)
+
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).To(MatchError("error at some-path/some-filename: checksum [other-checksum] does not match [some-checksum]"))
+			})
+
+			It("returns an error when the copy fails", func() {
+				copier.CopyFromReturns(errors.New("copy-error"))
+
+				err := blobMigrator.Migrate(controlBlob)
+				Expect(err).To(MatchError("error copying blob at some-path/some-filename: copy-error"))
+			})
+
+			Context("when the source is not compatible", func() {
+				BeforeEach(func() {
+					copier.CanCopyFromReturns(false)
+				})
+
+				It("streams the blob", func() {
+					err := blobMigrator.Migrate(controlBlob)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(copier.CopyFromCallCount()).To(Equal(0))
+					Expect(srcStore.ReadCallCount()).To(Equal(1))
+					Expect(dstStore.WriteCallCount()).To(Equal(1))
+				})
+			})
+		})
 	})
 })
@@ -16,18 +16,22 @@ package blobstore
 
 import (
 	"context"
-	"encoding/base64"
+	"crypto/md5"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/cheggaaa/pb"
+	"github.com/pivotal-cf/goblob/logging"
 	"github.com/pivotal-cf/goblob/validation"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/2018-03-28/azblob"
 )
 
@@ -45,6 +49,62 @@ type azblobStore struct {
 	serviceURL          *azblob.ServiceURL
 	useMultipartUploads bool
 	containerMapping    map[string]string
+	httpClient          *http.Client
+	blockSize           int64
+	uploadConcurrency   int
+	sasToken            string
+	sharedKey           *azblob.SharedKeyCredential
+	servicePrincipal    *AzServicePrincipal
+	endpoint            string
+	endpointSuffix      string
+	objectSettings      AzBlobObjectSettings
+	containersMutex     sync.Mutex
+	readyContainers     map[string]bool
+}
+
+// AzBlobOption configures optional behaviour of an Azure blobstore
+type AzBlobOption func(*azblobStore)
+
+// WithAzBlobHTTPClient sends requests through the given client instead of
+// the default one
+func WithAzBlobHTTPClient(client *http.Client) AzBlobOption {
+	return func(s *azblobStore) {
+		s.httpClient = client
+	}
+}
+
+// WithAzBlobBlockSize sets the minimum block size of uploads. Larger blocks
+// are used for blobs that would otherwise need more than 50,000 blocks.
+func WithAzBlobBlockSize(blockSize int64) AzBlobOption {
+	return func(s *azblobStore) {
+		s.blockSize = blockSize
+	}
+}
+
+// WithAzBlobUploadConcurrency sets how many blocks of a single blob are
+// uploaded at once
+func WithAzBlobUploadConcurrency(concurrency int) AzBlobOption {
+	return func(s *azblobStore) {
+		s.uploadConcurrency = concurrency
+	}
+}
+
+// WithAzBlobEndpoint sends requests to the given blob service URL instead of
+// the one for the cloud, e.g. http://127.0.0.1:10000/devstoreaccount1 for
+// the Azurite emulator
+func WithAzBlobEndpoint(endpoint string) AzBlobOption {
+	return func(s *azblobStore) {
+		s.endpoint = endpoint
+	}
+}
+
+// WithAzBlobEndpointSuffix replaces the cloud's storage endpoint suffix,
+// e.g. local.azurestack.external for Azure Stack Hub. The blob service URL
+// is https://<account>.blob.<suffix>.
+func WithAzBlobEndpointSuffix(suffix string) AzBlobOption {
+	return func(s *azblobStore) {
+		s.endpointSuffix = suffix
+	}
 }
 
 func NewAzBlobStore(
@@ -55,26 +115,107 @@ func NewAzBlobStore(
 	dropletsContainerName string,
 	packagesContainerName string,
 	resourcesContainerName string,
-) Blobstore {
-	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
-	if err != nil {
-		panic(err)
-	}
-	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
-
-	primaryURL, _ := url.Parse(
-		fmt.Sprintf("https://%s.blob.%s", accountName, cloudStorageEnpointsMap[cloudName]))
-	serviceURL := azblob.NewServiceURL(*primaryURL, pipeline)
-
-	return &azblobStore{
-		serviceURL: &serviceURL,
+	opts ...AzBlobOption,
+) (Blobstore, error) {
+	store := &azblobStore{
 		containerMapping: map[string]string{
 			"cc-buildpacks": buildpacksContainerName,
 			"cc-resources":  resourcesContainerName,
 			"cc-droplets":   dropletsContainerName,
 			"cc-packages":   packagesContainerName,
 		},
+		blockSize:         DefaultPartSize,
+		uploadConcurrency: DefaultUploadConcurrency,
 	}
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	primaryURL, err := store.serviceEndpoint(accountName, cloudName)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := store.credential(accountName, accountKey, cloudName)
+	if err != nil {
+		return nil, err
+	}
+	p := newAzPipeline(credential, store.httpClient)
+
+	primaryURL.RawQuery = store.sasToken
+	serviceURL := azblob.NewServiceURL(*primaryURL, p)
+	store.serviceURL = &serviceURL
+
+	return store, nil
+}
+
+func (s *azblobStore) serviceEndpoint(accountName, cloudName string) (*url.URL, error) {
+	if s.endpoint != "" && s.endpointSuffix != "" {
+		return nil, errors.New("only one of an endpoint or an endpoint suffix can be given")
+	}
+
+	endpoint := s.endpoint
+	if endpoint == "" {
+		suffix := s.endpointSuffix
+		if suffix == "" {
+			var ok bool
+			suffix, ok = cloudStorageEnpointsMap[cloudName]
+			if !ok {
+				return nil, fmt.Errorf("unknown cloud name %q, expected one of %s", cloudName, strings.Join(cloudNames(), ", "))
+			}
+		}
+		endpoint = fmt.Sprintf("https://%s.blob.%s", accountName, strings.Trim(suffix, "./"))
+	}
+
+	serviceURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %s", err)
+	}
+	if (serviceURL.Scheme != "http" && serviceURL.Scheme != "https") || serviceURL.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q: an http or https URL is required", endpoint)
+	}
+	if serviceURL.RawQuery != "" {
+		return nil, fmt.Errorf("invalid endpoint %q: give a SAS token separately", endpoint)
+	}
+	return serviceURL, nil
+}
+
+func cloudNames() []string {
+	var names []string
+	for name := range cloudStorageEnpointsMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newAzPipeline mirrors azblob.NewPipeline, which always sends requests
+// through the default HTTP client
+func newAzPipeline(credential azblob.Credential, client *http.Client) pipeline.Pipeline {
+	if client == nil {
+		return azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	}
+
+	factories := []pipeline.Factory{
+		azblob.NewTelemetryPolicyFactory(azblob.TelemetryOptions{}),
+		azblob.NewUniqueRequestIDPolicyFactory(),
+		azblob.NewRetryPolicyFactory(azblob.RetryOptions{}),
+		credential,
+		pipeline.MethodFactoryMarker(),
+		azblob.NewRequestLogPolicyFactory(azblob.RequestLogOptions{}),
+	}
+
+	sender := pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			response, err := client.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+			return pipeline.NewHTTPResponse(response), err
+		}
+	})
+
+	return pipeline.NewPipeline(factories, pipeline.Options{HTTPSender: sender})
 }
 
 func (s *azblobStore) Name() string {
@@ -84,44 +225,36 @@ func (s *azblobStore) Name() string {
 func (s *azblobStore) List() ([]*Blob, error) {
 	var blobs []*Blob
 
-	containersOnAccount, err := s.listContainers()
-	if err != nil {
-		return nil, err
-	}
-
 	for _, container := range containers {
 		containerName := s.destContainerName(container)
 		containerUrl := s.serviceURL.NewContainerURL(containerName)
 
-		containerExists := stringInArray(containersOnAccount, containerName)
+		containerExists, err := s.doesContainerExist(containerName)
+		if err != nil {
+			return nil, err
+		}
 		if containerExists {
 			for marker := (azblob.Marker{}); marker.NotDone(); {
 				listBlob, err := containerUrl.ListBlobsFlatSegment(context.Background(),
 					marker,
-					azblob.ListBlobsSegmentOptions{})
+					azblob.ListBlobsSegmentOptions{
+						Details: azblob.BlobListingDetails{Metadata: true},
+					})
 				if err != nil {
 					return nil, err
 				}
 
 				marker = listBlob.NextMarker
 
-				bar := pb.StartNew(len(listBlob.Segment.BlobItems))
 				for _, blobInfo := range listBlob.Segment.BlobItems {
-					md5, err := base64.StdEncoding.DecodeString(string(blobInfo.Properties.ContentMD5[:]))
-					if err != nil {
-						return nil, err
-					}
-					checksum := hex.EncodeToString(md5)
-
 					blob := &Blob{
 						Path:     filepath.Join(container, blobInfo.Name),
-						Checksum: checksum,
+						Checksum: checksumFromBlobItem(blobInfo),
+						Size:     blobSize(blobInfo),
 					}
 					blobs = append(blobs, blob)
-
-					bar.Increment()
 				}
-				bar.FinishPrint(containerName)
+				logging.Debug("listed container", "store", s.Name(), "container", containerName, "blobs", len(listBlob.Segment.BlobItems))
 			}
 		}
 	}
@@ -146,13 +279,17 @@ func (s *azblobStore) Read(src *Blob) (io.ReadCloser, error) {
 	return response.Body(azblob.RetryReaderOptions{MaxRetryRequests: 3}), nil
 }
 
+// Checksum downloads the blob to checksum it, except for archived blobs,
+// which cannot be read without rehydrating them. Their checksum is the one
+// Write verified before archiving them.
 func (s *azblobStore) Checksum(src *Blob) (string, error) {
-	// large blob does not have Content-MD5 in Metadata,
-	// otherwise it will be faster to get checksum from metadata.
-	// return s.checksumFromMetadata(src)
+	if s.objectSettings.accessTier(s.sourceContainer(src)) == azblob.AccessTierArchive {
+		return s.checksumFromMetadata(src)
+	}
+
 	rc, err := s.Read(src)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	defer rc.Close()
 
@@ -162,23 +299,47 @@ func (s *azblobStore) Checksum(src *Blob) (string, error) {
 func (s *azblobStore) Write(dst *Blob, src io.Reader) error {
 	containerName := s.containerName(dst)
 	path := s.path(dst)
-	if err := s.createContainer(containerName); err != nil {
+	if err := s.ensureContainer(containerName); err != nil {
 		return err
 	}
 
 	containerURL := s.serviceURL.NewContainerURL(containerName)
 	blobURL := containerURL.NewBlockBlobURL(path)
 
+	blockSize := OptimalPartSize(dst.Size, s.blockSize, azureMaxBlocks)
+	if blockSize > azureMaxBlockSize {
+		return fmt.Errorf("blob %s is too large to upload in %d blocks", dst.Path, azureMaxBlocks)
+	}
+
+	hash := md5.New()
 	_, err := azblob.UploadStreamToBlockBlob(context.Background(),
-		src,
+		io.TeeReader(src, hash),
 		blobURL,
 		azblob.UploadStreamToBlockBlobOptions{
-			BufferSize: 10 * 1024 * 1024, // 10M buffer size
-			MaxBuffers: 20,
+			BufferSize: int(blockSize),
+			MaxBuffers: s.uploadConcurrency,
+			Metadata:   s.objectSettings.metadata(dst.Checksum),
 		})
 	if err != nil {
 		return err
 	}
+
+	tier := s.objectSettings.accessTier(s.sourceContainer(dst))
+	if tier == azblob.AccessTierNone {
+		return nil
+	}
+
+	// Archived blobs cannot be read back to verify them, so the content is
+	// checked against the source checksum before it is archived.
+	if tier == azblob.AccessTierArchive {
+		if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != dst.Checksum {
+			return fmt.Errorf("uploaded checksum [%s] does not match [%s]", checksum, dst.Checksum)
+		}
+	}
+
+	if _, err := blobURL.SetTier(context.Background(), tier); err != nil {
+		return fmt.Errorf("error setting access tier %s: %s", tier, err)
+	}
 	return nil
 }
 
@@ -219,26 +380,45 @@ func (s *azblobStore) NewBucketIterator(containerName string) (BucketIterator, e
 
 	doneCh := make(chan struct{})
 	blobCh := make(chan *Blob)
+	errCh := make(chan error)
 
 	iterator := &s3BucketIterator{
 		doneCh: doneCh,
 		blobCh: blobCh,
+		errCh:  errCh,
 	}
 
 	go func() {
 		for marker.NotDone() {
 			for _, blobInfo := range listBlob.Segment.BlobItems {
+				blob := &Blob{
+					Path:    filepath.Join(containerName, blobInfo.Name),
+					Size:    blobSize(blobInfo),
+					ModTime: blobInfo.Properties.LastModified,
+				}
+
 				select {
 				case <-doneCh:
-					doneCh = nil
 					return
-				default:
-					blobCh <- &Blob{
-						Path: filepath.Join(containerName, blobInfo.Name),
-					}
+				case blobCh <- blob:
 				}
 			}
 			marker = listBlob.NextMarker
+			if !marker.NotDone() {
+				break
+			}
+
+			listBlob, err = containerUrl.ListBlobsFlatSegment(context.Background(),
+				marker,
+				azblob.ListBlobsSegmentOptions{})
+			if err != nil {
+				// nothing reads the error once the iterator is done with
+				select {
+				case errCh <- err:
+				case <-doneCh:
+				}
+				return
+			}
 		}
 		close(blobCh)
 	}()
@@ -252,16 +432,56 @@ func (s *azblobStore) destContainerName(container string) string {
 	return s.containerMapping[container]
 }
 
+func (s *azblobStore) sourceContainer(blob *Blob) string {
+	return blob.Path[:strings.Index(blob.Path, "/")]
+}
+
 func (s *azblobStore) containerName(blob *Blob) string {
 	return s.destContainerName(blob.Path[:strings.Index(blob.Path, "/")])
 }
 
+// doesContainerExist looks the container up directly rather than listing
+// the account's containers, which a container SAS token is not allowed to do
 func (s *azblobStore) doesContainerExist(containerName string) (bool, error) {
-	containers, err := s.listContainers()
+	containerURL := s.serviceURL.NewContainerURL(containerName)
+
+	_, err := containerURL.GetProperties(context.Background(), azblob.LeaseAccessConditions{})
+	if serr, ok := err.(azblob.StorageError); ok && serr.Response() != nil {
+		if serr.Response().StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+	}
 	if err != nil {
 		return false, err
 	}
-	return stringInArray(containers, containerName), nil
+	return true, nil
+}
+
+// ensureContainer creates the container if it is missing. Each container is
+// only checked once.
+func (s *azblobStore) ensureContainer(containerName string) error {
+	s.containersMutex.Lock()
+	defer s.containersMutex.Unlock()
+
+	if s.readyContainers[containerName] {
+		return nil
+	}
+
+	containerExists, err := s.doesContainerExist(containerName)
+	if err != nil {
+		return err
+	}
+	if !containerExists {
+		if err := s.createContainer(containerName); err != nil {
+			return err
+		}
+	}
+
+	if s.readyContainers == nil {
+		s.readyContainers = map[string]bool{}
+	}
+	s.readyContainers[containerName] = true
+	return nil
 }
 
 func (s *azblobStore) createContainer(containerName string) error {
@@ -273,34 +493,13 @@ func (s *azblobStore) createContainer(containerName string) error {
 	if serr, ok := err.(azblob.StorageError); ok {
 		switch serr.ServiceCode() {
 		case azblob.ServiceCodeContainerAlreadyExists:
-		default:
-			return err
+			return nil
 		}
 	}
 
-	return nil
+	return err
 }
 
-func (s *azblobStore) listContainers() ([]string, error) {
-	var containers []string
-	for marker := (azblob.Marker{}); marker.NotDone(); {
-		l, err := s.serviceURL.ListContainersSegment(
-			context.Background(),
-			marker,
-			azblob.ListContainersSegmentOptions{})
-		if err != nil {
-			return nil, err
-		}
-
-		marker = l.NextMarker
-
-		for _, c := range l.ContainerItems {
-			containers = append(containers, c.Name)
-		}
-	}
-
-	return containers, nil
-}
 func (s *azblobStore) path(blob *Blob) string {
 	return blob.Path[(strings.Index(blob.Path, "/") + 1):]
 }
@@ -316,16 +515,18 @@ func (s *azblobStore) checksumFromMetadata(src *Blob) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	md5 := r.ContentMD5()
+	for key, value := range r.NewMetadata() {
+		if strings.ToLower(key) == azblobChecksumKey {
+			return value, nil
+		}
+	}
 
-	return hex.EncodeToString(md5), nil
+	return "", nil
 }
 
-func stringInArray(arr []string, str string) bool {
-	for _, a := range arr {
-		if a == str {
-			return true
-		}
+func blobSize(blobInfo azblob.BlobItem) int64 {
+	if blobInfo.Properties.ContentLength == nil {
+		return 0
 	}
-	return false
+	return *blobInfo.Properties.ContentLength
 }
@@ -0,0 +1,82 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Azure bucket iterator", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("comp") != "list" {
+				return
+			}
+			if r.URL.Query().Get("marker") == "" {
+				fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults ContainerName="some-droplets">
+  <Blobs>
+    <Blob>
+      <Name>ab/cd/some-droplet</Name>
+      <Properties>
+        <Last-Modified>Sat, 01 Sep 2018 00:00:00 GMT</Last-Modified>
+        <Content-Length>7</Content-Length>
+      </Properties>
+    </Blob>
+  </Blobs>
+  <NextMarker>some-marker</NextMarker>
+</EnumerationResults>`)
+				return
+			}
+			w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+			w.WriteHeader(http.StatusForbidden)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("returns an error when a later page cannot be listed", func() {
+		store, err := blobstore.NewAzBlobStore(
+			"someaccount", "c29tZS1rZXk=", "",
+			"some-buildpacks", "some-droplets", "some-packages", "some-resources",
+			blobstore.WithAzBlobEndpoint(server.URL+"/devstoreaccount1"),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		iterator, err := store.NewBucketIterator("cc-droplets")
+		Expect(err).NotTo(HaveOccurred())
+		defer iterator.Done()
+
+		blob, err := iterator.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blob.Path).To(Equal("cc-droplets/ab/cd/some-droplet"))
+
+		_, err = iterator.Next()
+		Expect(err).To(HaveOccurred())
+		Expect(err).NotTo(Equal(blobstore.ErrIteratorDone))
+		Expect(err.Error()).To(ContainSubstring("AuthenticationFailed"))
+	})
+})
@@ -0,0 +1,155 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/2018-03-28/azblob"
+	"github.com/pivotal-cf/goblob/validation"
+)
+
+const (
+	// azblobCopySASDuration is how long the destination has to read the
+	// source blob once a copy has started
+	azblobCopySASDuration = 7 * 24 * time.Hour
+)
+
+// azblobCopyPollInterval is how often the status of a pending copy is checked
+var azblobCopyPollInterval = time.Second
+
+// CanCopyFrom reports whether src is an Azure blobstore whose blobs can be
+// given to the destination as a URL it is allowed to read: one
+// authenticated with a SAS token or an account key
+func (s *azblobStore) CanCopyFrom(src Blobstore) bool {
+	srcStore, ok := src.(*azblobStore)
+	if !ok {
+		return false
+	}
+	return srcStore.sasToken != "" || srcStore.sharedKey != nil
+}
+
+// CopyFrom asks Azure to copy a blob from another Azure blobstore and waits
+// for the copy to finish
+func (s *azblobStore) CopyFrom(src Blobstore, blob *Blob) error {
+	srcStore, ok := src.(*azblobStore)
+	if !ok {
+		return fmt.Errorf("cannot copy from %s to Azure", src.Name())
+	}
+
+	sourceURL, err := srcStore.readableURL(blob)
+	if err != nil {
+		return err
+	}
+
+	containerName := s.containerName(blob)
+	if err := s.ensureContainer(containerName); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	blobURL := s.serviceURL.NewContainerURL(containerName).NewBlobURL(s.path(blob))
+
+	response, err := blobURL.StartCopyFromURL(ctx,
+		sourceURL,
+		s.objectSettings.metadata(blob.Checksum),
+		azblob.ModifiedAccessConditions{},
+		azblob.BlobAccessConditions{})
+	if err != nil {
+		return err
+	}
+
+	status := response.CopyStatus()
+	for status == azblob.CopyStatusPending {
+		time.Sleep(azblobCopyPollInterval)
+
+		properties, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+		if err != nil {
+			return err
+		}
+		status = properties.CopyStatus()
+		if status != azblob.CopyStatusPending && status != azblob.CopyStatusSuccess {
+			return fmt.Errorf("copy %s: %s", status, properties.CopyStatusDescription())
+		}
+	}
+	if status != azblob.CopyStatusSuccess {
+		return fmt.Errorf("copy %s", status)
+	}
+
+	tier := s.objectSettings.accessTier(s.sourceContainer(blob))
+	if tier == azblob.AccessTierNone {
+		return nil
+	}
+
+	// Archived blobs cannot be read back, so the copy is checked before it
+	// is archived.
+	if tier == azblob.AccessTierArchive {
+		rc, err := s.Read(blob)
+		if err != nil {
+			return err
+		}
+		checksum, err := validation.ChecksumReader(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if checksum != blob.Checksum {
+			return fmt.Errorf("copied checksum [%s] does not match [%s]", checksum, blob.Checksum)
+		}
+	}
+
+	if _, err := blobURL.SetTier(ctx, tier); err != nil {
+		return fmt.Errorf("error setting access tier %s: %s", tier, err)
+	}
+	return nil
+}
+
+// CopiedChecksum returns the checksum of a copied blob's content. Azure
+// copies the source's Content-MD5 rather than computing one, so the blob is
+// read back; archived blobs were already checked by CopyFrom.
+func (s *azblobStore) CopiedChecksum(blob *Blob) (string, error) {
+	return s.Checksum(blob)
+}
+
+// readableURL returns the URL of a blob with a SAS the destination account
+// can read it with
+func (s *azblobStore) readableURL(blob *Blob) (url.URL, error) {
+	blobURL := s.serviceURL.NewContainerURL(s.containerName(blob)).NewBlobURL(s.path(blob))
+	sourceURL := blobURL.URL()
+	if s.sasToken != "" {
+		return sourceURL, nil
+	}
+
+	if s.sharedKey == nil {
+		return url.URL{}, fmt.Errorf("blob %s cannot be shared without an account key or a SAS token", blob.Path)
+	}
+
+	sas, err := azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPSandHTTP,
+		ExpiryTime:    time.Now().UTC().Add(azblobCopySASDuration),
+		ContainerName: s.containerName(blob),
+		BlobName:      s.path(blob),
+		Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+	}.NewSASQueryParameters(s.sharedKey)
+	if err != nil {
+		return url.URL{}, fmt.Errorf("error creating SAS for %s: %s", blob.Path, err)
+	}
+
+	sourceURL.RawQuery = sas.Encode()
+	return sourceURL, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Azure server-side copy", func() {
+	var (
+		server      *httptest.Server
+		mutex       sync.Mutex
+		copySources []string
+		copyStatus  string
+	)
+
+	BeforeEach(func() {
+		copySources = nil
+		copyStatus = "success"
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if source := r.Header.Get("x-ms-copy-source"); source != "" {
+				copySources = append(copySources, source)
+				w.Header().Set("x-ms-copy-id", "some-copy-id")
+				w.Header().Set("x-ms-copy-status", copyStatus)
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			if r.Method == "HEAD" && r.URL.Query().Get("restype") != "container" {
+				w.Header().Set("x-ms-copy-status", copyStatus)
+				w.Header().Set("x-ms-copy-status-description", "some-description")
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newStore := func(accountName string, opts ...blobstore.AzBlobOption) blobstore.Blobstore {
+		opts = append(opts, blobstore.WithAzBlobEndpoint(server.URL+"/"+accountName))
+		store, err := blobstore.NewAzBlobStore(
+			accountName, "c29tZS1rZXk=", "AzureCloud",
+			"some-buildpacks", "some-droplets", "some-packages", "some-resources",
+			opts...,
+		)
+		Expect(err).NotTo(HaveOccurred())
+		return store
+	}
+
+	It("can only copy from Azure blobstores it can give a readable URL for", func() {
+		dst := newStore("dstaccount").(blobstore.ServerSideCopier)
+
+		Expect(dst.CanCopyFrom(newStore("srcaccount"))).To(BeTrue())
+		Expect(dst.CanCopyFrom(blobstore.NewNFS("/some/path"))).To(BeFalse())
+	})
+
+	It("copies the blob through a read-only SAS", func() {
+		src := newStore("srcaccount")
+		dst := newStore("dstaccount").(blobstore.ServerSideCopier)
+
+		blob := &blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet", Checksum: "some-checksum"}
+		Expect(dst.CopyFrom(src, blob)).To(Succeed())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(copySources).To(HaveLen(1))
+
+		source, err := url.Parse(copySources[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source.Path).To(Equal("/srcaccount/some-droplets/ab/cd/some-droplet"))
+		Expect(source.Query().Get("sp")).To(Equal("r"))
+		Expect(source.Query().Get("sig")).NotTo(BeEmpty())
+	})
+
+	It("returns an error when the copy fails", func() {
+		copyStatus = "failed"
+		src := newStore("srcaccount")
+		dst := newStore("dstaccount").(blobstore.ServerSideCopier)
+
+		err := dst.CopyFrom(src, &blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet"})
+		Expect(err).To(MatchError("copy failed"))
+	})
+})
@@ -0,0 +1,210 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/2018-03-28/azblob"
+)
+
+const (
+	azureStorageResource = "https://storage.azure.com/"
+
+	// tokens are refreshed this long before they expire, or a tenth of
+	// their lifetime before for tokens that are short-lived
+	azureTokenRefreshMargin = 5 * time.Minute
+	// a failed refresh is retried after this long
+	azureTokenRetryInterval = 30 * time.Second
+)
+
+var activeDirectoryEndpointsMap = map[string]string{
+	"AzureChinaCloud":   "https://login.chinacloudapi.cn/",
+	"AzureCloud":        "https://login.microsoftonline.com/",
+	"AzureGermanCloud":  "https://login.microsoftonline.de/",
+	"AzureUSGovernment": "https://login.microsoftonline.us/",
+}
+
+// AzServicePrincipal is an Azure AD application that is granted access to
+// the storage account, e.g. with the Storage Blob Data Contributor role
+type AzServicePrincipal struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	// ActiveDirectoryEndpoint is the authority tokens are requested from;
+	// empty means the one for the cloud
+	ActiveDirectoryEndpoint string
+}
+
+// WithAzBlobSASToken authenticates with a shared access signature, which
+// may be scoped to the account or to a single container, instead of the
+// account key
+func WithAzBlobSASToken(sasToken string) AzBlobOption {
+	return func(s *azblobStore) {
+		s.sasToken = strings.TrimPrefix(sasToken, "?")
+	}
+}
+
+// WithAzBlobServicePrincipal authenticates with OAuth tokens issued to a
+// service principal instead of the account key. Tokens are refreshed before
+// they expire.
+func WithAzBlobServicePrincipal(servicePrincipal AzServicePrincipal) AzBlobOption {
+	return func(s *azblobStore) {
+		s.servicePrincipal = &servicePrincipal
+	}
+}
+
+func (s *azblobStore) credential(accountName, accountKey, cloudName string) (azblob.Credential, error) {
+	given := 0
+	for _, set := range []bool{accountKey != "", s.sasToken != "", s.servicePrincipal != nil} {
+		if set {
+			given++
+		}
+	}
+	if given > 1 {
+		return nil, errors.New("only one of an account key, a SAS token or a service principal can be given")
+	}
+
+	switch {
+	case s.sasToken != "":
+		if _, err := url.ParseQuery(s.sasToken); err != nil {
+			return nil, fmt.Errorf("invalid SAS token: %s", err)
+		}
+		return azblob.NewAnonymousCredential(), nil
+	case s.servicePrincipal != nil:
+		return s.servicePrincipal.tokenCredential(cloudName, s.tokenHTTPClient())
+	case accountKey != "":
+		credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid account key: %s", err)
+		}
+		s.sharedKey = credential
+		return credential, nil
+	}
+	return nil, errors.New("an account key, a SAS token or a service principal is required")
+}
+
+func (s *azblobStore) tokenHTTPClient() *http.Client {
+	if s.httpClient != nil {
+		return s.httpClient
+	}
+	return http.DefaultClient
+}
+
+func (sp AzServicePrincipal) tokenCredential(cloudName string, client *http.Client) (azblob.Credential, error) {
+	if sp.TenantID == "" || sp.ClientID == "" || sp.ClientSecret == "" {
+		return nil, errors.New("a service principal requires a tenant ID, a client ID and a client secret")
+	}
+
+	endpoint := sp.ActiveDirectoryEndpoint
+	if endpoint == "" {
+		endpoint = activeDirectoryEndpointsMap[cloudName]
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("no Active Directory endpoint is known for cloud %q", cloudName)
+	}
+	tokenURL := strings.TrimSuffix(endpoint, "/") + "/" + url.PathEscape(sp.TenantID) + "/oauth2/token"
+
+	// The first token is fetched here so that bad credentials are reported
+	// straight away rather than by the first request to fail.
+	token, err := sp.fetchToken(client, tokenURL)
+	if err != nil {
+		return nil, err
+	}
+
+	first := true
+	return azblob.NewTokenCredential(token.AccessToken, func(credential azblob.TokenCredential) time.Duration {
+		if first {
+			first = false
+			return token.refreshIn()
+		}
+
+		refreshed, err := sp.fetchToken(client, tokenURL)
+		if err != nil {
+			return azureTokenRetryInterval
+		}
+		credential.SetToken(refreshed.AccessToken)
+		return refreshed.refreshIn()
+	}), nil
+}
+
+type azToken struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+type azTokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (sp AzServicePrincipal) fetchToken(client *http.Client, tokenURL string) (azToken, error) {
+	response, err := client.PostForm(tokenURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {sp.ClientID},
+		"client_secret": {sp.ClientSecret},
+		"resource":      {azureStorageResource},
+	})
+	if err != nil {
+		return azToken{}, fmt.Errorf("error requesting token: %s", err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return azToken{}, fmt.Errorf("error reading token: %s", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var tokenError azTokenError
+		if json.Unmarshal(body, &tokenError) == nil && tokenError.Error != "" {
+			return azToken{}, fmt.Errorf("error requesting token: %s: %s", tokenError.Error, tokenError.ErrorDescription)
+		}
+		return azToken{}, fmt.Errorf("error requesting token: %s", response.Status)
+	}
+
+	var token azToken
+	if err := json.Unmarshal(body, &token); err != nil {
+		return azToken{}, fmt.Errorf("error decoding token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return azToken{}, errors.New("error requesting token: no access token returned")
+	}
+	return token, nil
+}
+
+// refreshIn is how long to wait before replacing the token
+func (t azToken) refreshIn() time.Duration {
+	seconds, err := strconv.ParseInt(string(t.ExpiresIn), 10, 64)
+	if err != nil || seconds <= 0 {
+		return azureTokenRetryInterval
+	}
+
+	expiresIn := time.Duration(seconds) * time.Second
+	margin := azureTokenRefreshMargin
+	if margin > expiresIn/10 {
+		margin = expiresIn / 10
+	}
+	return expiresIn - margin
+}
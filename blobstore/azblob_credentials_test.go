@@ -0,0 +1,180 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// redirectTransport sends every request to a local server while keeping the
+// host it was meant for in the Host header
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.WithContext(req.Context())
+	req.Host = req.URL.Host
+	redirected := *req.URL
+	redirected.Scheme = t.target.Scheme
+	redirected.Host = t.target.Host
+	req.URL = &redirected
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+var _ = Describe("Azure authentication", func() {
+	var (
+		server     *httptest.Server
+		httpClient *http.Client
+
+		mutex        sync.Mutex
+		tokenForms   []url.Values
+		blobRequests []*http.Request
+	)
+
+	BeforeEach(func() {
+		tokenForms = nil
+		blobRequests = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if r.Host == "login.microsoftonline.com" {
+				r.ParseForm()
+				tokenForms = append(tokenForms, r.PostForm)
+
+				if r.PostForm.Get("client_secret") != "some-client-secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					fmt.Fprint(w, `{"error":"invalid_client","error_description":"bad secret"}`)
+					return
+				}
+				fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":"1","token_type":"Bearer"}`, len(tokenForms))
+				return
+			}
+
+			blobRequests = append(blobRequests, r)
+			if r.URL.Query().Get("comp") == "list" {
+				fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs></Blobs><NextMarker /></EnumerationResults>`)
+			}
+		}))
+
+		target, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		httpClient = &http.Client{Transport: redirectTransport{target: target}}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newStore := func(accountKey string, opts ...blobstore.AzBlobOption) (blobstore.Blobstore, error) {
+		return blobstore.NewAzBlobStore(
+			"someaccount", accountKey, "AzureCloud",
+			"some-buildpacks", "some-droplets", "some-packages", "some-resources",
+			append(opts, blobstore.WithAzBlobHTTPClient(httpClient))...,
+		)
+	}
+
+	lastBlobRequest := func() *http.Request {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(blobRequests) == 0 {
+			return nil
+		}
+		return blobRequests[len(blobRequests)-1]
+	}
+
+	It("requires credentials", func() {
+		_, err := newStore("")
+		Expect(err).To(MatchError("an account key, a SAS token or a service principal is required"))
+	})
+
+	It("rejects more than one kind of credential", func() {
+		_, err := newStore("c29tZS1rZXk=", blobstore.WithAzBlobSASToken("sv=2018-03-28&sig=abc"))
+		Expect(err).To(MatchError("only one of an account key, a SAS token or a service principal can be given"))
+	})
+
+	Context("with a SAS token", func() {
+		It("adds the token to every request", func() {
+			store, err := newStore("", blobstore.WithAzBlobSASToken("?sv=2018-03-28&sr=c&sig=some-signature"))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = store.NewBucketIterator("cc-droplets")
+			Expect(err).NotTo(HaveOccurred())
+
+			request := lastBlobRequest()
+			Expect(request).NotTo(BeNil())
+			Expect(request.Host).To(Equal("someaccount.blob.core.windows.net"))
+			Expect(request.URL.Path).To(Equal("/some-droplets"))
+			Expect(request.URL.Query().Get("sig")).To(Equal("some-signature"))
+			Expect(request.Header.Get("Authorization")).To(BeEmpty())
+		})
+	})
+
+	Context("with a service principal", func() {
+		servicePrincipal := blobstore.AzServicePrincipal{
+			TenantID:     "some-tenant",
+			ClientID:     "some-client-id",
+			ClientSecret: "some-client-secret",
+		}
+
+		It("requests a token with the client credentials", func() {
+			_, err := newStore("", blobstore.WithAzBlobServicePrincipal(servicePrincipal))
+			Expect(err).NotTo(HaveOccurred())
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(tokenForms).NotTo(BeEmpty())
+			Expect(tokenForms[0]).To(Equal(url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"some-client-id"},
+				"client_secret": {"some-client-secret"},
+				"resource":      {"https://storage.azure.com/"},
+			}))
+		})
+
+		It("sends the token and refreshes it before it expires", func() {
+			store, err := newStore("", blobstore.WithAzBlobServicePrincipal(servicePrincipal))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = store.NewBucketIterator("cc-droplets")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lastBlobRequest().Header.Get("Authorization")).To(Equal("Bearer token-1"))
+
+			Eventually(func() string {
+				_, err := store.NewBucketIterator("cc-droplets")
+				Expect(err).NotTo(HaveOccurred())
+				return lastBlobRequest().Header.Get("Authorization")
+			}, 5).Should(Equal("Bearer token-2"))
+		})
+
+		It("returns an error when the token cannot be issued", func() {
+			wrongSecret := servicePrincipal
+			wrongSecret.ClientSecret = "wrong-secret"
+			_, err := newStore("", blobstore.WithAzBlobServicePrincipal(wrongSecret))
+			Expect(err).To(MatchError("error requesting token: invalid_client: bad secret"))
+		})
+	})
+})
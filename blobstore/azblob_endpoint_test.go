@@ -0,0 +1,93 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Azure endpoints", func() {
+	var (
+		server   *httptest.Server
+		requests chan *http.Request
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newStore := func(cloudName string, opts ...blobstore.AzBlobOption) (blobstore.Blobstore, error) {
+		return blobstore.NewAzBlobStore(
+			"someaccount", "c29tZS1rZXk=", cloudName,
+			"some-buildpacks", "some-droplets", "some-packages", "some-resources",
+			opts...,
+		)
+	}
+
+	It("rejects unknown cloud names", func() {
+		_, err := newStore("AzureMoon")
+		Expect(err).To(MatchError(`unknown cloud name "AzureMoon", expected one of AzureChinaCloud, AzureCloud, AzureGermanCloud, AzureUSGovernment`))
+	})
+
+	It("rejects endpoints that are not http or https URLs", func() {
+		_, err := newStore("AzureCloud", blobstore.WithAzBlobEndpoint("127.0.0.1:10000"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("sends requests to the given endpoint", func() {
+		store, err := newStore("", blobstore.WithAzBlobEndpoint(server.URL+"/devstoreaccount1"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.NewBucketIterator("cc-droplets")
+		Expect(err).To(MatchError("bucket does not exist"))
+
+		var request *http.Request
+		Eventually(requests).Should(Receive(&request))
+		Expect(request.URL.Path).To(Equal("/devstoreaccount1/some-droplets"))
+	})
+
+	It("builds the endpoint from the given suffix", func() {
+		target, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		store, err := newStore("",
+			blobstore.WithAzBlobEndpointSuffix("local.azurestack.external"),
+			blobstore.WithAzBlobHTTPClient(&http.Client{Transport: redirectTransport{target: target}}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.NewBucketIterator("cc-droplets")
+		Expect(err).To(MatchError("bucket does not exist"))
+
+		var request *http.Request
+		Eventually(requests).Should(Receive(&request))
+		Expect(request.Host).To(Equal("someaccount.blob.local.azurestack.external"))
+	})
+})
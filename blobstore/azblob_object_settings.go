@@ -0,0 +1,132 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/2018-03-28/azblob"
+)
+
+// azblobChecksumKey is the metadata key the source checksum is stored under.
+// Azure returns metadata keys in lower case.
+const azblobChecksumKey = "checksum"
+
+var azblobMetadataKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// AzBlobObjectSettings describes the access tier and metadata given to blobs
+// written to Azure blob storage
+type AzBlobObjectSettings struct {
+	// AccessTier applies to containers without an entry in AccessTiers;
+	// empty leaves the account's default
+	AccessTier string
+	// AccessTiers maps a Cloud Controller bucket, e.g. cc-droplets, to the
+	// access tier of its blobs: Hot, Cool or Archive
+	AccessTiers map[string]string
+
+	// Metadata is written to every blob alongside the checksum
+	Metadata map[string]string
+}
+
+// WithAzBlobObjectSettings sets the access tier and metadata of every blob
+// written to the store
+func WithAzBlobObjectSettings(settings AzBlobObjectSettings) AzBlobOption {
+	return func(s *azblobStore) {
+		s.objectSettings = settings
+	}
+}
+
+// Validate checks the buckets and tiers are known and the metadata keys are
+// valid
+func (o AzBlobObjectSettings) Validate() error {
+	for container, tier := range o.AccessTiers {
+		if !isBucket(container) {
+			return fmt.Errorf("unknown bucket %q, expected one of %s", container, strings.Join(containers, ", "))
+		}
+		if _, err := accessTier(tier); err != nil {
+			return err
+		}
+	}
+	if _, err := accessTier(o.AccessTier); err != nil {
+		return err
+	}
+
+	for key := range o.Metadata {
+		if !azblobMetadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q: keys must be letters, digits and underscores", key)
+		}
+		if strings.ToLower(key) == azblobChecksumKey {
+			return fmt.Errorf("metadata key %q is reserved for the blob checksum", key)
+		}
+	}
+	return nil
+}
+
+func accessTier(tier string) (azblob.AccessTierType, error) {
+	switch strings.ToLower(tier) {
+	case "":
+		return azblob.AccessTierNone, nil
+	case "hot":
+		return azblob.AccessTierHot, nil
+	case "cool":
+		return azblob.AccessTierCool, nil
+	case "archive":
+		return azblob.AccessTierArchive, nil
+	}
+	return azblob.AccessTierNone, fmt.Errorf("unknown access tier %q, expected Hot, Cool or Archive", tier)
+}
+
+func (o AzBlobObjectSettings) accessTier(container string) azblob.AccessTierType {
+	tier, ok := o.AccessTiers[container]
+	if !ok || tier == "" {
+		tier = o.AccessTier
+	}
+	accessTier, _ := accessTier(tier)
+	return accessTier
+}
+
+func (o AzBlobObjectSettings) metadata(checksum string) azblob.Metadata {
+	metadata := azblob.Metadata{}
+	for key, value := range o.Metadata {
+		metadata[key] = value
+	}
+	if checksum != "" {
+		metadata[azblobChecksumKey] = checksum
+	}
+	return metadata
+}
+
+// checksumFromBlobItem prefers the checksum written by goblob, falling back
+// to the Content-MD5 Azure keeps for blobs uploaded in a single request
+func checksumFromBlobItem(blobInfo azblob.BlobItem) string {
+	for key, value := range blobInfo.Metadata {
+		if strings.ToLower(key) == azblobChecksumKey {
+			return value
+		}
+	}
+
+	if len(blobInfo.Properties.ContentMD5) == 0 {
+		return ""
+	}
+	md5, err := base64.StdEncoding.DecodeString(string(blobInfo.Properties.ContentMD5))
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(md5)
+}
@@ -0,0 +1,176 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AzBlobObjectSettings", func() {
+	Describe("Validate", func() {
+		It("accepts no settings", func() {
+			Expect(blobstore.AzBlobObjectSettings{}.Validate()).To(Succeed())
+		})
+
+		It("accepts tiers in any case", func() {
+			settings := blobstore.AzBlobObjectSettings{
+				AccessTier:  "cool",
+				AccessTiers: map[string]string{"cc-droplets": "Archive"},
+			}
+			Expect(settings.Validate()).To(Succeed())
+		})
+
+		It("rejects unknown tiers", func() {
+			settings := blobstore.AzBlobObjectSettings{AccessTier: "Cold"}
+			Expect(settings.Validate()).To(MatchError(`unknown access tier "Cold", expected Hot, Cool or Archive`))
+		})
+
+		It("rejects unknown buckets", func() {
+			settings := blobstore.AzBlobObjectSettings{AccessTiers: map[string]string{"droplets": "Cool"}}
+			Expect(settings.Validate()).To(MatchError(ContainSubstring(`unknown bucket "droplets"`)))
+		})
+
+		It("rejects invalid metadata keys", func() {
+			settings := blobstore.AzBlobObjectSettings{Metadata: map[string]string{"cost-center": "42"}}
+			Expect(settings.Validate()).To(MatchError(ContainSubstring(`invalid metadata key "cost-center"`)))
+		})
+
+		It("reserves the checksum key", func() {
+			settings := blobstore.AzBlobObjectSettings{Metadata: map[string]string{"Checksum": "abc"}}
+			Expect(settings.Validate()).To(MatchError(`metadata key "Checksum" is reserved for the blob checksum`))
+		})
+	})
+
+	Describe("with a blob service", func() {
+		var (
+			server   *httptest.Server
+			mutex    sync.Mutex
+			tiers    []string
+			commit   http.Header
+			includes []string
+		)
+
+		BeforeEach(func() {
+			tiers = nil
+			commit = nil
+			includes = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				switch r.URL.Query().Get("comp") {
+				case "block":
+					w.WriteHeader(http.StatusCreated)
+				case "blocklist":
+					commit = r.Header
+					w.WriteHeader(http.StatusCreated)
+				case "tier":
+					tiers = append(tiers, r.Header.Get("x-ms-access-tier"))
+				case "list":
+					includes = append(includes, r.URL.Query().Get("include"))
+					fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults>
+  <Blobs>
+    <Blob>
+      <Name>ab/cd/with-metadata</Name>
+      <Properties><Content-Length>7</Content-Length></Properties>
+      <Metadata><checksum>some-checksum</checksum></Metadata>
+    </Blob>
+    <Blob>
+      <Name>ab/cd/with-content-md5</Name>
+      <Properties><Content-Length>7</Content-Length><Content-MD5>CY9rzUYh03PK3k6DJie09g==</Content-MD5></Properties>
+    </Blob>
+    <Blob>
+      <Name>ab/cd/without-checksum</Name>
+      <Properties><Content-Length>7</Content-Length><Content-MD5></Content-MD5></Properties>
+    </Blob>
+  </Blobs>
+  <NextMarker />
+</EnumerationResults>`)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		newStore := func(settings blobstore.AzBlobObjectSettings) blobstore.Blobstore {
+			store, err := blobstore.NewAzBlobStore(
+				"devstoreaccount1", "c29tZS1rZXk=", "AzureCloud",
+				"some-buildpacks", "some-droplets", "some-packages", "some-resources",
+				blobstore.WithAzBlobEndpoint(server.URL+"/devstoreaccount1"),
+				blobstore.WithAzBlobObjectSettings(settings),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			return store
+		}
+
+		It("writes the checksum and metadata and sets the container's tier", func() {
+			store := newStore(blobstore.AzBlobObjectSettings{
+				AccessTier:  "Hot",
+				AccessTiers: map[string]string{"cc-droplets": "Cool"},
+				Metadata:    map[string]string{"foundation": "some-foundation"},
+			})
+
+			blob := &blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet", Checksum: "9a0364b9e99bb480dd25e1f0284c8555"}
+			Expect(store.Write(blob, strings.NewReader("content"))).To(Succeed())
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(commit.Get("x-ms-meta-checksum")).To(Equal("9a0364b9e99bb480dd25e1f0284c8555"))
+			Expect(commit.Get("x-ms-meta-foundation")).To(Equal("some-foundation"))
+			Expect(tiers).To(Equal([]string{"Cool"}))
+		})
+
+		It("refuses to archive content that does not match the checksum", func() {
+			store := newStore(blobstore.AzBlobObjectSettings{AccessTier: "Archive"})
+
+			blob := &blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet", Checksum: "some-other-checksum"}
+			err := store.Write(blob, strings.NewReader("content"))
+			Expect(err).To(MatchError("uploaded checksum [9a0364b9e99bb480dd25e1f0284c8555] does not match [some-other-checksum]"))
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(tiers).To(BeEmpty())
+		})
+
+		It("lists checksums from metadata, falling back to Content-MD5", func() {
+			store := newStore(blobstore.AzBlobObjectSettings{})
+
+			blobs, err := store.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blobs).To(ContainElement(&blobstore.Blob{Path: "cc-droplets/ab/cd/with-metadata", Checksum: "some-checksum", Size: 7}))
+			Expect(blobs).To(ContainElement(&blobstore.Blob{Path: "cc-droplets/ab/cd/with-content-md5", Checksum: "098f6bcd4621d373cade4e832627b4f6", Size: 7}))
+			Expect(blobs).To(ContainElement(&blobstore.Blob{Path: "cc-droplets/ab/cd/without-checksum", Checksum: "", Size: 7}))
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(includes).NotTo(BeEmpty())
+			for _, include := range includes {
+				Expect(include).To(Equal("metadata"))
+			}
+		})
+	})
+})
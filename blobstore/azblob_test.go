@@ -24,20 +24,41 @@ var _ = Describe("azblobStore", func() {
 		}
 	)
 
+	// The tests run against the Azurite emulator unless a storage account
+	// is given
 	accountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
 	accountKey := os.Getenv("AZURE_STORAGE_ACCOUNT_KEY")
+	endpoint := os.Getenv("AZURE_STORAGE_ENDPOINT")
+	if accountName == "" {
+		accountName = "devstoreaccount1"
+		accountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+		if os.Getenv("AZURITE_PORT_10000_TCP_ADDR") == "" {
+			endpoint = "http://127.0.0.1:10000/devstoreaccount1"
+		} else {
+			endpoint = fmt.Sprintf("http://%s:10000/devstoreaccount1", os.Getenv("AZURITE_PORT_10000_TCP_ADDR"))
+		}
+	}
 	cloudName := os.Getenv("AZURE_CLOUD")
 	if os.Getenv("AZURE_CLOUD") == "" {
 		cloudName = "AzureCloud"
 	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.%s", accountName, cloudStorageEnpointsMap[cloudName])
+	}
 	controlContainer := "some-buildpacks"
 
-	blobStore := blobstore.NewAzBlobStore(accountName, accountKey, cloudName, "some-buildpacks", "some-droplets", "some-packages", "some-resources")
+	var blobStore blobstore.Blobstore
+
+	BeforeEach(func() {
+		var err error
+		blobStore, err = blobstore.NewAzBlobStore(accountName, accountKey, cloudName, "some-buildpacks", "some-droplets", "some-packages", "some-resources", blobstore.WithAzBlobEndpoint(endpoint))
+		Expect(err).NotTo(HaveOccurred())
+	})
 
-	credential := azblob.NewSharedKeyCredential(accountName, accountKey)
+	credential, _ := azblob.NewSharedKeyCredential(accountName, accountKey)
 	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
-	primaryURL, _ := url.Parse(
-		fmt.Sprintf("https://%s.blob.%s", accountName, cloudStorageEnpointsMap[cloudName]))
+	primaryURL, _ := url.Parse(endpoint)
 	serviceURL := azblob.NewServiceURL(*primaryURL, pipeline)
 
 	AfterSuite(func() {
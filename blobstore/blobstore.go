@@ -14,12 +14,24 @@
 
 package blobstore
 
-import "io"
+import (
+	"errors"
+	"io"
+	"time"
+)
 
-// Blob is a file in a blob store
+// ErrBlobChanged is returned when a blob's size or modification time
+// changes between checksumming it and reading it, so the content read may be
+// torn. Checksumming the blob again and retrying is safe.
+var ErrBlobChanged = errors.New("blob changed while it was being migrated")
+
+// Blob is a file in a blob store. ModTime is set by bucket iterators and is
+// zero when the blobstore does not report it.
 type Blob struct {
 	Checksum string
 	Path     string
+	Size     int64
+	ModTime  time.Time
 }
 
 //go:generate counterfeiter . Blobstore
@@ -0,0 +1,95 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file was generated by counterfeiter
+package blobstorefakes
+
+import (
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+type FakeBucketPreparer struct {
+	PrepareBucketsStub        func(buckets []string) error
+	prepareBucketsMutex       sync.RWMutex
+	prepareBucketsArgsForCall []struct {
+		buckets []string
+	}
+	prepareBucketsReturns struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeBucketPreparer) PrepareBuckets(buckets []string) error {
+	var bucketsCopy []string
+	if buckets != nil {
+		bucketsCopy = make([]string, len(buckets))
+		copy(bucketsCopy, buckets)
+	}
+	fake.prepareBucketsMutex.Lock()
+	fake.prepareBucketsArgsForCall = append(fake.prepareBucketsArgsForCall, struct {
+		buckets []string
+	}{bucketsCopy})
+	fake.recordInvocation("PrepareBuckets", []interface{}{bucketsCopy})
+	fake.prepareBucketsMutex.Unlock()
+	if fake.PrepareBucketsStub != nil {
+		return fake.PrepareBucketsStub(buckets)
+	} else {
+		return fake.prepareBucketsReturns.result1
+	}
+}
+
+func (fake *FakeBucketPreparer) PrepareBucketsCallCount() int {
+	fake.prepareBucketsMutex.RLock()
+	defer fake.prepareBucketsMutex.RUnlock()
+	return len(fake.prepareBucketsArgsForCall)
+}
+
+func (fake *FakeBucketPreparer) PrepareBucketsArgsForCall(i int) []string {
+	fake.prepareBucketsMutex.RLock()
+	defer fake.prepareBucketsMutex.RUnlock()
+	return fake.prepareBucketsArgsForCall[i].buckets
+}
+
+func (fake *FakeBucketPreparer) PrepareBucketsReturns(result1 error) {
+	fake.PrepareBucketsStub = nil
+	fake.prepareBucketsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBucketPreparer) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.prepareBucketsMutex.RLock()
+	defer fake.prepareBucketsMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeBucketPreparer) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ blobstore.BucketPreparer = new(FakeBucketPreparer)
@@ -0,0 +1,90 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file was generated by counterfeiter
+package blobstorefakes
+
+import (
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+type FakeChangeDetector struct {
+	ChangedStub        func(blob *blobstore.Blob) bool
+	changedMutex       sync.RWMutex
+	changedArgsForCall []struct {
+		blob *blobstore.Blob
+	}
+	changedReturns struct {
+		result1 bool
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeChangeDetector) Changed(blob *blobstore.Blob) bool {
+	fake.changedMutex.Lock()
+	fake.changedArgsForCall = append(fake.changedArgsForCall, struct {
+		blob *blobstore.Blob
+	}{blob})
+	fake.recordInvocation("Changed", []interface{}{blob})
+	fake.changedMutex.Unlock()
+	if fake.ChangedStub != nil {
+		return fake.ChangedStub(blob)
+	} else {
+		return fake.changedReturns.result1
+	}
+}
+
+func (fake *FakeChangeDetector) ChangedCallCount() int {
+	fake.changedMutex.RLock()
+	defer fake.changedMutex.RUnlock()
+	return len(fake.changedArgsForCall)
+}
+
+func (fake *FakeChangeDetector) ChangedArgsForCall(i int) *blobstore.Blob {
+	fake.changedMutex.RLock()
+	defer fake.changedMutex.RUnlock()
+	return fake.changedArgsForCall[i].blob
+}
+
+func (fake *FakeChangeDetector) ChangedReturns(result1 bool) {
+	fake.ChangedStub = nil
+	fake.changedReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeChangeDetector) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.changedMutex.RLock()
+	defer fake.changedMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeChangeDetector) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ blobstore.ChangeDetector = new(FakeChangeDetector)
@@ -0,0 +1,180 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file was generated by counterfeiter
+package blobstorefakes
+
+import (
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+type FakeServerSideCopier struct {
+	CanCopyFromStub        func(src blobstore.Blobstore) bool
+	canCopyFromMutex       sync.RWMutex
+	canCopyFromArgsForCall []struct {
+		src blobstore.Blobstore
+	}
+	canCopyFromReturns struct {
+		result1 bool
+	}
+	CopyFromStub        func(src blobstore.Blobstore, blob *blobstore.Blob) error
+	copyFromMutex       sync.RWMutex
+	copyFromArgsForCall []struct {
+		src  blobstore.Blobstore
+		blob *blobstore.Blob
+	}
+	copyFromReturns struct {
+		result1 error
+	}
+	CopiedChecksumStub        func(blob *blobstore.Blob) (string, error)
+	copiedChecksumMutex       sync.RWMutex
+	copiedChecksumArgsForCall []struct {
+		blob *blobstore.Blob
+	}
+	copiedChecksumReturns struct {
+		result1 string
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeServerSideCopier) CanCopyFrom(src blobstore.Blobstore) bool {
+	fake.canCopyFromMutex.Lock()
+	fake.canCopyFromArgsForCall = append(fake.canCopyFromArgsForCall, struct {
+		src blobstore.Blobstore
+	}{src})
+	fake.recordInvocation("CanCopyFrom", []interface{}{src})
+	fake.canCopyFromMutex.Unlock()
+	if fake.CanCopyFromStub != nil {
+		return fake.CanCopyFromStub(src)
+	} else {
+		return fake.canCopyFromReturns.result1
+	}
+}
+
+func (fake *FakeServerSideCopier) CanCopyFromCallCount() int {
+	fake.canCopyFromMutex.RLock()
+	defer fake.canCopyFromMutex.RUnlock()
+	return len(fake.canCopyFromArgsForCall)
+}
+
+func (fake *FakeServerSideCopier) CanCopyFromArgsForCall(i int) blobstore.Blobstore {
+	fake.canCopyFromMutex.RLock()
+	defer fake.canCopyFromMutex.RUnlock()
+	return fake.canCopyFromArgsForCall[i].src
+}
+
+func (fake *FakeServerSideCopier) CanCopyFromReturns(result1 bool) {
+	fake.CanCopyFromStub = nil
+	fake.canCopyFromReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeServerSideCopier) CopyFrom(src blobstore.Blobstore, blob *blobstore.Blob) error {
+	fake.copyFromMutex.Lock()
+	fake.copyFromArgsForCall = append(fake.copyFromArgsForCall, struct {
+		src  blobstore.Blobstore
+		blob *blobstore.Blob
+	}{src, blob})
+	fake.recordInvocation("CopyFrom", []interface{}{src, blob})
+	fake.copyFromMutex.Unlock()
+	if fake.CopyFromStub != nil {
+		return fake.CopyFromStub(src, blob)
+	} else {
+		return fake.copyFromReturns.result1
+	}
+}
+
+func (fake *FakeServerSideCopier) CopyFromCallCount() int {
+	fake.copyFromMutex.RLock()
+	defer fake.copyFromMutex.RUnlock()
+	return len(fake.copyFromArgsForCall)
+}
+
+func (fake *FakeServerSideCopier) CopyFromArgsForCall(i int) (blobstore.Blobstore, *blobstore.Blob) {
+	fake.copyFromMutex.RLock()
+	defer fake.copyFromMutex.RUnlock()
+	return fake.copyFromArgsForCall[i].src, fake.copyFromArgsForCall[i].blob
+}
+
+func (fake *FakeServerSideCopier) CopyFromReturns(result1 error) {
+	fake.CopyFromStub = nil
+	fake.copyFromReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeServerSideCopier) CopiedChecksum(blob *blobstore.Blob) (string, error) {
+	fake.copiedChecksumMutex.Lock()
+	fake.copiedChecksumArgsForCall = append(fake.copiedChecksumArgsForCall, struct {
+		blob *blobstore.Blob
+	}{blob})
+	fake.recordInvocation("CopiedChecksum", []interface{}{blob})
+	fake.copiedChecksumMutex.Unlock()
+	if fake.CopiedChecksumStub != nil {
+		return fake.CopiedChecksumStub(blob)
+	} else {
+		return fake.copiedChecksumReturns.result1, fake.copiedChecksumReturns.result2
+	}
+}
+
+func (fake *FakeServerSideCopier) CopiedChecksumCallCount() int {
+	fake.copiedChecksumMutex.RLock()
+	defer fake.copiedChecksumMutex.RUnlock()
+	return len(fake.copiedChecksumArgsForCall)
+}
+
+func (fake *FakeServerSideCopier) CopiedChecksumArgsForCall(i int) *blobstore.Blob {
+	fake.copiedChecksumMutex.RLock()
+	defer fake.copiedChecksumMutex.RUnlock()
+	return fake.copiedChecksumArgsForCall[i].blob
+}
+
+func (fake *FakeServerSideCopier) CopiedChecksumReturns(result1 string, result2 error) {
+	fake.CopiedChecksumStub = nil
+	fake.copiedChecksumReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeServerSideCopier) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.canCopyFromMutex.RLock()
+	defer fake.canCopyFromMutex.RUnlock()
+	fake.copyFromMutex.RLock()
+	defer fake.copyFromMutex.RUnlock()
+	fake.copiedChecksumMutex.RLock()
+	defer fake.copiedChecksumMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeServerSideCopier) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ blobstore.ServerSideCopier = new(FakeServerSideCopier)
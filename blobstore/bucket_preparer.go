@@ -0,0 +1,25 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+//go:generate counterfeiter . BucketPreparer
+
+// BucketPreparer is implemented by blobstores that check or create their
+// buckets before any blob is written to them
+type BucketPreparer interface {
+	// PrepareBuckets makes sure the given buckets can be written to,
+	// returning a single error naming every bucket that cannot
+	PrepareBuckets(buckets []string) error
+}
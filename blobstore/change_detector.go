@@ -0,0 +1,25 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+//go:generate counterfeiter . ChangeDetector
+
+// ChangeDetector is implemented by blobstores whose blobs can change while
+// they are being migrated
+type ChangeDetector interface {
+	// Changed reports whether blob no longer matches the size and
+	// modification time recorded when it was checksummed
+	Changed(blob *Blob) bool
+}
@@ -0,0 +1,211 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// HTTPClientConfig configures TLS and proxy settings for the connections made
+// to a blobstore endpoint
+type HTTPClientConfig struct {
+	InsecureSkipVerify bool
+
+	// CACertFile is a PEM bundle of CA certificates trusted in addition to
+	// the system pool
+	CACertFile string
+
+	// ClientCertFile and ClientKeyFile are a PEM certificate and key
+	// presented to endpoints that require mutual TLS
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// ProxyURL is used instead of HTTP_PROXY and HTTPS_PROXY when given;
+	// hosts matched by NO_PROXY are connected to directly either way
+	ProxyURL      string
+	ProxyUsername string
+	ProxyPassword string
+
+	// MaxConnections caps the requests in flight across every blob being
+	// migrated; zero means no limit
+	MaxConnections int
+
+	// Limiter throttles the bodies of requests as they are sent, so that
+	// each byte uploaded is counted once however often the uploader reads
+	// the body beforehand, e.g. to sign it
+	Limiter *bandwidth.Limiter
+}
+
+// NewHTTPClient creates an HTTP client for talking to a blobstore endpoint
+func NewHTTPClient(config HTTPClientConfig) (*http.Client, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := config.proxy()
+	if err != nil {
+		return nil, err
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:               proxy,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: config.MaxConnections,
+	}
+	if config.Limiter != nil {
+		transport = &throttledTransport{transport: transport, limiter: config.Limiter}
+	}
+	if config.MaxConnections <= 0 {
+		return &http.Client{Transport: transport}, nil
+	}
+
+	return &http.Client{
+		Transport: &limitedTransport{
+			transport: transport,
+			slots:     make(chan struct{}, config.MaxConnections),
+		},
+	}, nil
+}
+
+// limitedTransport holds a slot for each request from when it is sent until
+// its response body is closed
+type limitedTransport struct {
+	transport http.RoundTripper
+	slots     chan struct{}
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		<-t.slots
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-t.slots }}
+	return resp, nil
+}
+
+// throttledTransport throttles request bodies through a limiter shared by
+// every request
+type throttledTransport struct {
+	transport http.RoundTripper
+	limiter   *bandwidth.Limiter
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return t.transport.RoundTrip(req)
+	}
+
+	throttled := *req
+	throttled.Body = bandwidth.NewReadCloser(req.Body, t.limiter)
+	return t.transport.RoundTrip(&throttled)
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func (c HTTPClientConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CACertFile != "" {
+		pem, err := ioutil.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificates: %s", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCertFile != "" || c.ClientKeyFile != "" {
+		if c.ClientCertFile == "" || c.ClientKeyFile == "" {
+			return nil, errors.New("a client certificate and a client key must be given together")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func (c HTTPClientConfig) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if c.ProxyURL == "" {
+		if c.ProxyUsername != "" || c.ProxyPassword != "" {
+			return nil, errors.New("proxy credentials given without a proxy URL")
+		}
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyURL, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %s", err)
+	}
+	if proxyURL.Scheme == "" || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: a scheme and host are required", c.ProxyURL)
+	}
+
+	if c.ProxyUsername != "" {
+		proxyURL.User = url.UserPassword(c.ProxyUsername, c.ProxyPassword)
+	}
+
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    httpproxy.FromEnvironment().NoProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
@@ -0,0 +1,325 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewHTTPClient", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "http-client-test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+		Expect(err).NotTo(HaveOccurred())
+		return path
+	}
+
+	Context("when the server uses a certificate from a private CA", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("fails without the CA", func() {
+			client, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Get(server.URL)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("trusts the CA bundle", func() {
+			caFile := writePEM("ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+			client, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{CACertFile: caFile})
+			Expect(err).NotTo(HaveOccurred())
+
+			response, err := client.Get(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+		})
+
+		It("returns an error when the bundle has no certificates", func() {
+			caFile := filepath.Join(dir, "empty.pem")
+			Expect(ioutil.WriteFile(caFile, []byte("not a certificate"), 0600)).To(Succeed())
+
+			_, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{CACertFile: caFile})
+			Expect(err).To(MatchError("no certificates found in " + caFile))
+		})
+	})
+
+	Context("when the server requires a client certificate", func() {
+		var (
+			server   *httptest.Server
+			certFile string
+			keyFile  string
+		)
+
+		BeforeEach(func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      pkix.Name{CommonName: "goblob"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+			Expect(err).NotTo(HaveOccurred())
+			certificate, err := x509.ParseCertificate(der)
+			Expect(err).NotTo(HaveOccurred())
+
+			keyDER, err := x509.MarshalECPrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+
+			certFile = writePEM("client.pem", "CERTIFICATE", der)
+			keyFile = writePEM("client-key.pem", "EC PRIVATE KEY", keyDER)
+
+			clientCAs := x509.NewCertPool()
+			clientCAs.AddCert(certificate)
+
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{
+				ClientAuth: tls.RequireAndVerifyClientCert,
+				ClientCAs:  clientCAs,
+			}
+			server.StartTLS()
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("presents the client certificate", func() {
+			client, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{
+				CACertFile:     writePEM("ca.pem", "CERTIFICATE", server.Certificate().Raw),
+				ClientCertFile: certFile,
+				ClientKeyFile:  keyFile,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			response, err := client.Get(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+		})
+
+		It("requires the certificate and key together", func() {
+			_, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{ClientCertFile: certFile})
+			Expect(err).To(MatchError("a client certificate and a client key must be given together"))
+		})
+	})
+
+	Context("when a connection budget is given", func() {
+		var (
+			server  *httptest.Server
+			mutex   sync.Mutex
+			current int
+			peak    int
+		)
+
+		BeforeEach(func() {
+			current, peak = 0, 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				current++
+				if current > peak {
+					peak = current
+				}
+				mutex.Unlock()
+
+				time.Sleep(20 * time.Millisecond)
+
+				mutex.Lock()
+				current--
+				mutex.Unlock()
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("never has more requests in flight than the budget", func() {
+			client, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{MaxConnections: 2})
+			Expect(err).NotTo(HaveOccurred())
+
+			wg := sync.WaitGroup{}
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					response, err := client.Get(server.URL)
+					Expect(err).NotTo(HaveOccurred())
+					response.Body.Close()
+				}()
+			}
+			wg.Wait()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(peak).To(Equal(2))
+		})
+	})
+
+	Context("when a bandwidth limiter is given", func() {
+		var (
+			server *httptest.Server
+			bodies chan []byte
+		)
+
+		BeforeEach(func() {
+			bodies = make(chan []byte, 1)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				bodies <- body
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("throttles the request body as it is sent", func() {
+			client, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{Limiter: bandwidth.NewLimiter(100000)})
+			Expect(err).NotTo(HaveOccurred())
+
+			content := strings.Repeat("x", 50000)
+			start := time.Now()
+			response, err := client.Post(server.URL, "text/plain", strings.NewReader(content))
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+
+			Expect(time.Since(start)).To(BeNumerically(">=", 400*time.Millisecond))
+			Eventually(bodies).Should(Receive(Equal([]byte(content))))
+		})
+	})
+
+	Context("when a proxy is given", func() {
+		var (
+			proxy    *httptest.Server
+			requests chan *http.Request
+		)
+
+		BeforeEach(func() {
+			requests = make(chan *http.Request, 1)
+			proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests <- r
+			}))
+		})
+
+		AfterEach(func() {
+			proxy.Close()
+		})
+
+		It("sends requests through the proxy with its credentials", func() {
+			client, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{
+				ProxyURL:      proxy.URL,
+				ProxyUsername: "some-user",
+				ProxyPassword: "some-password",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			response, err := client.Get("http://blobstore.example.com/some-bucket")
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+
+			var request *http.Request
+			Eventually(requests).Should(Receive(&request))
+			Expect(request.Host).To(Equal("blobstore.example.com"))
+			credentials := base64.StdEncoding.EncodeToString([]byte("some-user:some-password"))
+			Expect(request.Header.Get("Proxy-Authorization")).To(Equal("Basic " + credentials))
+		})
+
+		It("connects directly to hosts in NO_PROXY", func() {
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer backend.Close()
+			backendURL, err := url.Parse(backend.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			noProxy, set := os.LookupEnv("NO_PROXY")
+			os.Setenv("NO_PROXY", "blobstore.example.com")
+			defer func() {
+				if set {
+					os.Setenv("NO_PROXY", noProxy)
+				} else {
+					os.Unsetenv("NO_PROXY")
+				}
+			}()
+
+			client, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{ProxyURL: proxy.URL})
+			Expect(err).NotTo(HaveOccurred())
+			client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, backendURL.Host)
+			}
+
+			response, err := client.Get("http://blobstore.example.com/some-bucket")
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+
+			Consistently(requests).ShouldNot(Receive())
+		})
+
+		It("rejects a proxy URL without a scheme", func() {
+			_, err := blobstore.NewHTTPClient(blobstore.HTTPClientConfig{ProxyURL: "proxy.example.com"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -15,29 +15,67 @@
 package blobstore
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/cheggaaa/pb"
+	"github.com/pivotal-cf/goblob/bandwidth"
+	"github.com/pivotal-cf/goblob/logging"
 	"github.com/pivotal-cf/goblob/validation"
 	"golang.org/x/sync/errgroup"
 )
 
+// DefaultNFSChecksumConcurrency is how many files List checksums at once
+const DefaultNFSChecksumConcurrency = 8
+
 type nfsStore struct {
-	path string
+	path                string
+	limiter             *bandwidth.Limiter
+	checksumConcurrency int
+	ignore              []string
+	settleTime          time.Duration
+	symlinkPolicy       NFSSymlinkPolicy
+	warn                func(NFSWarning)
+}
+
+// NFSOption configures optional behaviour of an NFS blobstore
+type NFSOption func(*nfsStore)
+
+// WithNFSBandwidthLimiter throttles the reads made to checksum blobs through
+// limiter. Blobs read to be uploaded are throttled as they are sent, by the
+// destination's HTTP client (see HTTPClientConfig.Limiter).
+func WithNFSBandwidthLimiter(limiter *bandwidth.Limiter) NFSOption {
+	return func(s *nfsStore) {
+		s.limiter = limiter
+	}
+}
+
+// WithNFSChecksumConcurrency sets how many files List checksums at once
+func WithNFSChecksumConcurrency(concurrency int) NFSOption {
+	return func(s *nfsStore) {
+		s.checksumConcurrency = concurrency
+	}
 }
 
 // NewNFS creates an NFS blobstore
-func NewNFS(path string) Blobstore {
-	return &nfsStore{
-		path: path,
+func NewNFS(path string, opts ...NFSOption) Blobstore {
+	store := &nfsStore{
+		path:                path,
+		checksumConcurrency: DefaultNFSChecksumConcurrency,
+		ignore:              append([]string{}, DefaultNFSIgnore...),
+		symlinkPolicy:       NFSSymlinksFollow,
+		warn:                logNFSWarning,
+	}
+	for _, opt := range opts {
+		opt(store)
 	}
+	return store
 }
 
 func (s *nfsStore) Name() string {
@@ -48,15 +86,17 @@ func (s *nfsStore) Name() string {
 func (s *nfsStore) List() ([]*Blob, error) {
 	var blobs []*Blob
 	walk := func(path string, info os.FileInfo, e error) error {
-		if !info.IsDir() && info.Name() != ".nfs_test" {
+		if !info.IsDir() && !s.ignored(info.Name()) && s.settled(info) {
 			relPath := path[len(s.path)+1:]
 			blobs = append(blobs, &Blob{
-				Path: relPath,
+				Path:    relPath,
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
 			})
 		}
 		return e
 	}
-	if err := filepath.Walk(s.path, walk); err != nil {
+	if err := s.walk(s.path, walk); err != nil {
 		return nil, err
 	}
 	if err := s.processBlobsForChecksums(blobs); err != nil {
@@ -66,21 +106,39 @@ func (s *nfsStore) List() ([]*Blob, error) {
 }
 
 func (s *nfsStore) processBlobsForChecksums(blobs []*Blob) error {
+	logging.Debug("checksumming blobs", "store", s.Name(), "blobs", len(blobs))
 
-	fmt.Println("Getting list of files from NFS")
-	bar := pb.StartNew(len(blobs))
-	bar.Format("<.- >")
+	// A fixed number of workers take blobs from a channel, so only that many
+	// files are open at once. The first error cancels ctx, which stops the
+	// feeder and aborts the checksums in progress.
+	g, ctx := errgroup.WithContext(context.Background())
 
-	var g errgroup.Group
-	for _, blob := range blobs {
-		blob := blob
+	blobCh := make(chan *Blob)
+	g.Go(func() error {
+		defer close(blobCh)
+		for _, blob := range blobs {
+			select {
+			case blobCh <- blob:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	workers := s.checksumConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
 		g.Go(func() error {
-			checksum, err := s.Checksum(blob)
-			if (err) != nil {
-				return err
+			for blob := range blobCh {
+				checksum, err := s.checksumWithContext(ctx, blob)
+				if err != nil {
+					return err
+				}
+				blob.Checksum = checksum
 			}
-			blob.Checksum = checksum
-			bar.Increment()
 			return nil
 		})
 	}
@@ -88,16 +146,86 @@ func (s *nfsStore) processBlobsForChecksums(blobs []*Blob) error {
 		return err
 	}
 
-	bar.FinishPrint("Done Getting list of files from NFS")
+	logging.Debug("checksummed blobs", "store", s.Name(), "blobs", len(blobs))
 	return nil
 }
 
+// checksumWithContext records the size and modification time of the
+// content it checksummed on src, for Read to check against
+func (s *nfsStore) checksumWithContext(ctx context.Context, src *Blob) (string, error) {
+	filePath := path.Join(s.path, src.Path)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	before, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	checksum, err := validation.ChecksumReader(&contextReader{
+		ctx:    ctx,
+		reader: bandwidth.NewReader(file, s.limiter),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	after, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	if fileChanged(before, after.Size(), after.ModTime()) {
+		return "", ErrBlobChanged
+	}
+
+	src.Size = after.Size()
+	src.ModTime = after.ModTime()
+	return checksum, nil
+}
+
+// contextReader stops reading once its context is cancelled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
 func (s *nfsStore) Checksum(src *Blob) (string, error) {
-	return validation.Checksum(path.Join(s.path, src.Path))
+	return s.checksumWithContext(context.Background(), src)
 }
 
+// Read fails with ErrBlobChanged, either straight away or once the content
+// has been read, if the file's size or modification time no longer match
+// the ones recorded on src
 func (s *nfsStore) Read(src *Blob) (io.ReadCloser, error) {
-	return os.Open(path.Join(s.path, src.Path))
+	filePath := path.Join(s.path, src.Path)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !src.ModTime.IsZero() {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if fileChanged(info, src.Size, src.ModTime) {
+			file.Close()
+			return nil, ErrBlobChanged
+		}
+	}
+
+	return &nfsFile{file: file, path: filePath, blob: src}, nil
 }
 func (s *nfsStore) Write(dst *Blob, src io.Reader) error {
 	return errors.New("writing to the NFS store is not supported")
@@ -134,32 +262,45 @@ func (s *nfsStore) NewBucketIterator(folder string) (BucketIterator, error) {
 		errCh:  errCh,
 	}
 
+	var deferred []string
 	walkFn := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if info.IsDir() || info.Name() == ".nfs_test" {
+		if info.IsDir() || s.ignored(info.Name()) {
+			return nil
+		}
+
+		if !s.settled(info) {
+			deferred = append(deferred, path)
 			return nil
 		}
 
+		blob := &Blob{
+			Path:    strings.TrimPrefix(path, s.path+string(os.PathSeparator)),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+
 		select {
 		case <-doneCh:
-			doneCh = nil
 			return ErrIteratorAborted
-		default:
-			blob := &Blob{
-				Path: strings.TrimPrefix(path, s.path+string(os.PathSeparator)),
-			}
-
-			blobCh <- blob
-
+		case blobCh <- blob:
 			return nil
 		}
 	}
 
 	go func() {
-		errCh <- filepath.Walk(actualPath, walkFn)
+		err := s.walk(actualPath, walkFn)
+		if err == nil {
+			err = s.sendSettled(deferred, blobCh, doneCh)
+		}
+		// nothing reads the error once the iterator is done with
+		select {
+		case errCh <- err:
+		case <-doneCh:
+		}
 		close(blobCh)
 	}()
 
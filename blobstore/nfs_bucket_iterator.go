@@ -41,7 +41,12 @@ func (i *nfsBucketIterator) Next() (*Blob, error) {
 	}
 }
 
+// Done stops the walk of the bucket. It may be called more than once, and
+// on the iterator of an empty bucket.
 func (i *nfsBucketIterator) Done() {
 	i.blobCh = nil
-	close(i.doneCh)
+	if i.doneCh != nil {
+		close(i.doneCh)
+		i.doneCh = nil
+	}
 }
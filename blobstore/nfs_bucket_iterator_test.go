@@ -18,6 +18,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pivotal-cf/goblob/blobstore"
 	. "github.com/onsi/ginkgo"
@@ -61,7 +62,9 @@ var _ = Describe("NFSBucketIterator", func() {
 
 			BeforeEach(func() {
 				expectedBlob = blobstore.Blob{
-					Path: "some-bucket/some-path/some-file",
+					Path:    "some-bucket/some-path/some-file",
+					Size:    7,
+					ModTime: time.Date(2018, 9, 1, 12, 0, 0, 0, time.Local),
 				}
 
 				err := os.MkdirAll(filepath.Join(baseDir, "some-bucket", "some-path"), os.ModePerm)
@@ -74,6 +77,13 @@ var _ = Describe("NFSBucketIterator", func() {
 				)
 				Expect(err).NotTo(HaveOccurred())
 
+				err = os.Chtimes(
+					filepath.Join(baseDir, "some-bucket", "some-path", "some-file"),
+					expectedBlob.ModTime,
+					expectedBlob.ModTime,
+				)
+				Expect(err).NotTo(HaveOccurred())
+
 				iterator, err = store.NewBucketIterator("some-bucket")
 				Expect(err).NotTo(HaveOccurred())
 			})
@@ -129,6 +139,14 @@ var _ = Describe("NFSBucketIterator", func() {
 	})
 
 	Describe("Done", func() {
+		It("can be called on the iterator of an empty bucket", func() {
+			iterator.Done()
+			iterator.Done()
+
+			_, err := iterator.Next()
+			Expect(err).To(Equal(blobstore.ErrIteratorDone))
+		})
+
 		Context("when blobs exist in the bucket", func() {
 			BeforeEach(func() {
 				err := os.MkdirAll(filepath.Join(baseDir, "some-bucket", "some-path"), os.ModePerm)
@@ -159,6 +177,17 @@ var _ = Describe("NFSBucketIterator", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("no more items in iterator"))
 			})
+
+			It("stops the walk part way through the bucket", func() {
+				_, err := iterator.Next()
+				Expect(err).NotTo(HaveOccurred())
+
+				// the walk is blocked sending the second file
+				iterator.Done()
+
+				_, err = iterator.Next()
+				Expect(err).To(Equal(blobstore.ErrIteratorDone))
+			})
 		})
 	})
 })
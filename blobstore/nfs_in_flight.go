@@ -0,0 +1,148 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultNFSIgnore matches files that are never blobs: NFS silly-renamed
+// files, the .nfs_test file and temporary and editor files
+var DefaultNFSIgnore = []string{".nfs*", "*.tmp", "*.part", "*~", ".*.swp"}
+
+// WithNFSIgnore skips files whose names match any of patterns, as well as
+// those matching DefaultNFSIgnore. Patterns use filepath.Match syntax.
+func WithNFSIgnore(patterns []string) NFSOption {
+	return func(s *nfsStore) {
+		s.ignore = append(s.ignore, patterns...)
+	}
+}
+
+// WithNFSSettleTime defers files modified within the last settleTime, since
+// Cloud Controller may still be writing them. Bucket iterators return them
+// once they have settled, after every other file; List skips them.
+func WithNFSSettleTime(settleTime time.Duration) NFSOption {
+	return func(s *nfsStore) {
+		s.settleTime = settleTime
+	}
+}
+
+func (s *nfsStore) ignored(name string) bool {
+	for _, pattern := range s.ignore {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *nfsStore) settled(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) >= s.settleTime
+}
+
+// sendSettled waits for each deferred file to settle and sends it, or skips
+// it if it is still being modified; a later run will migrate it
+func (s *nfsStore) sendSettled(paths []string, blobCh chan<- *Blob, doneCh <-chan struct{}) error {
+	for _, filePath := range paths {
+		info, err := os.Stat(filePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-doneCh:
+			return ErrIteratorAborted
+		case <-time.After(s.settleTime - time.Since(info.ModTime())):
+		}
+
+		settled, err := os.Stat(filePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		relPath := strings.TrimPrefix(filePath, s.path+string(os.PathSeparator))
+		if fileChanged(info, settled.Size(), settled.ModTime()) || !s.settled(settled) {
+			s.warn(NFSWarning{Path: relPath, Reason: "it is still being modified"})
+			continue
+		}
+
+		select {
+		case <-doneCh:
+			return ErrIteratorAborted
+		case blobCh <- &Blob{Path: relPath, Size: settled.Size(), ModTime: settled.ModTime()}:
+		}
+	}
+	return nil
+}
+
+func fileChanged(info os.FileInfo, size int64, modTime time.Time) bool {
+	return info.Size() != size || !info.ModTime().Equal(modTime)
+}
+
+// nfsFile fails the read that reaches the end of the file if the file no
+// longer has the size and modification time recorded on its blob. It does
+// not embed *os.File, whose WriteTo would let io.Copy bypass the check.
+type nfsFile struct {
+	file *os.File
+	path string
+	blob *Blob
+}
+
+func (f *nfsFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	if err == io.EOF && !f.blob.ModTime.IsZero() {
+		info, statErr := os.Stat(f.path)
+		if statErr != nil {
+			return n, statErr
+		}
+		if fileChanged(info, f.blob.Size, f.blob.ModTime) {
+			return n, ErrBlobChanged
+		}
+	}
+	return n, err
+}
+
+func (f *nfsFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *nfsFile) Close() error {
+	return f.file.Close()
+}
+
+// Changed reports whether the file no longer has the size and modification
+// time recorded on blob, or can no longer be found
+func (s *nfsStore) Changed(blob *Blob) bool {
+	if blob.ModTime.IsZero() {
+		return false
+	}
+
+	info, err := os.Stat(path.Join(s.path, blob.Path))
+	if err != nil {
+		return true
+	}
+	return fileChanged(info, blob.Size, blob.ModTime)
+}
@@ -0,0 +1,131 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NFS files being written", func() {
+	var baseDir string
+
+	write := func(name, content string, modTime time.Time) {
+		filePath := filepath.Join(baseDir, "cc-packages", name)
+		Expect(ioutil.WriteFile(filePath, []byte(content), 0644)).To(Succeed())
+		Expect(os.Chtimes(filePath, modTime, modTime)).To(Succeed())
+	}
+
+	paths := func(store blobstore.Blobstore) []string {
+		iterator, err := store.NewBucketIterator("cc-packages")
+		Expect(err).NotTo(HaveOccurred())
+
+		var paths []string
+		for {
+			blob, err := iterator.Next()
+			if err == blobstore.ErrIteratorDone {
+				return paths
+			}
+			Expect(err).NotTo(HaveOccurred())
+			paths = append(paths, blob.Path)
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		baseDir, err = ioutil.TempDir("", "nfs-in-flight")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(baseDir, "cc-packages"), 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(baseDir)
+	})
+
+	It("skips ignored files", func() {
+		old := time.Now().Add(-time.Hour)
+		write("some-package", "content", old)
+		write(".nfs000000000123", "content", old)
+		write("upload.tmp", "content", old)
+		write("some-package.partial", "content", old)
+
+		store := blobstore.NewNFS(baseDir, blobstore.WithNFSIgnore([]string{"*.partial"}))
+		Expect(paths(store)).To(Equal([]string{"cc-packages/some-package"}))
+	})
+
+	It("returns recently modified files last, once they have settled", func() {
+		write("a-recent-package", "content", time.Now())
+		write("an-old-package", "content", time.Now().Add(-time.Hour))
+
+		store := blobstore.NewNFS(baseDir, blobstore.WithNFSSettleTime(200*time.Millisecond))
+		Expect(paths(store)).To(Equal([]string{"cc-packages/an-old-package", "cc-packages/a-recent-package"}))
+	})
+
+	Describe("reading a checksummed blob", func() {
+		var (
+			store blobstore.Blobstore
+			blob  *blobstore.Blob
+		)
+
+		BeforeEach(func() {
+			write("some-package", "content", time.Now().Add(-time.Hour))
+
+			store = blobstore.NewNFS(baseDir)
+			blob = &blobstore.Blob{Path: "cc-packages/some-package"}
+
+			var err error
+			blob.Checksum, err = store.Checksum(blob)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blob.Size).To(BeEquivalentTo(7))
+		})
+
+		It("reads the content when it has not changed", func() {
+			reader, err := store.Read(blob)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			content, err := ioutil.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("content"))
+			Expect(store.(blobstore.ChangeDetector).Changed(blob)).To(BeFalse())
+		})
+
+		It("fails when the file changed before it was read", func() {
+			write("some-package", "new content", time.Now())
+
+			_, err := store.Read(blob)
+			Expect(err).To(Equal(blobstore.ErrBlobChanged))
+			Expect(store.(blobstore.ChangeDetector).Changed(blob)).To(BeTrue())
+		})
+
+		It("fails at the end of the file when it changed while it was read", func() {
+			reader, err := store.Read(blob)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			write("some-package", "content", time.Now())
+
+			_, err = ioutil.ReadAll(reader)
+			Expect(err).To(Equal(blobstore.ErrBlobChanged))
+		})
+	})
+})
@@ -16,7 +16,12 @@ package blobstore_test
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 
+	"github.com/pivotal-cf/goblob/bandwidth"
 	"github.com/pivotal-cf/goblob/blobstore"
 
 	. "github.com/onsi/ginkgo"
@@ -38,6 +43,50 @@ var _ = Describe("NFS", func() {
 			Ω(blobs[0].Path).Should(BeEquivalentTo("cc-buildpacks/ea/07/ea07de9b-dd94-477c-b904-0f77d47dd111_a32d9ae40371d557c7c90eb2affc3d7bba6abe69"))
 		})
 	})
+	Describe("List() with a bounded number of checksum workers", func() {
+		It("checksums every blob", func() {
+			store = blobstore.NewNFS("nfs_testdata", blobstore.WithNFSChecksumConcurrency(1))
+			blobs, err := store.List()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(len(blobs)).Should(BeEquivalentTo(7))
+			for _, blob := range blobs {
+				Ω(blob.Checksum).ShouldNot(BeEmpty())
+			}
+		})
+
+		It("returns the first error", func() {
+			dir, err := ioutil.TempDir("", "nfs")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			Ω(os.MkdirAll(filepath.Join(dir, "cc-droplets"), 0755)).Should(Succeed())
+			for i := 0; i < 10; i++ {
+				Ω(ioutil.WriteFile(filepath.Join(dir, "cc-droplets", fmt.Sprintf("blob-%d", i)), []byte("content"), 0644)).Should(Succeed())
+			}
+			Ω(os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "cc-droplets", "dangling"))).Should(Succeed())
+
+			// the dangling link is skipped with a warning once blob-0 has
+			// been listed, and removing blob-0 then fails its checksum
+			store = blobstore.NewNFS(dir,
+				blobstore.WithNFSChecksumConcurrency(2),
+				blobstore.WithNFSWarningHandler(func(blobstore.NFSWarning) {
+					os.Remove(filepath.Join(dir, "cc-droplets", "blob-0"))
+				}),
+			)
+			_, err = store.List()
+			Ω(err).Should(HaveOccurred())
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+	})
+
+	Describe("with a bandwidth limiter", func() {
+		It("reads the same content", func() {
+			store = blobstore.NewNFS("nfs_testdata", blobstore.WithNFSBandwidthLimiter(bandwidth.NewLimiter(1<<20)))
+			blobs, err := store.List()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(blobs[0].Checksum).Should(BeEquivalentTo("b026324c6904b2a9cb4b88d6d61c81d1"))
+		})
+	})
 	Describe("Read()", func() {
 		It("Given a file it should return a reader", func() {
 			blobs, err := store.List()
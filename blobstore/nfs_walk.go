@@ -0,0 +1,185 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/goblob/logging"
+)
+
+// NFSSymlinkPolicy says what the NFS blobstore does with symbolic links
+type NFSSymlinkPolicy string
+
+const (
+	// NFSSymlinksFollow treats links as the files and directories they
+	// point to. Links to a directory that has already been walked, or to
+	// nothing, are skipped with a warning.
+	NFSSymlinksFollow NFSSymlinkPolicy = "follow"
+	// NFSSymlinksSkip skips links with a warning
+	NFSSymlinksSkip NFSSymlinkPolicy = "skip"
+	// NFSSymlinksError fails the walk at the first link
+	NFSSymlinksError NFSSymlinkPolicy = "error"
+)
+
+// Validate checks the policy is one of the known ones
+func (p NFSSymlinkPolicy) Validate() error {
+	switch p {
+	case NFSSymlinksFollow, NFSSymlinksSkip, NFSSymlinksError:
+		return nil
+	}
+	return fmt.Errorf("unknown symlink policy %q, expected follow, skip or error", string(p))
+}
+
+// NFSWarning is a file the NFS blobstore skipped
+type NFSWarning struct {
+	Path   string
+	Reason string
+}
+
+func (w NFSWarning) String() string {
+	return fmt.Sprintf("Skipping %s: %s", w.Path, w.Reason)
+}
+
+// WithNFSSymlinkPolicy sets what is done with symbolic links
+func WithNFSSymlinkPolicy(policy NFSSymlinkPolicy) NFSOption {
+	return func(s *nfsStore) {
+		s.symlinkPolicy = policy
+	}
+}
+
+// WithNFSWarningHandler receives the files the blobstore skips, instead of
+// them being logged as warnings
+func WithNFSWarningHandler(handler func(NFSWarning)) NFSOption {
+	return func(s *nfsStore) {
+		s.warn = handler
+	}
+}
+
+func logNFSWarning(warning NFSWarning) {
+	logging.Warn("skipping file", "path", warning.Path, "reason", warning.Reason)
+}
+
+// walk calls fn for each regular file under root in lexical order, like
+// filepath.Walk, applying the symlink policy and skipping sockets, FIFOs and
+// devices, which could block a read forever
+func (s *nfsStore) walk(root string, fn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	w := &nfsWalk{store: s, fn: fn, visited: map[dirID]bool{}}
+	return w.walkDir(root, info, nil)
+}
+
+// nfsWalk remembers every directory it has walked, so that a directory
+// reached through more than one link is only walked once
+type nfsWalk struct {
+	store   *nfsStore
+	fn      filepath.WalkFunc
+	visited map[dirID]bool
+}
+
+// dirID identifies a directory however it was reached: by its device and
+// inode where the platform has them, and otherwise by its resolved path
+type dirID struct {
+	dev  uint64
+	ino  uint64
+	path string
+}
+
+func newDirID(dir string, info os.FileInfo) (dirID, error) {
+	if dev, ino, ok := fileID(info); ok {
+		return dirID{dev: dev, ino: ino}, nil
+	}
+	path, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return dirID{}, err
+	}
+	return dirID{path: path}, nil
+}
+
+func (w *nfsWalk) walkDir(dir string, info os.FileInfo, ancestors []os.FileInfo) error {
+	s := w.store
+	for _, ancestor := range ancestors {
+		if os.SameFile(ancestor, info) {
+			s.warn(NFSWarning{Path: s.relativePath(dir), Reason: "it links to a directory that contains it"})
+			return nil
+		}
+	}
+	ancestors = append(ancestors, info)
+
+	id, err := newDirID(dir, info)
+	if err != nil {
+		return err
+	}
+	if w.visited[id] {
+		s.warn(NFSWarning{Path: s.relativePath(dir), Reason: "it links to a directory that has already been walked"})
+		return nil
+	}
+	w.visited[id] = true
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			switch s.symlinkPolicy {
+			case NFSSymlinksSkip:
+				s.warn(NFSWarning{Path: s.relativePath(entryPath), Reason: "it is a symbolic link"})
+				continue
+			case NFSSymlinksError:
+				return fmt.Errorf("%s is a symbolic link", entryPath)
+			}
+
+			entry, err = os.Stat(entryPath)
+			if os.IsNotExist(err) {
+				s.warn(NFSWarning{Path: s.relativePath(entryPath), Reason: "it links to a file that does not exist"})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case entry.IsDir():
+			if err := w.walkDir(entryPath, entry, ancestors); err != nil {
+				return err
+			}
+		case !entry.Mode().IsRegular():
+			s.warn(NFSWarning{Path: s.relativePath(entryPath), Reason: fmt.Sprintf("it is not a regular file (%s)", entry.Mode().Type())})
+		default:
+			if err := w.fn(entryPath, entry, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *nfsStore) relativePath(filePath string) string {
+	if rel, err := filepath.Rel(s.path, filePath); err == nil {
+		return rel
+	}
+	return filePath
+}
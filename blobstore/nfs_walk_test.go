@@ -0,0 +1,149 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NFS special files", func() {
+	var (
+		mutex    sync.Mutex
+		warnings []blobstore.NFSWarning
+	)
+
+	recordWarning := blobstore.WithNFSWarningHandler(func(warning blobstore.NFSWarning) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		warnings = append(warnings, warning)
+	})
+
+	BeforeEach(func() {
+		warnings = nil
+	})
+
+	paths := func(blobs []*blobstore.Blob) []string {
+		var paths []string
+		for _, blob := range blobs {
+			paths = append(paths, blob.Path)
+		}
+		return paths
+	}
+
+	Describe("symlinks", func() {
+		const storePath = "nfs_symlinks_testdata/store"
+
+		It("follows links to files and directories and skips loops, repeats and dangling links", func() {
+			store := blobstore.NewNFS(storePath, recordWarning)
+
+			blobs, err := store.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths(blobs)).To(Equal([]string{
+				"cc-droplets/link-to-dir/some-droplet",
+				"cc-packages/ab/cd/some-package",
+				"cc-packages/ab/link-to-package",
+			}))
+			Expect(blobs[0].Checksum).To(Equal("9e7bb9b2eccf7f27c40a7fd3e833fa21"))
+			Expect(blobs[1].Checksum).To(Equal("8801045427ecb0431b1dde4b198fc059"))
+			Expect(blobs[2].Checksum).To(Equal("8801045427ecb0431b1dde4b198fc059"))
+
+			Expect(warnings).To(Equal([]blobstore.NFSWarning{
+				{Path: "cc-droplets/loop/self", Reason: "it links to a directory that contains it"},
+				{Path: "cc-packages/ab/link-to-cd", Reason: "it links to a directory that has already been walked"},
+				{Path: "cc-resources/dangling", Reason: "it links to a file that does not exist"},
+			}))
+		})
+
+		It("skips links when told to", func() {
+			store := blobstore.NewNFS(storePath, recordWarning,
+				blobstore.WithNFSSymlinkPolicy(blobstore.NFSSymlinksSkip))
+
+			blobs, err := store.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths(blobs)).To(Equal([]string{"cc-packages/ab/cd/some-package"}))
+			Expect(warnings).To(ConsistOf(
+				blobstore.NFSWarning{Path: "cc-droplets/link-to-dir", Reason: "it is a symbolic link"},
+				blobstore.NFSWarning{Path: "cc-droplets/loop/self", Reason: "it is a symbolic link"},
+				blobstore.NFSWarning{Path: "cc-packages/ab/link-to-cd", Reason: "it is a symbolic link"},
+				blobstore.NFSWarning{Path: "cc-packages/ab/link-to-package", Reason: "it is a symbolic link"},
+				blobstore.NFSWarning{Path: "cc-resources/dangling", Reason: "it is a symbolic link"},
+			))
+		})
+
+		It("fails at the first link when told to", func() {
+			store := blobstore.NewNFS(storePath,
+				blobstore.WithNFSSymlinkPolicy(blobstore.NFSSymlinksError))
+
+			iterator, err := store.NewBucketIterator("cc-packages")
+			Expect(err).NotTo(HaveOccurred())
+
+			blob, err := iterator.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blob.Path).To(Equal("cc-packages/ab/cd/some-package"))
+
+			_, err = iterator.Next()
+			Expect(err).To(MatchError(filepath.Join(storePath, "cc-packages", "ab", "link-to-cd") + " is a symbolic link"))
+		})
+
+		It("rejects unknown policies", func() {
+			Expect(blobstore.NFSSymlinkPolicy("ignore").Validate()).To(MatchError(`unknown symlink policy "ignore", expected follow, skip or error`))
+		})
+	})
+
+	Describe("files that are not regular files", func() {
+		var baseDir string
+
+		BeforeEach(func() {
+			var err error
+			baseDir, err = ioutil.TempDir("", "nfs-special")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(baseDir, "cc-packages"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(baseDir, "cc-packages", "some-package"), []byte("package\n"), 0644)).To(Succeed())
+			Expect(syscall.Mkfifo(filepath.Join(baseDir, "cc-packages", "some-fifo"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(baseDir)
+		})
+
+		It("skips them with a warning", func() {
+			listener, err := net.Listen("unix", filepath.Join(baseDir, "cc-packages", "some-socket"))
+			Expect(err).NotTo(HaveOccurred())
+			defer listener.Close()
+
+			store := blobstore.NewNFS(baseDir, recordWarning)
+
+			blobs, err := store.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths(blobs)).To(Equal([]string{"cc-packages/some-package"}))
+
+			Expect(warnings).To(HaveLen(2))
+			Expect(warnings[0].Path).To(Equal("cc-packages/some-fifo"))
+			Expect(warnings[0].Reason).To(ContainSubstring("it is not a regular file"))
+			Expect(warnings[1].Path).To(Equal("cc-packages/some-socket"))
+		})
+	})
+})
@@ -0,0 +1,44 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+const (
+	// MiB is the unit part sizes are rounded to
+	MiB = 1024 * 1024
+
+	// DefaultPartSize is the part size used for blobs small enough not to
+	// need a larger one
+	DefaultPartSize = 10 * MiB
+	// DefaultUploadConcurrency is the number of parts of a single blob
+	// uploaded at once
+	DefaultUploadConcurrency = 20
+
+	s3MaxUploadParts  = 10000
+	azureMaxBlocks    = 50000
+	azureMaxBlockSize = 100 * MiB
+)
+
+// OptimalPartSize returns the part size to upload a blob of blobSize bytes
+// with. It is minPartSize unless the blob would then need more than maxParts
+// parts, in which case it is the smallest whole number of MiB that fits.
+// A blobSize of zero means the size is unknown.
+func OptimalPartSize(blobSize, minPartSize int64, maxParts int) int64 {
+	if blobSize <= minPartSize*int64(maxParts) {
+		return minPartSize
+	}
+
+	partSize := (blobSize + int64(maxParts) - 1) / int64(maxParts)
+	return (partSize + MiB - 1) / MiB * MiB
+}
@@ -0,0 +1,44 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OptimalPartSize", func() {
+	It("uses the minimum part size for small blobs", func() {
+		Expect(blobstore.OptimalPartSize(1024, 10*blobstore.MiB, 10000)).To(BeEquivalentTo(10 * blobstore.MiB))
+	})
+
+	It("uses the minimum part size when the size is unknown", func() {
+		Expect(blobstore.OptimalPartSize(0, 10*blobstore.MiB, 10000)).To(BeEquivalentTo(10 * blobstore.MiB))
+	})
+
+	It("uses the minimum part size when the blob fits exactly", func() {
+		Expect(blobstore.OptimalPartSize(100000*blobstore.MiB, 10*blobstore.MiB, 10000)).To(BeEquivalentTo(10 * blobstore.MiB))
+	})
+
+	It("grows the part size to stay within the part limit", func() {
+		blobSize := int64(200 * 1024 * blobstore.MiB) // 200GiB
+		partSize := blobstore.OptimalPartSize(blobSize, 10*blobstore.MiB, 10000)
+
+		Expect(partSize).To(BeEquivalentTo(21 * blobstore.MiB))
+		Expect((blobSize + partSize - 1) / partSize).To(BeNumerically("<=", 10000))
+	})
+})
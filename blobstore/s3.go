@@ -17,20 +17,19 @@ package blobstore
 import (
 	"crypto/tls"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	awss3 "github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/cheggaaa/pb"
+	"github.com/pivotal-cf/goblob/logging"
 	"github.com/pivotal-cf/goblob/validation"
-	"github.com/xchapter7x/lo"
 )
 
 var (
@@ -41,6 +40,42 @@ type s3Store struct {
 	session             *session.Session
 	useMultipartUploads bool
 	bucketMapping       map[string]string
+	encryption          S3Encryption
+	compatibility       S3Compatibility
+	objectSettings      S3ObjectSettings
+	provisioning        S3BucketProvisioning
+	bucketsMutex        sync.Mutex
+	readyBuckets        map[string]bool
+	missingBuckets      map[string]bool
+	partSize            int64
+	uploadConcurrency   int
+}
+
+// S3Option configures optional behaviour of an S3 blobstore
+type S3Option func(*s3Store)
+
+// WithS3PartSize sets the minimum part size of multipart uploads. Larger
+// parts are used for blobs that would otherwise need more than 10,000 parts.
+func WithS3PartSize(partSize int64) S3Option {
+	return func(s *s3Store) {
+		s.partSize = partSize
+	}
+}
+
+// WithS3UploadConcurrency sets how many parts of a single blob are uploaded
+// at once
+func WithS3UploadConcurrency(concurrency int) S3Option {
+	return func(s *s3Store) {
+		s.uploadConcurrency = concurrency
+	}
+}
+
+// WithS3HTTPClient sends requests through the given client, replacing the
+// one configured by insecureSkipVerify
+func WithS3HTTPClient(client *http.Client) S3Option {
+	return func(s *s3Store) {
+		s.session.Config.HTTPClient = client
+	}
 }
 
 func NewS3(
@@ -55,6 +90,7 @@ func NewS3(
 	dropletsBucketName string,
 	packagesBucketName string,
 	resourcesBucketName string,
+	opts ...S3Option,
 ) Blobstore {
 	httpClient := &http.Client{
 		Transport: &http.Transport{
@@ -64,7 +100,7 @@ func NewS3(
 		},
 	}
 
-	return &s3Store{
+	store := &s3Store{
 		session: session.New(&aws.Config{
 			HTTPClient:       httpClient,
 			Region:           aws.String(region),
@@ -80,20 +116,32 @@ func NewS3(
 			"cc-droplets":   dropletsBucketName,
 			"cc-packages":   packagesBucketName,
 		},
+		partSize:          DefaultPartSize,
+		uploadConcurrency: DefaultUploadConcurrency,
+	}
+	for _, opt := range opts {
+		opt(store)
 	}
+	return store
 }
 
 func (s *s3Store) Name() string {
 	return "S3"
 }
 
+func (s *s3Store) client() *awss3.S3 {
+	client := awss3.New(s.session)
+	s.compatibility.configure(client)
+	return client
+}
+
 func (s *s3Store) destBucketName(bucket string) string {
 	return s.bucketMapping[bucket]
 }
 
 func (s *s3Store) List() ([]*Blob, error) {
 	var blobs []*Blob
-	s3Service := awss3.New(s.session)
+	s3Service := s.client()
 	for _, bucket := range buckets {
 		bucketName := s.destBucketName(bucket)
 		bucketExists, err := s.doesBucketExist(bucketName)
@@ -107,12 +155,10 @@ func (s *s3Store) List() ([]*Blob, error) {
 			if err != nil {
 				return nil, err
 			}
-			fmt.Println("Getting list of files from S3", bucketName)
-			bar := pb.StartNew(len(listObjectsOutput.Contents))
-			bar.Format("<.- >")
 			for _, item := range listObjectsOutput.Contents {
 				blob := &Blob{
 					Path: filepath.Join(bucket, *item.Key),
+					Size: aws.Int64Value(item.Size),
 				}
 
 				checksum, err := s.checksumFromMetadata(blob)
@@ -121,14 +167,17 @@ func (s *s3Store) List() ([]*Blob, error) {
 				}
 				blob.Checksum = checksum
 				blobs = append(blobs, blob)
-				bar.Increment()
 			}
-			bar.FinishPrint(fmt.Sprintf("Done Getting list of files from S3 %s", bucketName))
+			logging.Debug("listed bucket", "store", s.Name(), "bucket", bucketName, "blobs", len(listObjectsOutput.Contents))
 		}
 	}
 	return blobs, nil
 }
 
+func (s *s3Store) sourceBucket(blob *Blob) string {
+	return blob.Path[:strings.Index(blob.Path, "/")]
+}
+
 func (s *s3Store) bucketName(blob *Blob) string {
 	return s.destBucketName(blob.Path[:strings.Index(blob.Path, "/")])
 }
@@ -138,38 +187,59 @@ func (s *s3Store) path(blob *Blob) string {
 	return blob.Path[len(bucketName)+1:]
 }
 
+func (s *s3Store) headObjectInput(src *Blob) *awss3.HeadObjectInput {
+	input := &awss3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName(src)),
+		Key:    aws.String(s.path(src)),
+	}
+	s.encryption.applyToHeadObject(input)
+	return input
+}
+
+func (s *s3Store) getObjectInput(src *Blob) *awss3.GetObjectInput {
+	input := &awss3.GetObjectInput{
+		Bucket: aws.String(s.bucketName(src)),
+		Key:    aws.String(s.path(src)),
+	}
+	s.encryption.applyToGetObject(input)
+	return input
+}
+
 func (s *s3Store) Checksum(src *Blob) (string, error) {
-	if s.useMultipartUploads {
-		getObjectOutput, err := awss3.New(s.session).GetObject(&awss3.GetObjectInput{
-			Bucket: aws.String(s.bucketName(src)),
-			Key:    aws.String(s.path(src)),
-		})
-		if err != nil {
-			return "", err
-		}
-		defer getObjectOutput.Body.Close()
-		return validation.ChecksumReader(getObjectOutput.Body)
+	if s.useMultipartUploads || !s.encryption.etagIsMD5() {
+		return s.checksumFromContent(src)
 	}
 
 	return s.checksumFromETAG(src)
 }
 
+func (s *s3Store) checksumFromContent(src *Blob) (string, error) {
+	getObjectOutput, err := s.client().GetObject(s.getObjectInput(src))
+	if err != nil {
+		return "", err
+	}
+	defer getObjectOutput.Body.Close()
+	return validation.ChecksumReader(getObjectOutput.Body)
+}
+
 func (s *s3Store) checksumFromETAG(src *Blob) (string, error) {
-	headObjectOutput, err := awss3.New(s.session).HeadObject(&awss3.HeadObjectInput{
-		Bucket: aws.String(s.bucketName(src)),
-		Key:    aws.String(s.path(src)),
-	})
+	headObjectOutput, err := s.client().HeadObject(s.headObjectInput(src))
 	if err != nil {
 		return "", err
 	}
-	return strings.Replace(*headObjectOutput.ETag, "\"", "", -1), nil
+	etag := strings.Replace(*headObjectOutput.ETag, "\"", "", -1)
+
+	// objects assembled from parts, e.g. by a server-side copy, have an
+	// ETag of the form <md5 of part md5s>-<number of parts>
+	if strings.Contains(etag, "-") {
+		return s.checksumFromContent(src)
+	}
+
+	return etag, nil
 }
 
 func (s *s3Store) checksumFromMetadata(src *Blob) (string, error) {
-	headObjectOutput, err := awss3.New(s.session).HeadObject(&awss3.HeadObjectInput{
-		Bucket: aws.String(s.bucketName(src)),
-		Key:    aws.String(s.path(src)),
-	})
+	headObjectOutput, err := s.client().HeadObject(s.headObjectInput(src))
 	if err != nil {
 		return "", err
 	}
@@ -182,13 +252,8 @@ func (s *s3Store) checksumFromMetadata(src *Blob) (string, error) {
 }
 
 func (s *s3Store) Read(src *Blob) (io.ReadCloser, error) {
-	bucketName := s.bucketName(src)
-	path := s.path(src)
-	lo.G.Debug("Getting", path, "from bucket", bucketName)
-	getObjectOutput, err := awss3.New(s.session).GetObject(&awss3.GetObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(path),
-	})
+	logging.Debug("reading blob", "store", s.Name(), "bucket", s.bucketName(src), "path", s.path(src))
+	getObjectOutput, err := s.client().GetObject(s.getObjectInput(src))
 	if err != nil {
 		return nil, err
 	}
@@ -199,33 +264,48 @@ func (s *s3Store) Read(src *Blob) (io.ReadCloser, error) {
 func (s *s3Store) Write(dst *Blob, src io.Reader) error {
 	bucketName := s.bucketName(dst)
 	path := s.path(dst)
-	if err := s.createBucket(bucketName); err != nil {
+	if err := s.ensureBucket(bucketName); err != nil {
 		return err
 	}
 	metadataMap := map[string]*string{
 		"Checksum": &dst.Checksum,
 	}
+	requestOptions, err := s.encryption.writeOptions()
+	if err != nil {
+		return err
+	}
 	if s.useMultipartUploads {
-		uploader := s3manager.NewUploader(s.session)
-		_, err := uploader.Upload(&s3manager.UploadInput{
+		uploader := s3manager.NewUploaderWithClient(s.client())
+		input := &s3manager.UploadInput{
 			Body:     src,
 			Bucket:   aws.String(bucketName),
 			Key:      aws.String(path),
 			Metadata: metadataMap,
-		}, func(u *s3manager.Uploader) {
-			u.PartSize = 10 * 1024 * 1024 // 10MB part size
-			u.Concurrency = 20
+		}
+		s.encryption.applyToUpload(input)
+		if err := s.objectSettings.applyToUpload(input, s.sourceBucket(dst)); err != nil {
+			return err
+		}
+		_, err := uploader.Upload(input, func(u *s3manager.Uploader) {
+			u.PartSize = OptimalPartSize(dst.Size, s.partSize, s3MaxUploadParts)
+			u.Concurrency = s.uploadConcurrency
+			u.RequestOptions = append(u.RequestOptions, requestOptions...)
 		})
 		if err != nil {
 			return err
 		}
 	} else {
-		_, err := awss3.New(s.session).PutObject(&awss3.PutObjectInput{
+		input := &awss3.PutObjectInput{
 			Body:     aws.ReadSeekCloser(src),
 			Bucket:   aws.String(bucketName),
 			Key:      aws.String(path),
 			Metadata: metadataMap,
-		})
+		}
+		s.encryption.applyToPutObject(input)
+		if err := s.objectSettings.applyToPutObject(input, s.sourceBucket(dst)); err != nil {
+			return err
+		}
+		_, err := s.client().PutObjectWithContext(aws.BackgroundContext(), input, requestOptions...)
 		if err != nil {
 			return err
 		}
@@ -237,7 +317,7 @@ func (s *s3Store) Write(dst *Blob, src io.Reader) error {
 func (s *s3Store) doesBucketExist(bucketName string) (bool, error) {
 	var listBucketOutput *awss3.ListBucketsOutput
 	var err error
-	s3Service := awss3.New(s.session)
+	s3Service := s.client()
 	if listBucketOutput, err = s3Service.ListBuckets(&awss3.ListBucketsInput{}); err != nil {
 		return false, err
 	}
@@ -249,24 +329,6 @@ func (s *s3Store) doesBucketExist(bucketName string) (bool, error) {
 	return false, nil
 }
 
-func (s *s3Store) createBucket(bucketName string) error {
-
-	s3Service := awss3.New(s.session)
-	bucketExists, err := s.doesBucketExist(bucketName)
-	if err != nil {
-		return err
-	}
-	if bucketExists {
-		return nil
-	}
-	_, err = s3Service.CreateBucket(&awss3.CreateBucketInput{
-		Bucket: aws.String(bucketName),
-	})
-
-	return err
-
-}
-
 func (s *s3Store) Exists(blob *Blob) bool {
 	checksum, err := s.Checksum(blob)
 	if err != nil {
@@ -276,8 +338,13 @@ func (s *s3Store) Exists(blob *Blob) bool {
 	return checksum == blob.Checksum
 }
 
-func (s *s3Store) NewBucketIterator(bucketName string) (BucketIterator, error) {
-	s3Client := awss3.New(s.session)
+func (s *s3Store) NewBucketIterator(bucket string) (BucketIterator, error) {
+	s3Client := s.client()
+
+	bucketName := bucket
+	if mappedName, ok := s.bucketMapping[bucket]; ok {
+		bucketName = mappedName
+	}
 
 	bucketExists, err := s.doesBucketExist(bucketName)
 	if err != nil {
@@ -311,17 +378,19 @@ func (s *s3Store) NewBucketIterator(bucketName string) (BucketIterator, error) {
 
 	go func() {
 		for _, item := range listObjectsOutput.Contents {
+			blob := &Blob{
+				Path: filepath.Join(
+					bucket,
+					strings.TrimPrefix(*item.Key, bucketName),
+				),
+				Size:    aws.Int64Value(item.Size),
+				ModTime: aws.TimeValue(item.LastModified),
+			}
+
 			select {
 			case <-doneCh:
-				doneCh = nil
 				return
-			default:
-				blobCh <- &Blob{
-					Path: filepath.Join(
-						bucketName,
-						strings.TrimPrefix(*item.Key, bucketName),
-					),
-				}
+			case blobCh <- blob:
 			}
 		}
 
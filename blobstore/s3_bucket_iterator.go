@@ -17,6 +17,7 @@ package blobstore
 type s3BucketIterator struct {
 	blobCh chan *Blob
 	doneCh chan struct{}
+	errCh  chan error
 }
 
 func (i *s3BucketIterator) Next() (*Blob, error) {
@@ -24,16 +25,26 @@ func (i *s3BucketIterator) Next() (*Blob, error) {
 		return nil, ErrIteratorDone
 	}
 
-	blob, ok := <-i.blobCh
-	if !ok {
+	select {
+	case blob, ok := <-i.blobCh:
+		if !ok {
+			i.blobCh = nil
+			return nil, ErrIteratorDone
+		}
+
+		return blob, nil
+	case err := <-i.errCh:
 		i.blobCh = nil
-		return nil, ErrIteratorDone
+		return nil, err
 	}
-
-	return blob, nil
 }
 
+// Done stops the listing. It may be called more than once, and on the
+// iterator of an empty bucket.
 func (i *s3BucketIterator) Done() {
 	i.blobCh = nil
-	close(i.doneCh)
+	if i.doneCh != nil {
+		close(i.doneCh)
+		i.doneCh = nil
+	}
 }
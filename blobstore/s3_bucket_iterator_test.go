@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -135,6 +136,7 @@ var _ = Describe("S3BucketIterator", func() {
 			BeforeEach(func() {
 				expectedBlob = blobstore.Blob{
 					Path: fmt.Sprintf("%s/some-path/some-file", bucketName),
+					Size: 7,
 				}
 
 				_, err := s3Client.PutObject(&awss3.PutObjectInput{
@@ -154,6 +156,8 @@ var _ = Describe("S3BucketIterator", func() {
 			It("returns the blob", func() {
 				blob, err := iterator.Next()
 				Expect(err).NotTo(HaveOccurred())
+				Expect(blob.ModTime).To(BeTemporally("~", time.Now(), time.Minute))
+				blob.ModTime = time.Time{}
 				Expect(*blob).To(Equal(expectedBlob))
 			})
 
@@ -0,0 +1,332 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+
+	noncurrentVersionExpirationRuleID    = "goblob-noncurrent-version-expiration"
+	abortIncompleteMultipartUploadRuleID = "goblob-abort-incomplete-multipart-uploads"
+)
+
+// S3BucketProvisioning describes how buckets missing from an S3 blobstore
+// are created. Buckets that already exist are left as they are.
+type S3BucketProvisioning struct {
+	// NoCreate makes writing to a missing bucket an error
+	NoCreate bool
+
+	// LocationConstraint is the region buckets are created in; empty
+	// means the region of the store
+	LocationConstraint string
+
+	Versioning bool
+
+	// DefaultEncryption is AES256 or aws:kms, applied to objects written
+	// to the bucket by anything without encryption settings of its own
+	DefaultEncryption         string
+	DefaultEncryptionKMSKeyID string
+
+	// BlockPublicAccess turns on every setting of the public access block
+	BlockPublicAccess bool
+
+	// NoncurrentVersionExpirationDays expires old versions of overwritten
+	// objects; zero keeps them forever
+	NoncurrentVersionExpirationDays int64
+	// AbortIncompleteMultipartUploadDays removes the parts of uploads that
+	// were never completed; zero keeps them forever
+	AbortIncompleteMultipartUploadDays int64
+}
+
+// WithS3BucketProvisioning creates missing buckets with the given settings
+func WithS3BucketProvisioning(provisioning S3BucketProvisioning) S3Option {
+	return func(s *s3Store) {
+		s.provisioning = provisioning
+	}
+}
+
+// Validate checks the settings are consistent with each other
+func (p S3BucketProvisioning) Validate() error {
+	switch p.DefaultEncryption {
+	case "":
+		if p.DefaultEncryptionKMSKeyID != "" {
+			return errors.New("a default encryption KMS key given without default encryption")
+		}
+	case S3EncryptionAES256:
+		if p.DefaultEncryptionKMSKeyID != "" {
+			return fmt.Errorf("%s default encryption does not take a key", S3EncryptionAES256)
+		}
+	case S3EncryptionKMS:
+	default:
+		return fmt.Errorf("unknown default encryption %q, expected %s or %s", p.DefaultEncryption, S3EncryptionAES256, S3EncryptionKMS)
+	}
+
+	if p.NoncurrentVersionExpirationDays < 0 || p.AbortIncompleteMultipartUploadDays < 0 {
+		return errors.New("lifecycle rules cannot have a negative number of days")
+	}
+	if p.NoncurrentVersionExpirationDays > 0 && !p.Versioning {
+		return errors.New("noncurrent versions can only be expired when versioning is enabled")
+	}
+
+	return nil
+}
+
+// ensureBucket makes sure a bucket exists, creating and configuring it when
+// it is missing. Each bucket is only checked once, and a bucket that is
+// missing while bucket creation is disabled is remembered as missing.
+func (s *s3Store) ensureBucket(bucketName string) error {
+	s.bucketsMutex.Lock()
+	defer s.bucketsMutex.Unlock()
+
+	if s.readyBuckets[bucketName] {
+		return nil
+	}
+	if s.missingBuckets[bucketName] {
+		return missingBucketError(bucketName)
+	}
+
+	bucketExists, err := s.doesBucketExist(bucketName)
+	if err != nil {
+		return err
+	}
+	if !bucketExists {
+		if s.provisioning.NoCreate {
+			if s.missingBuckets == nil {
+				s.missingBuckets = map[string]bool{}
+			}
+			s.missingBuckets[bucketName] = true
+			return missingBucketError(bucketName)
+		}
+		if err := s.createBucket(bucketName); err != nil {
+			return err
+		}
+	}
+
+	if s.readyBuckets == nil {
+		s.readyBuckets = map[string]bool{}
+	}
+	s.readyBuckets[bucketName] = true
+	return nil
+}
+
+func missingBucketError(bucketName string) error {
+	return fmt.Errorf("bucket %s does not exist and bucket creation is disabled", bucketName)
+}
+
+// PrepareBuckets checks the destination of each bucket before anything is
+// written, creating the missing ones unless bucket creation is disabled
+func (s *s3Store) PrepareBuckets(buckets []string) error {
+	var missing []string
+	for _, bucket := range buckets {
+		bucketName := bucket
+		if mappedName, ok := s.bucketMapping[bucket]; ok {
+			bucketName = mappedName
+		}
+
+		if err := s.ensureBucket(bucketName); err != nil {
+			if !s.isMissing(bucketName) {
+				return err
+			}
+			missing = append(missing, bucketName)
+		}
+	}
+
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return missingBucketError(missing[0])
+	default:
+		return fmt.Errorf("buckets %s do not exist and bucket creation is disabled", strings.Join(missing, ", "))
+	}
+}
+
+func (s *s3Store) isMissing(bucketName string) bool {
+	s.bucketsMutex.Lock()
+	defer s.bucketsMutex.Unlock()
+	return s.missingBuckets[bucketName]
+}
+
+func (s *s3Store) createBucket(bucketName string) error {
+	s3Service := s.client()
+
+	input := &awss3.CreateBucketInput{
+		Bucket: aws.String(bucketName),
+	}
+	locationConstraint := s.provisioning.LocationConstraint
+	if locationConstraint == "" {
+		locationConstraint = aws.StringValue(s.session.Config.Region)
+	}
+	if locationConstraint != "" && locationConstraint != s3DefaultRegion {
+		input.CreateBucketConfiguration = &awss3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(locationConstraint),
+		}
+	}
+	if _, err := s3Service.CreateBucket(input); err != nil {
+		return fmt.Errorf("error creating bucket %s: %s", bucketName, err)
+	}
+
+	if s.provisioning.Versioning {
+		_, err := s3Service.PutBucketVersioning(&awss3.PutBucketVersioningInput{
+			Bucket: aws.String(bucketName),
+			VersioningConfiguration: &awss3.VersioningConfiguration{
+				Status: aws.String(awss3.BucketVersioningStatusEnabled),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error enabling versioning on bucket %s: %s", bucketName, err)
+		}
+	}
+
+	if s.provisioning.DefaultEncryption != "" {
+		rule := &awss3.ServerSideEncryptionByDefault{
+			SSEAlgorithm: aws.String(s.provisioning.DefaultEncryption),
+		}
+		if s.provisioning.DefaultEncryptionKMSKeyID != "" {
+			rule.KMSMasterKeyID = aws.String(s.provisioning.DefaultEncryptionKMSKeyID)
+		}
+		_, err := s3Service.PutBucketEncryption(&awss3.PutBucketEncryptionInput{
+			Bucket: aws.String(bucketName),
+			ServerSideEncryptionConfiguration: &awss3.ServerSideEncryptionConfiguration{
+				Rules: []*awss3.ServerSideEncryptionRule{
+					{ApplyServerSideEncryptionByDefault: rule},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error setting default encryption on bucket %s: %s", bucketName, err)
+		}
+	}
+
+	if s.provisioning.BlockPublicAccess {
+		if err := putPublicAccessBlock(s3Service, bucketName); err != nil {
+			return fmt.Errorf("error blocking public access to bucket %s: %s", bucketName, err)
+		}
+	}
+
+	if rules := s.provisioning.lifecycleRules(); len(rules) > 0 {
+		_, err := s3Service.PutBucketLifecycleConfiguration(&awss3.PutBucketLifecycleConfigurationInput{
+			Bucket: aws.String(bucketName),
+			LifecycleConfiguration: &awss3.BucketLifecycleConfiguration{
+				Rules: rules,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error setting lifecycle rules on bucket %s: %s", bucketName, err)
+		}
+	}
+
+	return nil
+}
+
+func (p S3BucketProvisioning) lifecycleRules() []*awss3.LifecycleRule {
+	var rules []*awss3.LifecycleRule
+	if p.NoncurrentVersionExpirationDays > 0 {
+		rules = append(rules, &awss3.LifecycleRule{
+			ID:     aws.String(noncurrentVersionExpirationRuleID),
+			Status: aws.String(awss3.ExpirationStatusEnabled),
+			Filter: &awss3.LifecycleRuleFilter{Prefix: aws.String("")},
+			NoncurrentVersionExpiration: &awss3.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int64(p.NoncurrentVersionExpirationDays),
+			},
+		})
+	}
+	if p.AbortIncompleteMultipartUploadDays > 0 {
+		rules = append(rules, &awss3.LifecycleRule{
+			ID:     aws.String(abortIncompleteMultipartUploadRuleID),
+			Status: aws.String(awss3.ExpirationStatusEnabled),
+			Filter: &awss3.LifecycleRuleFilter{Prefix: aws.String("")},
+			AbortIncompleteMultipartUpload: &awss3.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int64(p.AbortIncompleteMultipartUploadDays),
+			},
+		})
+	}
+	return rules
+}
+
+// The pinned SDK predates the public access block API, so the request is
+// described here the way the SDK describes its own operations.
+type putPublicAccessBlockInput struct {
+	_ struct{} `type:"structure" payload:"PublicAccessBlockConfiguration"`
+
+	Bucket                         *string                         `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+	PublicAccessBlockConfiguration *publicAccessBlockConfiguration `locationName:"PublicAccessBlockConfiguration" type:"structure" required:"true" xmlURI:"http://s3.amazonaws.com/doc/2006-03-01/"`
+}
+
+type publicAccessBlockConfiguration struct {
+	_ struct{} `type:"structure"`
+
+	BlockPublicAcls       *bool `locationName:"BlockPublicAcls" type:"boolean"`
+	IgnorePublicAcls      *bool `locationName:"IgnorePublicAcls" type:"boolean"`
+	BlockPublicPolicy     *bool `locationName:"BlockPublicPolicy" type:"boolean"`
+	RestrictPublicBuckets *bool `locationName:"RestrictPublicBuckets" type:"boolean"`
+}
+
+type putPublicAccessBlockOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+func putPublicAccessBlock(s3Service *awss3.S3, bucketName string) error {
+	operation := &request.Operation{
+		Name:       "PutPublicAccessBlock",
+		HTTPMethod: "PUT",
+		HTTPPath:   "/{Bucket}?publicAccessBlock",
+	}
+	input := &putPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+		PublicAccessBlockConfiguration: &publicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}
+
+	req := s3Service.NewRequest(operation, input, &putPublicAccessBlockOutput{})
+	req.Handlers.Build.PushBack(addContentMD5)
+	return req.Send()
+}
+
+// addContentMD5 sets the Content-MD5 header S3 requires on bucket
+// configuration requests
+func addContentMD5(r *request.Request) {
+	body := r.GetBody()
+	if body == nil {
+		return
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, body); err != nil {
+		r.Error = err
+		return
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		r.Error = err
+		return
+	}
+	r.HTTPRequest.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(h.Sum(nil)))
+}
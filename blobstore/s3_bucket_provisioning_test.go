@@ -0,0 +1,187 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3BucketProvisioning", func() {
+	Describe("Validate", func() {
+		It("accepts no settings", func() {
+			Expect(blobstore.S3BucketProvisioning{}.Validate()).To(Succeed())
+		})
+
+		It("rejects unknown default encryption", func() {
+			provisioning := blobstore.S3BucketProvisioning{DefaultEncryption: "SSE-C"}
+			Expect(provisioning.Validate()).To(MatchError(`unknown default encryption "SSE-C", expected AES256 or aws:kms`))
+		})
+
+		It("rejects expiring noncurrent versions without versioning", func() {
+			provisioning := blobstore.S3BucketProvisioning{NoncurrentVersionExpirationDays: 30}
+			Expect(provisioning.Validate()).To(MatchError("noncurrent versions can only be expired when versioning is enabled"))
+		})
+	})
+
+	Describe("writing to a missing bucket", func() {
+		type s3Request struct {
+			method string
+			uri    string
+			body   string
+		}
+
+		var (
+			server   *httptest.Server
+			mutex    sync.Mutex
+			requests []s3Request
+		)
+
+		BeforeEach(func() {
+			requests = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+
+				mutex.Lock()
+				uri := r.URL.Path
+				for subresource := range r.URL.Query() {
+					uri += "?" + subresource
+				}
+				requests = append(requests, s3Request{method: r.Method, uri: uri, body: string(body)})
+				mutex.Unlock()
+
+				if r.Method == "GET" && r.URL.Path == "/" {
+					fmt.Fprint(w, `<ListAllMyBucketsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Owner><ID>some-owner</ID><DisplayName>some-owner</DisplayName></Owner>
+  <Buckets></Buckets>
+</ListAllMyBucketsResult>`)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		newStore := func(provisioning blobstore.S3BucketProvisioning) blobstore.Blobstore {
+			return blobstore.NewS3(
+				"some-access-key", "some-secret-key", "eu-west-1", server.URL,
+				false, true, false,
+				"some-buildpacks", "some-droplets", "some-packages", "some-resources",
+				blobstore.WithS3BucketProvisioning(provisioning),
+			)
+		}
+
+		write := func(store blobstore.Blobstore) error {
+			return store.Write(&blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet"}, strings.NewReader("content"))
+		}
+
+		It("creates and configures the bucket once", func() {
+			store := newStore(blobstore.S3BucketProvisioning{
+				Versioning:                         true,
+				DefaultEncryption:                  blobstore.S3EncryptionAES256,
+				BlockPublicAccess:                  true,
+				NoncurrentVersionExpirationDays:    30,
+				AbortIncompleteMultipartUploadDays: 7,
+			})
+
+			Expect(write(store)).To(Succeed())
+			Expect(write(store)).To(Succeed())
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			var uris []string
+			for _, request := range requests {
+				uris = append(uris, request.method+" "+request.uri)
+			}
+			Expect(uris).To(Equal([]string{
+				"GET /",
+				"PUT /some-droplets",
+				"PUT /some-droplets?versioning",
+				"PUT /some-droplets?encryption",
+				"PUT /some-droplets?publicAccessBlock",
+				"PUT /some-droplets?lifecycle",
+				"PUT /some-droplets/ab/cd/some-droplet",
+				"PUT /some-droplets/ab/cd/some-droplet",
+			}))
+
+			Expect(requests[1].body).To(ContainSubstring("<LocationConstraint>eu-west-1</LocationConstraint>"))
+			Expect(requests[2].body).To(ContainSubstring("<Status>Enabled</Status>"))
+			Expect(requests[3].body).To(ContainSubstring("<SSEAlgorithm>AES256</SSEAlgorithm>"))
+			Expect(requests[4].body).To(ContainSubstring("<BlockPublicAcls>true</BlockPublicAcls>"))
+			Expect(requests[5].body).To(ContainSubstring("<NoncurrentDays>30</NoncurrentDays>"))
+			Expect(requests[5].body).To(ContainSubstring("<DaysAfterInitiation>7</DaysAfterInitiation>"))
+		})
+
+		It("fails when bucket creation is disabled", func() {
+			store := newStore(blobstore.S3BucketProvisioning{NoCreate: true})
+
+			Expect(write(store)).To(MatchError("bucket some-droplets does not exist and bucket creation is disabled"))
+			Expect(write(store)).To(MatchError("bucket some-droplets does not exist and bucket creation is disabled"))
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(requests).To(HaveLen(1))
+		})
+
+		It("reports every missing bucket at once when preparing buckets", func() {
+			store := newStore(blobstore.S3BucketProvisioning{NoCreate: true})
+
+			preparer, ok := store.(blobstore.BucketPreparer)
+			Expect(ok).To(BeTrue())
+
+			err := preparer.PrepareBuckets([]string{"cc-droplets", "cc-packages"})
+			Expect(err).To(MatchError("buckets some-droplets, some-packages do not exist and bucket creation is disabled"))
+			Expect(write(store)).To(MatchError("bucket some-droplets does not exist and bucket creation is disabled"))
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, request := range requests {
+				Expect(request.method).To(Equal("GET"))
+			}
+			Expect(requests).To(HaveLen(2))
+		})
+
+		It("creates missing buckets when preparing buckets", func() {
+			store := newStore(blobstore.S3BucketProvisioning{})
+
+			err := store.(blobstore.BucketPreparer).PrepareBuckets([]string{"cc-droplets"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(write(store)).To(Succeed())
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			var uris []string
+			for _, request := range requests {
+				uris = append(uris, request.method+" "+request.uri)
+			}
+			Expect(uris).To(Equal([]string{
+				"GET /",
+				"PUT /some-droplets",
+				"PUT /some-droplets/ab/cd/some-droplet",
+			}))
+		})
+	})
+})
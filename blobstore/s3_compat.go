@@ -0,0 +1,228 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// S3AddressingPath puts the bucket in the URL path
+	S3AddressingPath = "path"
+	// S3AddressingVirtual puts the bucket in the host name
+	S3AddressingVirtual = "virtual"
+
+	// S3SignatureV4 signs requests with AWS signature version 4
+	S3SignatureV4 = "v4"
+	// S3SignatureV2 signs requests with AWS signature version 2
+	S3SignatureV2 = "v2"
+
+	s3CompatCheckKey = "goblob-compat-check"
+)
+
+// S3Compatibility tunes how requests are addressed and signed for
+// S3-compatible endpoints that do not behave like AWS
+type S3Compatibility struct {
+	AddressingStyle   string
+	SignatureVersion  string
+	DisableContentMD5 bool
+	UnsignedPayload   bool
+}
+
+var removeContentMD5Handler = request.NamedHandler{
+	Name: "goblob.RemoveContentMD5Handler",
+	Fn: func(r *request.Request) {
+		r.HTTPRequest.Header.Del("Content-Md5")
+	},
+}
+
+// WithS3Compatibility applies the addressing and signing settings to every
+// request made by the store
+func WithS3Compatibility(compatibility S3Compatibility) S3Option {
+	return func(s *s3Store) {
+		s.compatibility = compatibility
+		s.session.Config.S3ForcePathStyle = aws.Bool(compatibility.AddressingStyle != S3AddressingVirtual)
+	}
+}
+
+// Validate checks the addressing style and signature version are known
+func (c S3Compatibility) Validate() error {
+	switch c.AddressingStyle {
+	case "", S3AddressingPath, S3AddressingVirtual:
+	default:
+		return fmt.Errorf("unknown addressing style %q", c.AddressingStyle)
+	}
+
+	switch c.SignatureVersion {
+	case "", S3SignatureV4:
+	case S3SignatureV2:
+		if c.UnsignedPayload {
+			return fmt.Errorf("unsigned payloads require signature version %s", S3SignatureV4)
+		}
+	default:
+		return fmt.Errorf("unknown signature version %q", c.SignatureVersion)
+	}
+
+	return nil
+}
+
+// String describes the settings as the flags that select them
+func (c S3Compatibility) String() string {
+	addressingStyle := c.AddressingStyle
+	if addressingStyle == "" {
+		addressingStyle = S3AddressingPath
+	}
+	signatureVersion := c.SignatureVersion
+	if signatureVersion == "" {
+		signatureVersion = S3SignatureV4
+	}
+
+	flags := []string{
+		"--s3-addressing-style " + addressingStyle,
+		"--s3-signature-version " + signatureVersion,
+	}
+	if c.UnsignedPayload {
+		flags = append(flags, "--s3-unsigned-payload")
+	}
+	if c.DisableContentMD5 {
+		flags = append(flags, "--s3-disable-content-md5")
+	}
+	return strings.Join(flags, " ")
+}
+
+func (c S3Compatibility) configure(client *awss3.S3) {
+	switch {
+	case c.SignatureVersion == S3SignatureV2:
+		client.Handlers.Sign.RemoveByName(v4.SignRequestHandler.Name)
+		client.Handlers.Sign.PushBackNamed(signS3V2Handler)
+	case c.UnsignedPayload:
+		client.Handlers.Sign.RemoveByName(v4.SignRequestHandler.Name)
+		client.Handlers.Sign.PushBackNamed(v4.BuildNamedHandler(v4.SignRequestHandler.Name, v4.WithUnsignedPayload))
+	}
+
+	if c.DisableContentMD5 {
+		client.Handlers.Sign.PushFrontNamed(removeContentMD5Handler)
+	}
+}
+
+// S3CompatibilityResult is the outcome of probing an endpoint with one set of
+// compatibility settings
+type S3CompatibilityResult struct {
+	Compatibility S3Compatibility
+	Err           error
+}
+
+// S3CompatibilityCandidates are the settings probed by CheckS3Compatibility,
+// most preferred first
+var S3CompatibilityCandidates = []S3Compatibility{
+	{AddressingStyle: S3AddressingPath, SignatureVersion: S3SignatureV4},
+	{AddressingStyle: S3AddressingVirtual, SignatureVersion: S3SignatureV4},
+	{AddressingStyle: S3AddressingPath, SignatureVersion: S3SignatureV4, UnsignedPayload: true},
+	{AddressingStyle: S3AddressingVirtual, SignatureVersion: S3SignatureV4, UnsignedPayload: true},
+	{AddressingStyle: S3AddressingPath, SignatureVersion: S3SignatureV2},
+	{AddressingStyle: S3AddressingVirtual, SignatureVersion: S3SignatureV2},
+}
+
+// CheckS3Compatibility probes an endpoint with each of the candidate
+// settings. When a bucket is given a small object is written to, read from
+// and deleted from it. The recommended settings are those of the first
+// result without an error.
+func CheckS3Compatibility(
+	endpoint string,
+	region string,
+	disableSSL bool,
+	creds *credentials.Credentials,
+	httpClient *http.Client,
+	bucket string,
+) []S3CompatibilityResult {
+	var results []S3CompatibilityResult
+	for _, compatibility := range S3CompatibilityCandidates {
+		store := &s3Store{
+			session: session.New(&aws.Config{
+				HTTPClient:       httpClient,
+				Region:           aws.String(region),
+				Credentials:      creds,
+				Endpoint:         aws.String(endpoint),
+				DisableSSL:       aws.Bool(disableSSL),
+				S3ForcePathStyle: aws.Bool(compatibility.AddressingStyle != S3AddressingVirtual),
+				MaxRetries:       aws.Int(0),
+			}),
+			compatibility: compatibility,
+		}
+
+		results = append(results, S3CompatibilityResult{
+			Compatibility: compatibility,
+			Err:           store.probe(bucket),
+		})
+	}
+	return results
+}
+
+func (s *s3Store) probe(bucket string) error {
+	client := s.client()
+
+	if _, err := client.ListBuckets(&awss3.ListBucketsInput{}); err != nil {
+		return fmt.Errorf("ListBuckets: %s", err)
+	}
+
+	if bucket == "" {
+		return nil
+	}
+
+	_, err := client.PutObject(&awss3.PutObjectInput{
+		Body:   strings.NewReader(s3CompatCheckKey),
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s3CompatCheckKey),
+	})
+	if err != nil {
+		return fmt.Errorf("PutObject: %s", err)
+	}
+
+	getObjectOutput, err := client.GetObject(&awss3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s3CompatCheckKey),
+	})
+	if err != nil {
+		return fmt.Errorf("GetObject: %s", err)
+	}
+	contents, err := ioutil.ReadAll(getObjectOutput.Body)
+	getObjectOutput.Body.Close()
+	if err != nil {
+		return fmt.Errorf("GetObject: %s", err)
+	}
+	if string(contents) != s3CompatCheckKey {
+		return fmt.Errorf("GetObject: read %q back instead of %q", contents, s3CompatCheckKey)
+	}
+
+	_, err = client.DeleteObject(&awss3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s3CompatCheckKey),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteObject: %s", err)
+	}
+
+	return nil
+}
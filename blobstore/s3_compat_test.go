@@ -0,0 +1,116 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3Compatibility", func() {
+	Describe("Validate", func() {
+		It("accepts the defaults", func() {
+			Expect(blobstore.S3Compatibility{}.Validate()).To(Succeed())
+		})
+
+		It("rejects unknown addressing styles", func() {
+			compatibility := blobstore.S3Compatibility{AddressingStyle: "dns"}
+			Expect(compatibility.Validate()).To(MatchError(`unknown addressing style "dns"`))
+		})
+
+		It("rejects unknown signature versions", func() {
+			compatibility := blobstore.S3Compatibility{SignatureVersion: "v3"}
+			Expect(compatibility.Validate()).To(MatchError(`unknown signature version "v3"`))
+		})
+
+		It("rejects unsigned payloads with signature version 2", func() {
+			compatibility := blobstore.S3Compatibility{
+				SignatureVersion: blobstore.S3SignatureV2,
+				UnsignedPayload:  true,
+			}
+			Expect(compatibility.Validate()).To(MatchError("unsigned payloads require signature version v4"))
+		})
+	})
+
+	Describe("String", func() {
+		It("describes the settings as flags", func() {
+			compatibility := blobstore.S3Compatibility{
+				AddressingStyle:   blobstore.S3AddressingVirtual,
+				UnsignedPayload:   true,
+				DisableContentMD5: true,
+			}
+			Expect(compatibility.String()).To(Equal(
+				"--s3-addressing-style virtual --s3-signature-version v4 --s3-unsigned-payload --s3-disable-content-md5",
+			))
+		})
+	})
+
+	Describe("CheckS3Compatibility", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS some-access-key:") {
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `<Error><Code>SignatureDoesNotMatch</Code><Message>only signature version 2 is supported</Message></Error>`)
+					return
+				}
+
+				fmt.Fprint(w, `<ListAllMyBucketsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Owner><ID>some-owner</ID><DisplayName>some-owner</DisplayName></Owner>
+  <Buckets></Buckets>
+</ListAllMyBucketsResult>`)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("reports which settings the endpoint accepts", func() {
+			results := blobstore.CheckS3Compatibility(
+				server.URL,
+				"us-east-1",
+				true,
+				credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+				http.DefaultClient,
+				"",
+			)
+			Expect(results).To(HaveLen(len(blobstore.S3CompatibilityCandidates)))
+
+			var working []blobstore.S3Compatibility
+			for _, result := range results {
+				if result.Err == nil {
+					working = append(working, result.Compatibility)
+				} else {
+					Expect(result.Err.Error()).To(ContainSubstring("SignatureDoesNotMatch"))
+				}
+			}
+
+			Expect(working).To(Equal([]blobstore.S3Compatibility{
+				{AddressingStyle: blobstore.S3AddressingPath, SignatureVersion: blobstore.S3SignatureV2},
+				{AddressingStyle: blobstore.S3AddressingVirtual, SignatureVersion: blobstore.S3SignatureV2},
+			}))
+		})
+	})
+})
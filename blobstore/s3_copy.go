@@ -0,0 +1,230 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// s3MaxCopyObjectSize is the largest object CopyObject can copy; larger
+	// objects are copied a part at a time
+	s3MaxCopyObjectSize = 5 * 1024 * MiB
+	// s3MinCopyPartSize keeps the number of UploadPartCopy requests down,
+	// since no data passes through goblob
+	s3MinCopyPartSize = 512 * MiB
+)
+
+// CanCopyFrom reports whether src is an S3 blobstore on the same endpoint,
+// which S3 can copy from as long as the destination credentials can read
+// the source buckets
+func (s *s3Store) CanCopyFrom(src Blobstore) bool {
+	srcStore, ok := src.(*s3Store)
+	if !ok {
+		return false
+	}
+	return aws.StringValue(srcStore.session.Config.Endpoint) == aws.StringValue(s.session.Config.Endpoint)
+}
+
+// CopyFrom copies a blob from another S3 blobstore with CopyObject, or with
+// UploadPartCopy for objects too large for CopyObject
+func (s *s3Store) CopyFrom(src Blobstore, blob *Blob) error {
+	srcStore, ok := src.(*s3Store)
+	if !ok {
+		return fmt.Errorf("cannot copy from %s to S3", src.Name())
+	}
+
+	bucketName := s.bucketName(blob)
+	if err := s.ensureBucket(bucketName); err != nil {
+		return err
+	}
+
+	size := blob.Size
+	if size == 0 {
+		headObjectOutput, err := srcStore.client().HeadObject(srcStore.headObjectInput(blob))
+		if err != nil {
+			return err
+		}
+		size = aws.Int64Value(headObjectOutput.ContentLength)
+	}
+
+	copySource := (&url.URL{Path: srcStore.bucketName(blob) + "/" + srcStore.path(blob)}).EscapedPath()
+
+	if size <= s3MaxCopyObjectSize {
+		return s.copyObject(srcStore, blob, copySource)
+	}
+	return s.copyObjectInParts(srcStore, blob, copySource, size)
+}
+
+// CopiedChecksum returns the checksum of a copied object's content. The
+// ETag is used when it is the MD5 of the content, i.e. for objects copied
+// whole without KMS or customer keys; otherwise the object is read back.
+func (s *s3Store) CopiedChecksum(blob *Blob) (string, error) {
+	if !s.encryption.etagIsMD5() {
+		return s.checksumFromContent(blob)
+	}
+	return s.checksumFromETAG(blob)
+}
+
+func (s *s3Store) copyObject(srcStore *s3Store, blob *Blob, copySource string) error {
+	input := &awss3.CopyObjectInput{
+		Bucket:            aws.String(s.bucketName(blob)),
+		Key:               aws.String(s.path(blob)),
+		CopySource:        aws.String(copySource),
+		Metadata:          map[string]*string{"Checksum": aws.String(blob.Checksum)},
+		MetadataDirective: aws.String(awss3.MetadataDirectiveReplace),
+	}
+
+	putObjectInput := &awss3.PutObjectInput{Bucket: input.Bucket}
+	s.encryption.applyToPutObject(putObjectInput)
+	if err := s.objectSettings.applyToPutObject(putObjectInput, s.sourceBucket(blob)); err != nil {
+		return err
+	}
+	input.ServerSideEncryption = putObjectInput.ServerSideEncryption
+	input.SSEKMSKeyId = putObjectInput.SSEKMSKeyId
+	input.SSECustomerAlgorithm = putObjectInput.SSECustomerAlgorithm
+	input.SSECustomerKey = putObjectInput.SSECustomerKey
+	input.StorageClass = putObjectInput.StorageClass
+	if putObjectInput.Tagging != nil {
+		input.Tagging = putObjectInput.Tagging
+		input.TaggingDirective = aws.String(awss3.TaggingDirectiveReplace)
+	}
+	input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey = srcStore.encryption.customerKey()
+
+	requestOptions, err := s.encryption.writeOptions()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client().CopyObjectWithContext(aws.BackgroundContext(), input, requestOptions...)
+	return err
+}
+
+func (s *s3Store) copyObjectInParts(srcStore *s3Store, blob *Blob, copySource string, size int64) error {
+	client := s.client()
+	bucketName := s.bucketName(blob)
+	path := s.path(blob)
+
+	putObjectInput := &awss3.PutObjectInput{Bucket: aws.String(bucketName)}
+	s.encryption.applyToPutObject(putObjectInput)
+	if err := s.objectSettings.applyToPutObject(putObjectInput, s.sourceBucket(blob)); err != nil {
+		return err
+	}
+
+	requestOptions, err := s.encryption.writeOptions()
+	if err != nil {
+		return err
+	}
+
+	createOutput, err := client.CreateMultipartUploadWithContext(aws.BackgroundContext(), &awss3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucketName),
+		Key:                  aws.String(path),
+		Metadata:             map[string]*string{"Checksum": aws.String(blob.Checksum)},
+		ServerSideEncryption: putObjectInput.ServerSideEncryption,
+		SSEKMSKeyId:          putObjectInput.SSEKMSKeyId,
+		SSECustomerAlgorithm: putObjectInput.SSECustomerAlgorithm,
+		SSECustomerKey:       putObjectInput.SSECustomerKey,
+		StorageClass:         putObjectInput.StorageClass,
+		Tagging:              putObjectInput.Tagging,
+	}, requestOptions...)
+	if err != nil {
+		return err
+	}
+	uploadID := createOutput.UploadId
+
+	partSize := OptimalPartSize(size, s3MinCopyPartSize, s3MaxUploadParts)
+	var parts []*awss3.CompletedPart
+	var partsMutex sync.Mutex
+	slots := make(chan struct{}, s.uploadConcurrency)
+
+	// the first part that fails cancels the parts still being copied and
+	// stops the rest from being started. It cancels before giving up its
+	// slot, so the next part cannot start in between.
+	ctx, cancel := context.WithCancel(aws.BackgroundContext())
+	defer cancel()
+	var group errgroup.Group
+	for partNumber, start := int64(1), int64(0); start < size; partNumber, start = partNumber+1, start+partSize {
+		partNumber, start := partNumber, start
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		group.Go(func() error {
+			defer func() { <-slots }()
+
+			input := &awss3.UploadPartCopyInput{
+				Bucket:          aws.String(bucketName),
+				Key:             aws.String(path),
+				UploadId:        uploadID,
+				PartNumber:      aws.Int64(partNumber),
+				CopySource:      aws.String(copySource),
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			}
+			input.SSECustomerAlgorithm, input.SSECustomerKey = s.encryption.customerKey()
+			input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey = srcStore.encryption.customerKey()
+
+			output, err := client.UploadPartCopyWithContext(ctx, input)
+			if err != nil {
+				cancel()
+				return fmt.Errorf("error copying part %d: %s", partNumber, err)
+			}
+
+			partsMutex.Lock()
+			parts = append(parts, &awss3.CompletedPart{
+				ETag:       output.CopyPartResult.ETag,
+				PartNumber: aws.Int64(partNumber),
+			})
+			partsMutex.Unlock()
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		client.AbortMultipartUpload(&awss3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucketName),
+			Key:      aws.String(path),
+			UploadId: uploadID,
+		})
+		return err
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.Int64Value(parts[i].PartNumber) < aws.Int64Value(parts[j].PartNumber)
+	})
+
+	_, err = client.CompleteMultipartUpload(&awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucketName),
+		Key:             aws.String(path),
+		UploadId:        uploadID,
+		MultipartUpload: &awss3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
@@ -0,0 +1,148 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3 server-side copy", func() {
+	var (
+		server       *httptest.Server
+		headers      chan http.Header
+		paths        chan string
+		partRequests chan string
+		aborts       chan string
+	)
+
+	BeforeEach(func() {
+		headers = make(chan http.Header, 1)
+		paths = make(chan string, 1)
+		partRequests = make(chan string, 20)
+		aborts = make(chan string, 1)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "POST":
+				fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>new-droplets</Bucket><Key>some-key</Key><UploadId>some-upload</UploadId></InitiateMultipartUploadResult>`)
+			case "DELETE":
+				aborts <- r.URL.Query().Get("uploadId")
+			case "PUT":
+				if r.URL.Query().Get("partNumber") != "" {
+					partRequests <- r.URL.Query().Get("partNumber")
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+					return
+				}
+				headers <- r.Header
+				paths <- r.URL.Path
+				fmt.Fprint(w, `<CopyObjectResult><ETag>"some-etag"</ETag><LastModified>2018-09-01T00:00:00.000Z</LastModified></CopyObjectResult>`)
+			case "HEAD":
+				if r.URL.Path == "/new-droplets/ab/cd/large-droplet" {
+					w.Header().Set("ETag", `"some-part-md5s-3"`)
+				} else {
+					w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum([]byte("other content"))))
+				}
+				w.Header().Set("X-Amz-Meta-Checksum", "some-checksum")
+			case "GET":
+				if r.URL.Path == "/new-droplets/ab/cd/large-droplet" {
+					fmt.Fprint(w, "other content")
+					return
+				}
+				if r.URL.Path != "/" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				fmt.Fprint(w, `<ListAllMyBucketsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Owner><ID>some-owner</ID><DisplayName>some-owner</DisplayName></Owner>
+  <Buckets><Bucket><Name>new-droplets</Name></Bucket></Buckets>
+</ListAllMyBucketsResult>`)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newStore := func(endpoint, dropletsBucketName string, opts ...blobstore.S3Option) blobstore.Blobstore {
+		return blobstore.NewS3(
+			"some-access-key", "some-secret-key", "us-east-1", endpoint,
+			false, true, false,
+			"some-buildpacks", dropletsBucketName, "some-packages", "some-resources",
+			opts...,
+		)
+	}
+
+	It("can only copy from S3 blobstores on the same endpoint", func() {
+		dst := newStore(server.URL, "new-droplets").(blobstore.ServerSideCopier)
+
+		Expect(dst.CanCopyFrom(newStore(server.URL, "old-droplets"))).To(BeTrue())
+		Expect(dst.CanCopyFrom(newStore("http://some-other-endpoint", "old-droplets"))).To(BeFalse())
+		Expect(dst.CanCopyFrom(blobstore.NewNFS("/some/path"))).To(BeFalse())
+	})
+
+	It("copies the object with its checksum", func() {
+		src := newStore(server.URL, "old-droplets")
+		dst := newStore(server.URL, "new-droplets").(blobstore.ServerSideCopier)
+
+		blob := &blobstore.Blob{Path: "cc-droplets/ab/cd/some droplet", Checksum: "some-checksum", Size: 7}
+		Expect(dst.CopyFrom(src, blob)).To(Succeed())
+
+		var header http.Header
+		Eventually(headers).Should(Receive(&header))
+		Expect(header.Get("X-Amz-Copy-Source")).To(Equal("old-droplets/ab/cd/some%20droplet"))
+		Expect(header.Get("X-Amz-Metadata-Directive")).To(Equal("REPLACE"))
+		Expect(header.Get("X-Amz-Meta-Checksum")).To(Equal("some-checksum"))
+		Eventually(paths).Should(Receive(Equal("/new-droplets/ab/cd/some droplet")))
+	})
+
+	It("stops copying parts once one fails and aborts the upload", func() {
+		src := newStore(server.URL, "old-droplets")
+		dst := newStore(server.URL, "new-droplets", blobstore.WithS3UploadConcurrency(1)).(blobstore.ServerSideCopier)
+
+		blob := &blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet", Checksum: "some-checksum", Size: 6 * 1024 * blobstore.MiB}
+		err := dst.CopyFrom(src, blob)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("error copying part 1"))
+
+		Eventually(aborts).Should(Receive(Equal("some-upload")))
+		Expect(partRequests).To(HaveLen(1))
+	})
+
+	It("checksums a copy from its ETag rather than the checksum it was given", func() {
+		dst := newStore(server.URL, "new-droplets").(blobstore.ServerSideCopier)
+
+		checksum, err := dst.CopiedChecksum(&blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet", Checksum: "some-checksum"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checksum).To(Equal(fmt.Sprintf("%x", md5.Sum([]byte("other content")))))
+		Expect(checksum).NotTo(Equal("some-checksum"))
+	})
+
+	It("reads back a copy whose ETag is not an MD5", func() {
+		dst := newStore(server.URL, "new-droplets").(blobstore.ServerSideCopier)
+
+		checksum, err := dst.CopiedChecksum(&blobstore.Blob{Path: "cc-droplets/ab/cd/large-droplet", Checksum: "some-checksum"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checksum).To(Equal(fmt.Sprintf("%x", md5.Sum([]byte("other content")))))
+	})
+})
@@ -0,0 +1,174 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// linkLocalTimeout is short because the metadata service answers at once
+// when it is there at all
+const linkLocalTimeout = 5 * time.Second
+
+const (
+	// S3CredentialSourceStatic uses the given access key and secret key
+	S3CredentialSourceStatic = "static"
+	// S3CredentialSourceEnv reads AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	S3CredentialSourceEnv = "env"
+	// S3CredentialSourceShared reads a profile from ~/.aws/credentials
+	S3CredentialSourceShared = "shared"
+	// S3CredentialSourceInstance asks the EC2 instance metadata service or the
+	// ECS task credentials endpoint
+	S3CredentialSourceInstance = "instance"
+	// S3CredentialSourceDefault tries env, shared and instance in turn
+	S3CredentialSourceDefault = "default"
+)
+
+// S3Credentials describes where the credentials used to access S3 come from
+type S3Credentials struct {
+	Source string
+
+	AccessKey string
+	SecretKey string
+
+	Profile               string
+	SharedCredentialsFile string
+
+	// MetadataEndpoint overrides the EC2 instance metadata endpoint,
+	// e.g. http://169.254.169.254/latest
+	MetadataEndpoint string
+
+	RoleARN         string
+	ExternalID      string
+	RoleSessionName string
+	STSEndpoint     string
+	Region          string
+
+	// HTTPClient is used to talk to STS; the SDK default client is used
+	// when it is nil. The instance metadata service and the ECS credentials
+	// endpoint are always reached directly, as a proxy cannot reach them.
+	HTTPClient *http.Client
+}
+
+// WithS3Credentials signs requests with the given credentials instead of the
+// static access key and secret key
+func WithS3Credentials(creds *credentials.Credentials) S3Option {
+	return func(s *s3Store) {
+		s.session.Config.Credentials = creds
+	}
+}
+
+// NewS3Credentials builds credentials from the configured source, optionally
+// exchanging them for the credentials of an assumed role
+func NewS3Credentials(c S3Credentials) (*credentials.Credentials, error) {
+	source := c.Source
+	if source == "" {
+		source = S3CredentialSourceDefault
+		if c.AccessKey != "" {
+			source = S3CredentialSourceStatic
+		}
+	}
+
+	var creds *credentials.Credentials
+	switch source {
+	case S3CredentialSourceStatic:
+		if c.AccessKey == "" || c.SecretKey == "" {
+			return nil, errors.New("static credentials require an access key and a secret key")
+		}
+		creds = credentials.NewStaticCredentials(c.AccessKey, c.SecretKey, "")
+	case S3CredentialSourceEnv:
+		creds = credentials.NewEnvCredentials()
+	case S3CredentialSourceShared:
+		creds = credentials.NewSharedCredentials(c.SharedCredentialsFile, c.Profile)
+	case S3CredentialSourceInstance:
+		creds = credentials.NewCredentials(c.instanceProvider())
+	case S3CredentialSourceDefault:
+		creds = credentials.NewCredentials(&credentials.ChainProvider{
+			VerboseErrors: true,
+			Providers: []credentials.Provider{
+				&credentials.EnvProvider{},
+				&credentials.SharedCredentialsProvider{
+					Filename: c.SharedCredentialsFile,
+					Profile:  c.Profile,
+				},
+				c.instanceProvider(),
+			},
+		})
+	default:
+		return nil, fmt.Errorf("unknown credential source %q", c.Source)
+	}
+
+	if c.RoleARN == "" {
+		return creds, nil
+	}
+
+	stsConfig := &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(c.Region),
+	}
+	if c.HTTPClient != nil {
+		stsConfig.HTTPClient = c.HTTPClient
+	}
+	if c.STSEndpoint != "" {
+		stsConfig.Endpoint = aws.String(c.STSEndpoint)
+	}
+
+	return stscreds.NewCredentials(session.New(stsConfig), c.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		if c.ExternalID != "" {
+			p.ExternalID = aws.String(c.ExternalID)
+		}
+		if c.RoleSessionName != "" {
+			p.RoleSessionName = c.RoleSessionName
+		}
+	}), nil
+}
+
+func (c S3Credentials) instanceProvider() credentials.Provider {
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" ||
+		os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		remoteConfig := defaults.Config().WithHTTPClient(newLinkLocalHTTPClient())
+		return defaults.RemoteCredProvider(*remoteConfig, defaults.Handlers())
+	}
+
+	metadataConfig := &aws.Config{HTTPClient: newLinkLocalHTTPClient()}
+	if c.MetadataEndpoint != "" {
+		metadataConfig.Endpoint = aws.String(c.MetadataEndpoint)
+	}
+
+	return &ec2rolecreds.EC2RoleProvider{
+		Client: ec2metadata.New(session.New(metadataConfig)),
+	}
+}
+
+// newLinkLocalHTTPClient creates a client for the link-local credential
+// endpoints, which never goes through a proxy
+func newLinkLocalHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout:   linkLocalTimeout,
+		Transport: &http.Transport{Proxy: nil},
+	}
+}
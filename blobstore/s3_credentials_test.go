@@ -0,0 +1,235 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>assumed-access-key</AccessKeyId>
+      <SecretAccessKey>assumed-secret-key</SecretAccessKey>
+      <SessionToken>assumed-token</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/some-role/goblob</Arn>
+      <AssumedRoleId>some-role-id:goblob</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata>
+    <RequestId>some-request-id</RequestId>
+  </ResponseMetadata>
+</AssumeRoleResponse>`
+
+// recordingTransport remembers the host of every request it sends
+type recordingTransport struct {
+	mutex sync.Mutex
+	hosts []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	t.hosts = append(t.hosts, req.URL.Host)
+	t.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (t *recordingTransport) Hosts() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.hosts...)
+}
+
+var _ = Describe("NewS3Credentials", func() {
+	var metadataServer *httptest.Server
+
+	BeforeEach(func() {
+		metadataServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSuffix(r.URL.Path, "/") {
+			case "/latest/api/token":
+				fmt.Fprint(w, "some-metadata-token")
+			case "/latest/meta-data/iam/security-credentials":
+				fmt.Fprint(w, "some-role")
+			case "/latest/meta-data/iam/security-credentials/some-role":
+				fmt.Fprint(w, `{
+  "Code": "Success",
+  "AccessKeyId": "instance-access-key",
+  "SecretAccessKey": "instance-secret-key",
+  "Token": "instance-token",
+  "Expiration": "2099-01-01T00:00:00Z"
+}`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		metadataServer.Close()
+	})
+
+	It("uses static credentials when an access key is given", func() {
+		creds, err := blobstore.NewS3Credentials(blobstore.S3Credentials{
+			AccessKey: "some-access-key",
+			SecretKey: "some-secret-key",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		value, err := creds.Get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("some-access-key"))
+		Expect(value.SecretAccessKey).To(Equal("some-secret-key"))
+	})
+
+	It("rejects static credentials without a secret key", func() {
+		_, err := blobstore.NewS3Credentials(blobstore.S3Credentials{
+			Source:    blobstore.S3CredentialSourceStatic,
+			AccessKey: "some-access-key",
+		})
+		Expect(err).To(MatchError("static credentials require an access key and a secret key"))
+	})
+
+	It("rejects unknown sources", func() {
+		_, err := blobstore.NewS3Credentials(blobstore.S3Credentials{Source: "vault"})
+		Expect(err).To(MatchError(`unknown credential source "vault"`))
+	})
+
+	It("reads credentials from a shared credentials file", func() {
+		dir, err := ioutil.TempDir("", "s3-credentials-test")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		credentialsFile := filepath.Join(dir, "credentials")
+		err = ioutil.WriteFile(credentialsFile, []byte(`[default]
+aws_access_key_id = default-access-key
+aws_secret_access_key = default-secret-key
+
+[migration]
+aws_access_key_id = profile-access-key
+aws_secret_access_key = profile-secret-key
+`), 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		creds, err := blobstore.NewS3Credentials(blobstore.S3Credentials{
+			Source:                blobstore.S3CredentialSourceShared,
+			Profile:               "migration",
+			SharedCredentialsFile: credentialsFile,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		value, err := creds.Get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("profile-access-key"))
+	})
+
+	It("fetches credentials from the instance metadata service", func() {
+		creds, err := blobstore.NewS3Credentials(blobstore.S3Credentials{
+			Source:           blobstore.S3CredentialSourceInstance,
+			MetadataEndpoint: metadataServer.URL + "/latest",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		value, err := creds.Get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("instance-access-key"))
+		Expect(value.SecretAccessKey).To(Equal("instance-secret-key"))
+		Expect(value.SessionToken).To(Equal("instance-token"))
+	})
+
+	Context("when a role is given", func() {
+		var (
+			stsServer *httptest.Server
+			form      chan map[string][]string
+		)
+
+		BeforeEach(func() {
+			form = make(chan map[string][]string, 1)
+			stsServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.ParseForm()).To(Succeed())
+				form <- r.PostForm
+				w.Header().Set("Content-Type", "text/xml")
+				fmt.Fprint(w, assumeRoleResponse)
+			}))
+		})
+
+		AfterEach(func() {
+			stsServer.Close()
+		})
+
+		It("assumes the role with the base credentials", func() {
+			creds, err := blobstore.NewS3Credentials(blobstore.S3Credentials{
+				Source:           blobstore.S3CredentialSourceInstance,
+				MetadataEndpoint: metadataServer.URL + "/latest",
+				RoleARN:          "arn:aws:iam::123456789012:role/some-role",
+				ExternalID:       "some-external-id",
+				RoleSessionName:  "goblob",
+				STSEndpoint:      stsServer.URL,
+				Region:           "us-east-1",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			value, err := creds.Get()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value.AccessKeyID).To(Equal("assumed-access-key"))
+			Expect(value.SessionToken).To(Equal("assumed-token"))
+
+			var received map[string][]string
+			Eventually(form).Should(Receive(&received))
+			Expect(received["Action"]).To(ConsistOf("AssumeRole"))
+			Expect(received["RoleArn"]).To(ConsistOf("arn:aws:iam::123456789012:role/some-role"))
+			Expect(received["ExternalId"]).To(ConsistOf("some-external-id"))
+			Expect(received["RoleSessionName"]).To(ConsistOf("goblob"))
+		})
+
+		It("talks to STS with the given HTTP client and to the metadata service directly", func() {
+			transport := &recordingTransport{}
+			creds, err := blobstore.NewS3Credentials(blobstore.S3Credentials{
+				Source:           blobstore.S3CredentialSourceInstance,
+				MetadataEndpoint: metadataServer.URL + "/latest",
+				RoleARN:          "arn:aws:iam::123456789012:role/some-role",
+				STSEndpoint:      stsServer.URL,
+				Region:           "us-east-1",
+				HTTPClient:       &http.Client{Transport: transport},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = creds.Get()
+			Expect(err).NotTo(HaveOccurred())
+
+			metadataURL, err := url.Parse(metadataServer.URL)
+			Expect(err).NotTo(HaveOccurred())
+			stsURL, err := url.Parse(stsServer.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(transport.Hosts()).To(ContainElement(stsURL.Host))
+			Expect(transport.Hosts()).NotTo(ContainElement(metadataURL.Host))
+		})
+	})
+})
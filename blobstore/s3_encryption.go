@@ -0,0 +1,172 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// S3EncryptionAES256 encrypts objects with S3 managed keys (SSE-S3)
+	S3EncryptionAES256 = "AES256"
+	// S3EncryptionKMS encrypts objects with a KMS managed key (SSE-KMS)
+	S3EncryptionKMS = "aws:kms"
+	// S3EncryptionCustomerKey encrypts objects with a key supplied by the
+	// client on every request (SSE-C)
+	S3EncryptionCustomerKey = "SSE-C"
+
+	sseContextHeader     = "X-Amz-Server-Side-Encryption-Context"
+	sseCustomerAlgorithm = "AES256"
+	sseCustomerKeyLength = 32
+)
+
+// S3Encryption describes the server-side encryption applied to objects
+// written to an S3 blobstore
+type S3Encryption struct {
+	Mode        string
+	KMSKeyID    string
+	KMSContext  map[string]string
+	CustomerKey []byte
+}
+
+// WithS3Encryption encrypts every object written to the store
+func WithS3Encryption(encryption S3Encryption) S3Option {
+	return func(s *s3Store) {
+		s.encryption = encryption
+	}
+}
+
+// Validate checks that the settings required by the encryption mode are given
+func (e S3Encryption) Validate() error {
+	switch e.Mode {
+	case "":
+		if e.KMSKeyID != "" || len(e.KMSContext) > 0 || len(e.CustomerKey) > 0 {
+			return errors.New("encryption settings given without an encryption mode")
+		}
+	case S3EncryptionAES256:
+		if e.KMSKeyID != "" || len(e.KMSContext) > 0 || len(e.CustomerKey) > 0 {
+			return fmt.Errorf("%s encryption does not take a key", S3EncryptionAES256)
+		}
+	case S3EncryptionKMS:
+		if len(e.CustomerKey) > 0 {
+			return fmt.Errorf("%s encryption does not take a customer key", S3EncryptionKMS)
+		}
+	case S3EncryptionCustomerKey:
+		if len(e.CustomerKey) != sseCustomerKeyLength {
+			return fmt.Errorf("%s encryption requires a %d byte customer key", S3EncryptionCustomerKey, sseCustomerKeyLength)
+		}
+		if e.KMSKeyID != "" || len(e.KMSContext) > 0 {
+			return fmt.Errorf("%s encryption does not take a KMS key", S3EncryptionCustomerKey)
+		}
+	default:
+		return fmt.Errorf("unknown encryption mode %q", e.Mode)
+	}
+	return nil
+}
+
+// ReadS3CustomerKey reads an SSE-C key from a file containing either the raw
+// 32 byte key or its base64 encoding
+func ReadS3CustomerKey(path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) == sseCustomerKeyLength {
+		return contents, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil || len(key) != sseCustomerKeyLength {
+		return nil, fmt.Errorf("%s does not contain a %d byte key", path, sseCustomerKeyLength)
+	}
+	return key, nil
+}
+
+// etagIsMD5 reports whether S3 will return the MD5 of the object content as
+// its ETag. Objects encrypted with KMS or customer keys get opaque ETags.
+func (e S3Encryption) etagIsMD5() bool {
+	return e.Mode == "" || e.Mode == S3EncryptionAES256
+}
+
+func (e S3Encryption) customerKey() (*string, *string) {
+	if e.Mode != S3EncryptionCustomerKey {
+		return nil, nil
+	}
+	return aws.String(sseCustomerAlgorithm), aws.String(string(e.CustomerKey))
+}
+
+func (e S3Encryption) serverSideEncryption() (*string, *string) {
+	switch e.Mode {
+	case S3EncryptionAES256:
+		return aws.String(S3EncryptionAES256), nil
+	case S3EncryptionKMS:
+		if e.KMSKeyID == "" {
+			return aws.String(S3EncryptionKMS), nil
+		}
+		return aws.String(S3EncryptionKMS), aws.String(e.KMSKeyID)
+	}
+	return nil, nil
+}
+
+func (e S3Encryption) applyToPutObject(input *awss3.PutObjectInput) {
+	input.ServerSideEncryption, input.SSEKMSKeyId = e.serverSideEncryption()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = e.customerKey()
+}
+
+func (e S3Encryption) applyToUpload(input *s3manager.UploadInput) {
+	input.ServerSideEncryption, input.SSEKMSKeyId = e.serverSideEncryption()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = e.customerKey()
+}
+
+func (e S3Encryption) applyToHeadObject(input *awss3.HeadObjectInput) {
+	input.SSECustomerAlgorithm, input.SSECustomerKey = e.customerKey()
+}
+
+func (e S3Encryption) applyToGetObject(input *awss3.GetObjectInput) {
+	input.SSECustomerAlgorithm, input.SSECustomerKey = e.customerKey()
+}
+
+// writeOptions sets the KMS encryption context, which the pinned SDK does
+// not model on PutObject, CopyObject or CreateMultipartUpload.
+func (e S3Encryption) writeOptions() ([]request.Option, error) {
+	if e.Mode != S3EncryptionKMS || len(e.KMSContext) == 0 {
+		return nil, nil
+	}
+
+	encryptionContext, err := json.Marshal(e.KMSContext)
+	if err != nil {
+		return nil, err
+	}
+	value := base64.StdEncoding.EncodeToString(encryptionContext)
+
+	return []request.Option{
+		func(r *request.Request) {
+			switch r.Operation.Name {
+			case "PutObject", "CopyObject", "CreateMultipartUpload":
+				r.HTTPRequest.Header.Set(sseContextHeader, value)
+			}
+		},
+	}, nil
+}
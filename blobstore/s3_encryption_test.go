@@ -0,0 +1,114 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3Encryption", func() {
+	key := []byte(strings.Repeat("k", 32))
+
+	Describe("Validate", func() {
+		It("accepts no encryption", func() {
+			Expect(blobstore.S3Encryption{}.Validate()).To(Succeed())
+		})
+
+		It("accepts AES256 encryption", func() {
+			Expect(blobstore.S3Encryption{Mode: blobstore.S3EncryptionAES256}.Validate()).To(Succeed())
+		})
+
+		It("accepts KMS encryption with a key ID and context", func() {
+			encryption := blobstore.S3Encryption{
+				Mode:       blobstore.S3EncryptionKMS,
+				KMSKeyID:   "some-key-id",
+				KMSContext: map[string]string{"foundation": "some-foundation"},
+			}
+			Expect(encryption.Validate()).To(Succeed())
+		})
+
+		It("accepts SSE-C encryption with a 32 byte key", func() {
+			encryption := blobstore.S3Encryption{
+				Mode:        blobstore.S3EncryptionCustomerKey,
+				CustomerKey: key,
+			}
+			Expect(encryption.Validate()).To(Succeed())
+		})
+
+		It("rejects SSE-C encryption with a short key", func() {
+			encryption := blobstore.S3Encryption{
+				Mode:        blobstore.S3EncryptionCustomerKey,
+				CustomerKey: []byte("short"),
+			}
+			Expect(encryption.Validate()).To(MatchError("SSE-C encryption requires a 32 byte customer key"))
+		})
+
+		It("rejects a KMS key without an encryption mode", func() {
+			encryption := blobstore.S3Encryption{KMSKeyID: "some-key-id"}
+			Expect(encryption.Validate()).To(MatchError("encryption settings given without an encryption mode"))
+		})
+
+		It("rejects unknown modes", func() {
+			encryption := blobstore.S3Encryption{Mode: "rot13"}
+			Expect(encryption.Validate()).To(MatchError(`unknown encryption mode "rot13"`))
+		})
+	})
+
+	Describe("ReadS3CustomerKey", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "s3-encryption-test")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("reads a raw key", func() {
+			path := filepath.Join(dir, "raw")
+			Expect(ioutil.WriteFile(path, key, 0600)).To(Succeed())
+
+			Expect(blobstore.ReadS3CustomerKey(path)).To(Equal(key))
+		})
+
+		It("reads a base64 encoded key", func() {
+			path := filepath.Join(dir, "encoded")
+			encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+			Expect(ioutil.WriteFile(path, []byte(encoded), 0600)).To(Succeed())
+
+			Expect(blobstore.ReadS3CustomerKey(path)).To(Equal(key))
+		})
+
+		It("rejects a key of the wrong length", func() {
+			path := filepath.Join(dir, "short")
+			Expect(ioutil.WriteFile(path, []byte("short"), 0600)).To(Succeed())
+
+			_, err := blobstore.ReadS3CustomerKey(path)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,183 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3ObjectSettings describes the storage class and tags given to objects
+// written to an S3 blobstore
+type S3ObjectSettings struct {
+	// StorageClass applies to buckets without an entry in StorageClasses;
+	// empty leaves the endpoint's default
+	StorageClass string
+	// StorageClasses maps a Cloud Controller bucket, e.g. cc-droplets, to
+	// the storage class of its objects
+	StorageClasses map[string]string
+
+	// Tags is a comma-separated list of key=value pairs whose values are
+	// templates, e.g. foundation={{.Foundation}},type={{.Bucket}}
+	Tags string
+	// Foundation is available to tag templates as {{.Foundation}}
+	Foundation string
+}
+
+// s3TagData is what tag templates are rendered with
+type s3TagData struct {
+	Foundation string
+	Bucket     string
+	BucketName string
+}
+
+type s3Tag struct {
+	key   string
+	value *template.Template
+}
+
+// WithS3ObjectSettings sets the storage class and tags of every object
+// written to the store
+func WithS3ObjectSettings(settings S3ObjectSettings) S3Option {
+	return func(s *s3Store) {
+		s.objectSettings = settings
+	}
+}
+
+// Validate checks the buckets are known, the storage classes can be read
+// back for verification and the tag templates parse
+func (o S3ObjectSettings) Validate() error {
+	for bucket, storageClass := range o.StorageClasses {
+		if !isBucket(bucket) {
+			return fmt.Errorf("unknown bucket %q, expected one of %s", bucket, strings.Join(buckets, ", "))
+		}
+		if err := validateStorageClass(storageClass); err != nil {
+			return err
+		}
+	}
+	if err := validateStorageClass(o.StorageClass); err != nil {
+		return err
+	}
+
+	_, err := o.tagging(buckets[0], buckets[0])
+	return err
+}
+
+func isBucket(name string) bool {
+	for _, bucket := range buckets {
+		if bucket == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateStorageClass rejects the archive classes, whose objects cannot be
+// read back to verify them without first being restored. Other values are
+// passed through so vendor-specific classes can be used.
+func validateStorageClass(storageClass string) error {
+	switch storageClass {
+	case awss3.StorageClassGlacier, "DEEP_ARCHIVE":
+		return fmt.Errorf("storage class %s cannot be used: objects must be readable to verify them", storageClass)
+	}
+	if strings.ContainsAny(storageClass, " \t\r\n") {
+		return fmt.Errorf("invalid storage class %q", storageClass)
+	}
+	return nil
+}
+
+func (o S3ObjectSettings) tags() ([]s3Tag, error) {
+	if strings.TrimSpace(o.Tags) == "" {
+		return nil, nil
+	}
+
+	var tags []s3Tag
+	for _, pair := range strings.Split(o.Tags, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+
+		value, err := template.New(key).Parse(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag %q: %s", pair, err)
+		}
+		tags = append(tags, s3Tag{key: key, value: value})
+	}
+	return tags, nil
+}
+
+func (o S3ObjectSettings) storageClass(bucket string) *string {
+	if storageClass, ok := o.StorageClasses[bucket]; ok && storageClass != "" {
+		return aws.String(storageClass)
+	}
+	if o.StorageClass != "" {
+		return aws.String(o.StorageClass)
+	}
+	return nil
+}
+
+// tagging renders the tags for an object in the given Cloud Controller
+// bucket as the query string S3 expects in the x-amz-tagging header
+func (o S3ObjectSettings) tagging(bucket, bucketName string) (*string, error) {
+	tags, err := o.tags()
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+
+	data := s3TagData{
+		Foundation: o.Foundation,
+		Bucket:     bucket,
+		BucketName: bucketName,
+	}
+
+	values := url.Values{}
+	for _, tag := range tags {
+		var value bytes.Buffer
+		if err := tag.value.Execute(&value, data); err != nil {
+			return nil, fmt.Errorf("error rendering tag %s: %s", tag.key, err)
+		}
+		values.Set(tag.key, value.String())
+	}
+	return aws.String(values.Encode()), nil
+}
+
+func (o S3ObjectSettings) applyToPutObject(input *awss3.PutObjectInput, bucket string) error {
+	tagging, err := o.tagging(bucket, aws.StringValue(input.Bucket))
+	if err != nil {
+		return err
+	}
+	input.StorageClass = o.storageClass(bucket)
+	input.Tagging = tagging
+	return nil
+}
+
+func (o S3ObjectSettings) applyToUpload(input *s3manager.UploadInput, bucket string) error {
+	tagging, err := o.tagging(bucket, aws.StringValue(input.Bucket))
+	if err != nil {
+		return err
+	}
+	input.StorageClass = o.storageClass(bucket)
+	input.Tagging = tagging
+	return nil
+}
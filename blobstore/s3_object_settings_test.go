@@ -0,0 +1,119 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3ObjectSettings", func() {
+	Describe("Validate", func() {
+		It("accepts no settings", func() {
+			Expect(blobstore.S3ObjectSettings{}.Validate()).To(Succeed())
+		})
+
+		It("accepts vendor-specific storage classes", func() {
+			settings := blobstore.S3ObjectSettings{
+				StorageClass:   "COLD",
+				StorageClasses: map[string]string{"cc-droplets": "GLACIER_IR"},
+			}
+			Expect(settings.Validate()).To(Succeed())
+		})
+
+		It("rejects unknown buckets", func() {
+			settings := blobstore.S3ObjectSettings{StorageClasses: map[string]string{"droplets": "STANDARD_IA"}}
+			Expect(settings.Validate()).To(MatchError(ContainSubstring(`unknown bucket "droplets"`)))
+		})
+
+		It("rejects archive storage classes", func() {
+			settings := blobstore.S3ObjectSettings{StorageClasses: map[string]string{"cc-packages": "GLACIER"}}
+			Expect(settings.Validate()).To(MatchError(ContainSubstring("storage class GLACIER cannot be used")))
+		})
+
+		It("rejects tags that are not key=value pairs", func() {
+			settings := blobstore.S3ObjectSettings{Tags: "foundation"}
+			Expect(settings.Validate()).To(MatchError(`invalid tag "foundation", expected key=value`))
+		})
+
+		It("rejects tags that refer to unknown fields", func() {
+			settings := blobstore.S3ObjectSettings{Tags: "owner={{.Owner}}"}
+			Expect(settings.Validate()).To(MatchError(ContainSubstring("error rendering tag owner")))
+		})
+	})
+
+	Describe("writing objects", func() {
+		var (
+			server  *httptest.Server
+			headers chan http.Header
+		)
+
+		BeforeEach(func() {
+			headers = make(chan http.Header, 1)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "GET":
+					fmt.Fprint(w, `<ListAllMyBucketsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Owner><ID>some-owner</ID><DisplayName>some-owner</DisplayName></Owner>
+  <Buckets><Bucket><Name>some-droplets</Name></Bucket></Buckets>
+</ListAllMyBucketsResult>`)
+				case "PUT":
+					headers <- r.Header
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("sets the bucket's storage class and the rendered tags", func() {
+			store := blobstore.NewS3(
+				"some-access-key", "some-secret-key", "us-east-1", server.URL,
+				false, true, false,
+				"some-buildpacks", "some-droplets", "some-packages", "some-resources",
+				blobstore.WithS3ObjectSettings(blobstore.S3ObjectSettings{
+					StorageClass:   "STANDARD_IA",
+					StorageClasses: map[string]string{"cc-droplets": "ONEZONE_IA"},
+					Tags:           "foundation={{.Foundation}},type={{.Bucket}},bucket={{.BucketName}}",
+					Foundation:     "some foundation",
+				}),
+			)
+
+			err := store.Write(&blobstore.Blob{Path: "cc-droplets/ab/cd/some-droplet"}, strings.NewReader("content"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var header http.Header
+			Eventually(headers).Should(Receive(&header))
+			Expect(header.Get("X-Amz-Storage-Class")).To(Equal("ONEZONE_IA"))
+
+			tags, err := url.ParseQuery(header.Get("X-Amz-Tagging"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tags).To(Equal(url.Values{
+				"foundation": {"some foundation"},
+				"type":       {"cc-droplets"},
+				"bucket":     {"some-droplets"},
+			}))
+		})
+	})
+})
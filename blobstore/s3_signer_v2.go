@@ -0,0 +1,162 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// s3V2SubResources are the query parameters that form part of the resource
+// signed by AWS signature version 2
+var s3V2SubResources = map[string]bool{
+	"acl":                          true,
+	"cors":                         true,
+	"delete":                       true,
+	"encryption":                   true,
+	"lifecycle":                    true,
+	"location":                     true,
+	"logging":                      true,
+	"notification":                 true,
+	"partNumber":                   true,
+	"policy":                       true,
+	"requestPayment":               true,
+	"response-cache-control":       true,
+	"response-content-disposition": true,
+	"response-content-encoding":    true,
+	"response-content-language":    true,
+	"response-content-type":        true,
+	"response-expires":             true,
+	"restore":                      true,
+	"tagging":                      true,
+	"torrent":                      true,
+	"uploadId":                     true,
+	"uploads":                      true,
+	"versionId":                    true,
+	"versioning":                   true,
+	"versions":                     true,
+	"website":                      true,
+}
+
+var signS3V2Handler = request.NamedHandler{
+	Name: "goblob.SignS3V2Handler",
+	Fn:   signS3V2,
+}
+
+// signS3V2 signs a request with AWS signature version 2 for S3, which older
+// S3-compatible appliances accept instead of version 4
+func signS3V2(r *request.Request) {
+	if r.Config.Credentials == credentials.AnonymousCredentials {
+		return
+	}
+
+	creds, err := r.Config.Credentials.Get()
+	if err != nil {
+		r.Error = err
+		return
+	}
+
+	header := r.HTTPRequest.Header
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if creds.SessionToken != "" {
+		header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	mac := hmac.New(sha1.New, []byte(creds.SecretAccessKey))
+	mac.Write([]byte(s3V2StringToSign(r.HTTPRequest, s3V2Bucket(r))))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	header.Set("Authorization", "AWS "+creds.AccessKeyID+":"+signature)
+}
+
+func s3V2StringToSign(req *http.Request, virtualHostBucket string) string {
+	var amzHeaders []string
+	for key, values := range req.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-amz-") {
+			amzHeaders = append(amzHeaders, key+":"+strings.Join(values, ","))
+		}
+	}
+	sort.Strings(amzHeaders)
+
+	var buf strings.Builder
+	buf.WriteString(req.Method + "\n")
+	buf.WriteString(req.Header.Get("Content-MD5") + "\n")
+	buf.WriteString(req.Header.Get("Content-Type") + "\n")
+	buf.WriteString(req.Header.Get("Date") + "\n")
+	for _, amzHeader := range amzHeaders {
+		buf.WriteString(amzHeader + "\n")
+	}
+
+	if virtualHostBucket != "" {
+		buf.WriteString("/" + virtualHostBucket)
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	buf.WriteString(path)
+	buf.WriteString(s3V2SubResourceQuery(req.URL.Query()))
+
+	return buf.String()
+}
+
+func s3V2SubResourceQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		if s3V2SubResources[key] {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		value := query.Get(key)
+		if value == "" {
+			parts = append(parts, key)
+		} else {
+			parts = append(parts, key+"="+value)
+		}
+	}
+	return "?" + strings.Join(parts, "&")
+}
+
+// s3V2Bucket returns the bucket that virtual-hosted style addressing moved
+// from the path into the host name
+func s3V2Bucket(r *request.Request) string {
+	endpoint, err := url.Parse(r.ClientInfo.Endpoint)
+	if err != nil {
+		return ""
+	}
+
+	host := r.HTTPRequest.URL.Host
+	if host == endpoint.Host || !strings.HasSuffix(host, "."+endpoint.Host) {
+		return ""
+	}
+	return strings.TrimSuffix(host, "."+endpoint.Host)
+}
@@ -0,0 +1,29 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+//go:generate counterfeiter . ServerSideCopier
+
+// ServerSideCopier is implemented by blobstores that can copy blobs from
+// another blobstore without the content passing through goblob
+type ServerSideCopier interface {
+	// CanCopyFrom reports whether blobs in src can be copied server side
+	CanCopyFrom(src Blobstore) bool
+	// CopyFrom copies blob from src to the same path in this blobstore
+	CopyFrom(src Blobstore, blob *Blob) error
+	// CopiedChecksum returns the checksum of the copied content, without
+	// reading it back where the blobstore already has its MD5
+	CopiedChecksum(blob *Blob) (string, error)
+}
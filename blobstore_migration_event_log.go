@@ -0,0 +1,236 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/logging"
+)
+
+// Event types written by the JSON migration watcher
+const (
+	EventMigrationStarted    = "migration_started"
+	EventMigrationFinished   = "migration_finished"
+	EventBucketStarted       = "bucket_started"
+	EventBucketFinished      = "bucket_finished"
+	EventBlobMigrated        = "blob_migrated"
+	EventBlobAlreadyMigrated = "blob_already_migrated"
+	EventBlobFailed          = "blob_failed"
+	EventBlobFiltered        = "blob_filtered"
+)
+
+// MigrationEvent is one line of the JSON migration log
+type MigrationEvent struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Bucket      string    `json:"bucket,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	Checksum    string    `json:"checksum,omitempty"`
+	// Bytes is how many bytes were uploaded
+	Bytes int64 `json:"bytes,omitempty"`
+	// Duration is in seconds
+	Duration float64 `json:"duration,omitempty"`
+	Attempt  int     `json:"attempt,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+// NewJSONMigrationWatcher writes a MigrationEvent to w as a line of JSON
+// for everything that happens during a migration, as an audit record. It
+// prints nothing itself, so it is usually combined with the console watcher
+// using NewFanOutMigrationWatcher.
+func NewJSONMigrationWatcher(w io.Writer) BlobstoreMigrationWatcher {
+	return &jsonMigrationWatcher{
+		encoder: json.NewEncoder(w),
+		now:     time.Now,
+	}
+}
+
+type jsonMigrationWatcher struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	now     func() time.Time
+	failed  bool
+
+	migrationStart time.Time
+}
+
+func (w *jsonMigrationWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
+	w.write(func(event *MigrationEvent) {
+		w.migrationStart = event.Time
+		event.Event = EventMigrationStarted
+		event.Source = src.Name()
+		event.Destination = dst.Name()
+	})
+}
+
+func (w *jsonMigrationWatcher) MigrationDidFinish() {
+	w.write(func(event *MigrationEvent) {
+		event.Event = EventMigrationFinished
+		event.Duration = event.Time.Sub(w.migrationStart).Seconds()
+	})
+}
+
+func (w *jsonMigrationWatcher) MigrateBucketDidStart(bucket string) {
+	w.write(func(event *MigrationEvent) {
+		event.Event = EventBucketStarted
+		event.Bucket = bucket
+	})
+}
+
+func (w *jsonMigrationWatcher) MigrateBucketDidFinish(bucket BucketEvent) {
+	w.write(func(event *MigrationEvent) {
+		event.Event = EventBucketFinished
+		event.Bucket = bucket.Bucket
+		event.Duration = bucket.Duration.Seconds()
+	})
+}
+
+// MigrateBlobWasQueued is not logged; the log records what happened to
+// blobs rather than the work in progress
+func (w *jsonMigrationWatcher) MigrateBlobWasQueued(BlobEvent) {}
+
+// MigrateBlobDidStart is not logged either
+func (w *jsonMigrationWatcher) MigrateBlobDidStart(BlobEvent) {}
+
+func (w *jsonMigrationWatcher) MigrateBlobDidFailWithError(blob BlobEvent) {
+	w.writeBlob(EventBlobFailed, blob)
+}
+
+func (w *jsonMigrationWatcher) MigrateBlobDidFinish(blob BlobEvent) {
+	w.writeBlob(EventBlobMigrated, blob)
+}
+
+func (w *jsonMigrationWatcher) MigrateBlobAlreadyFinished(blob BlobEvent) {
+	w.writeBlob(EventBlobAlreadyMigrated, blob)
+}
+
+func (w *jsonMigrationWatcher) MigrateBlobWasFiltered(blob BlobEvent) {
+	w.writeBlob(EventBlobFiltered, blob)
+}
+
+func (w *jsonMigrationWatcher) writeBlob(eventType string, blob BlobEvent) {
+	w.write(func(event *MigrationEvent) {
+		event.Event = eventType
+		event.Bucket = blob.Bucket
+		if blob.Blob != nil {
+			event.Path = blob.Blob.Path
+			event.Size = blob.Blob.Size
+			event.Checksum = blob.Blob.Checksum
+		}
+		event.Bytes = blob.Bytes
+		event.Duration = blob.Duration.Seconds()
+		event.Attempt = blob.Attempt
+		if blob.Err != nil {
+			event.Error = blob.Err.Error()
+		}
+		event.Reason = blob.Reason
+	})
+}
+
+// write fills in an event with fill and writes it. Blob events come from
+// many workers at once, so events are written one at a time.
+func (w *jsonMigrationWatcher) write(fill func(*MigrationEvent)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	event := &MigrationEvent{Time: w.now().UTC()}
+	fill(event)
+
+	if w.failed {
+		return
+	}
+	if err := w.encoder.Encode(event); err != nil {
+		// The migration carries on without its log rather than failing
+		// blobs that were migrated successfully.
+		w.failed = true
+		logging.Error("error writing migration event log, no more events will be written", "error", err)
+	}
+}
+
+// NewFanOutMigrationWatcher passes every event to each of watchers in turn
+func NewFanOutMigrationWatcher(watchers ...BlobstoreMigrationWatcher) BlobstoreMigrationWatcher {
+	return fanOutMigrationWatcher(watchers)
+}
+
+type fanOutMigrationWatcher []BlobstoreMigrationWatcher
+
+func (f fanOutMigrationWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
+	for _, w := range f {
+		w.MigrationDidStart(dst, src)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrationDidFinish() {
+	for _, w := range f {
+		w.MigrationDidFinish()
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBucketDidStart(bucket string) {
+	for _, w := range f {
+		w.MigrateBucketDidStart(bucket)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBucketDidFinish(event BucketEvent) {
+	for _, w := range f {
+		w.MigrateBucketDidFinish(event)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBlobWasQueued(event BlobEvent) {
+	for _, w := range f {
+		w.MigrateBlobWasQueued(event)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBlobDidStart(event BlobEvent) {
+	for _, w := range f {
+		w.MigrateBlobDidStart(event)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBlobDidFailWithError(event BlobEvent) {
+	for _, w := range f {
+		w.MigrateBlobDidFailWithError(event)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBlobDidFinish(event BlobEvent) {
+	for _, w := range f {
+		w.MigrateBlobDidFinish(event)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBlobAlreadyFinished(event BlobEvent) {
+	for _, w := range f {
+		w.MigrateBlobAlreadyFinished(event)
+	}
+}
+
+func (f fanOutMigrationWatcher) MigrateBlobWasFiltered(event BlobEvent) {
+	for _, w := range f {
+		w.MigrateBlobWasFiltered(event)
+	}
+}
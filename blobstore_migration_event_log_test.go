@@ -0,0 +1,241 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/workpool"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
+	"github.com/pivotal-cf/goblob/goblobfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON migration watcher", func() {
+	var (
+		buf      *bytes.Buffer
+		watcher  goblob.BlobstoreMigrationWatcher
+		dstStore *blobstorefakes.FakeBlobstore
+		srcStore *blobstorefakes.FakeBlobstore
+	)
+
+	events := func() []goblob.MigrationEvent {
+		var events []goblob.MigrationEvent
+		scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+		for scanner.Scan() {
+			var event goblob.MigrationEvent
+			Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+			events = append(events, event)
+		}
+		return events
+	}
+
+	BeforeEach(func() {
+		buf = new(bytes.Buffer)
+		watcher = goblob.NewJSONMigrationWatcher(buf)
+
+		dstStore = &blobstorefakes.FakeBlobstore{}
+		dstStore.NameReturns("S3")
+		srcStore = &blobstorefakes.FakeBlobstore{}
+		srcStore.NameReturns("NFS")
+	})
+
+	It("writes a line for every event", func() {
+		blob := &blobstore.Blob{
+			Path:     "ab/cd/some-package",
+			Size:     1024,
+			Checksum: "some-checksum",
+		}
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+		watcher.MigrateBucketDidStart("cc-packages")
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{
+			Bucket:   "cc-packages",
+			Blob:     blob,
+			Bytes:    1024,
+			Duration: 1500 * time.Millisecond,
+			Attempt:  2,
+		})
+		watcher.MigrateBlobAlreadyFinished(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Attempt: 1})
+		watcher.MigrateBlobWasFiltered(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Reason: "larger than 2GB"})
+		watcher.MigrateBlobDidFailWithError(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Attempt: 1, Err: errors.New("some-error")})
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-packages", Duration: time.Minute})
+		watcher.MigrationDidFinish()
+
+		Expect(bytes.Count(buf.Bytes(), []byte("\n"))).To(Equal(8))
+
+		written := events()
+		Expect(written).To(HaveLen(8))
+		for _, event := range written {
+			Expect(event.Time).NotTo(BeZero())
+		}
+
+		Expect(written[0].Event).To(Equal(goblob.EventMigrationStarted))
+		Expect(written[0].Source).To(Equal("NFS"))
+		Expect(written[0].Destination).To(Equal("S3"))
+
+		Expect(written[1].Event).To(Equal(goblob.EventBucketStarted))
+		Expect(written[1].Bucket).To(Equal("cc-packages"))
+
+		Expect(written[2].Event).To(Equal(goblob.EventBlobMigrated))
+		Expect(written[2].Bucket).To(Equal("cc-packages"))
+		Expect(written[2].Path).To(Equal("ab/cd/some-package"))
+		Expect(written[2].Size).To(Equal(int64(1024)))
+		Expect(written[2].Checksum).To(Equal("some-checksum"))
+		Expect(written[2].Bytes).To(Equal(int64(1024)))
+		Expect(written[2].Duration).To(Equal(1.5))
+		Expect(written[2].Attempt).To(Equal(2))
+
+		Expect(written[3].Event).To(Equal(goblob.EventBlobAlreadyMigrated))
+		Expect(written[3].Bytes).To(BeZero())
+
+		Expect(written[4].Event).To(Equal(goblob.EventBlobFiltered))
+		Expect(written[4].Reason).To(Equal("larger than 2GB"))
+
+		Expect(written[5].Event).To(Equal(goblob.EventBlobFailed))
+		Expect(written[5].Bucket).To(Equal("cc-packages"))
+		Expect(written[5].Error).To(Equal("some-error"))
+
+		Expect(written[6].Event).To(Equal(goblob.EventBucketFinished))
+		Expect(written[6].Bucket).To(Equal("cc-packages"))
+		Expect(written[6].Duration).To(Equal(60.0))
+
+		Expect(written[7].Event).To(Equal(goblob.EventMigrationFinished))
+		Expect(written[7].Bucket).To(BeEmpty())
+	})
+
+	It("records the path, size, checksum and duration of blobs a migrator migrates", func() {
+		migrated := &blobstore.Blob{Path: "cc-packages/ab/cd/some-package", Size: 1024}
+		failed := &blobstore.Blob{Path: "cc-packages/ab/cd/some-other-package", Size: 2048}
+
+		srcStore.NewBucketIteratorStub = func(bucket string) (blobstore.BucketIterator, error) {
+			iterator := &blobstorefakes.FakeBucketIterator{}
+			if bucket != "cc-packages" {
+				iterator.NextReturns(nil, blobstore.ErrIteratorDone)
+				return iterator, nil
+			}
+			iterator.NextStub = func() (*blobstore.Blob, error) {
+				switch iterator.NextCallCount() {
+				case 1:
+					return migrated, nil
+				case 2:
+					return failed, nil
+				default:
+					return nil, blobstore.ErrIteratorDone
+				}
+			}
+			return iterator, nil
+		}
+		srcStore.ChecksumStub = func(blob *blobstore.Blob) (string, error) {
+			return "checksum-of-" + blob.Path, nil
+		}
+
+		blobMigrator := &goblobfakes.FakeBlobMigrator{}
+		blobMigrator.MigrateStub = func(blob *blobstore.Blob) error {
+			time.Sleep(time.Millisecond)
+			if blob == failed {
+				return errors.New("some-error")
+			}
+			return nil
+		}
+
+		pool, err := workpool.NewWorkPool(1)
+		Expect(err).NotTo(HaveOccurred())
+		migrator := goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher)
+		Expect(migrator.Migrate(dstStore, srcStore)).To(Succeed())
+
+		blobEvents := map[string]goblob.MigrationEvent{}
+		for _, event := range events() {
+			if event.Path != "" {
+				blobEvents[event.Event] = event
+			}
+		}
+		Expect(blobEvents).To(HaveLen(2))
+
+		Expect(blobEvents[goblob.EventBlobMigrated].Path).To(Equal("cc-packages/ab/cd/some-package"))
+		Expect(blobEvents[goblob.EventBlobMigrated].Size).To(Equal(int64(1024)))
+		Expect(blobEvents[goblob.EventBlobMigrated].Checksum).To(Equal("checksum-of-cc-packages/ab/cd/some-package"))
+		Expect(blobEvents[goblob.EventBlobMigrated].Duration).To(BeNumerically(">=", 0.001))
+
+		Expect(blobEvents[goblob.EventBlobFailed].Path).To(Equal("cc-packages/ab/cd/some-other-package"))
+		Expect(blobEvents[goblob.EventBlobFailed].Size).To(Equal(int64(2048)))
+		Expect(blobEvents[goblob.EventBlobFailed].Checksum).To(Equal("checksum-of-cc-packages/ab/cd/some-other-package"))
+		Expect(blobEvents[goblob.EventBlobFailed].Duration).To(BeNumerically(">=", 0.001))
+		Expect(blobEvents[goblob.EventBlobFailed].Error).To(Equal("some-error"))
+	})
+
+	It("leaves out fields an event does not have", func() {
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{
+			Bucket: "cc-packages",
+			Blob:   &blobstore.Blob{Path: "some-path"},
+		})
+
+		Expect(buf.String()).NotTo(ContainSubstring("error"))
+		Expect(buf.String()).NotTo(ContainSubstring("checksum"))
+	})
+})
+
+var _ = Describe("Fan-out migration watcher", func() {
+	It("passes every event to each watcher", func() {
+		first := &goblobfakes.FakeBlobstoreMigrationWatcher{}
+		second := &goblobfakes.FakeBlobstoreMigrationWatcher{}
+		watcher := goblob.NewFanOutMigrationWatcher(first, second)
+
+		dstStore := &blobstorefakes.FakeBlobstore{}
+		srcStore := &blobstorefakes.FakeBlobstore{}
+		event := goblob.BlobEvent{Bucket: "cc-droplets", Blob: &blobstore.Blob{Path: "some-path"}}
+		failed := goblob.BlobEvent{Bucket: "cc-droplets", Err: errors.New("some-error")}
+		filtered := goblob.BlobEvent{Bucket: "cc-droplets", Reason: "some-reason"}
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+		watcher.MigrateBucketDidStart("cc-droplets")
+		watcher.MigrateBlobDidFinish(event)
+		watcher.MigrateBlobAlreadyFinished(event)
+		watcher.MigrateBlobWasFiltered(filtered)
+		watcher.MigrateBlobDidFailWithError(failed)
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-droplets"})
+		watcher.MigrationDidFinish()
+
+		for _, w := range []*goblobfakes.FakeBlobstoreMigrationWatcher{first, second} {
+			Expect(w.MigrationDidStartCallCount()).To(Equal(1))
+			dst, src := w.MigrationDidStartArgsForCall(0)
+			Expect(dst).To(Equal(dstStore))
+			Expect(src).To(Equal(srcStore))
+
+			Expect(w.MigrateBucketDidStartCallCount()).To(Equal(1))
+			Expect(w.MigrateBucketDidStartArgsForCall(0)).To(Equal("cc-droplets"))
+			Expect(w.MigrateBlobDidFinishCallCount()).To(Equal(1))
+			Expect(w.MigrateBlobDidFinishArgsForCall(0)).To(Equal(event))
+			Expect(w.MigrateBlobAlreadyFinishedCallCount()).To(Equal(1))
+			Expect(w.MigrateBlobAlreadyFinishedArgsForCall(0)).To(Equal(event))
+			Expect(w.MigrateBlobWasFilteredCallCount()).To(Equal(1))
+			Expect(w.MigrateBlobWasFilteredArgsForCall(0)).To(Equal(filtered))
+			Expect(w.MigrateBlobDidFailWithErrorCallCount()).To(Equal(1))
+			Expect(w.MigrateBlobDidFailWithErrorArgsForCall(0)).To(Equal(failed))
+			Expect(w.MigrateBucketDidFinishCallCount()).To(Equal(1))
+			Expect(w.MigrateBucketDidFinishArgsForCall(0).Bucket).To(Equal("cc-droplets"))
+			Expect(w.MigrationDidFinishCallCount()).To(Equal(1))
+		}
+	})
+})
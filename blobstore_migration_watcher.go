@@ -17,66 +17,124 @@ package goblob
 import (
 	"bytes"
 	"fmt"
-	"html/template"
+	"io"
+	"io/ioutil"
 	"os"
 	"sync"
 	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/mgutz/ansi"
 	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/logging"
 )
 
 var red = ansi.ColorFunc("red+b")
 var yellow = ansi.ColorFunc("yellow+b")
 var green = ansi.ColorFunc("green+b")
 
+// BlobEvent describes something that happened to one blob
+type BlobEvent struct {
+	Bucket string
+	Blob   *blobstore.Blob
+
+	// Bytes is how many bytes were uploaded
+	Bytes int64
+	// Duration is how long the last attempt took, from checksumming the
+	// blob to the end of its upload
+	Duration time.Duration
+	// Attempt counts from 1. A blob that changes while it is migrated is
+	// tried again.
+	Attempt int
+
+	// Err is why the blob failed to migrate
+	Err error
+	// Reason is why the blob was filtered out
+	Reason string
+}
+
+// BucketEvent describes a bucket whose blobs have all been migrated
+type BucketEvent struct {
+	Bucket   string
+	Duration time.Duration
+}
+
 type BlobstoreMigrationWatcher interface {
 	MigrationDidStart(blobstore.Blobstore, blobstore.Blobstore)
 	MigrationDidFinish()
 
 	MigrateBucketDidStart(string)
-	MigrateBucketDidFinish()
+	MigrateBucketDidFinish(BucketEvent)
 
-	MigrateBlobDidFailWithError(error)
-	MigrateBlobDidFinish()
-	MigrateBlobAlreadyFinished()
+	MigrateBlobWasQueued(BlobEvent)
+	MigrateBlobDidStart(BlobEvent)
+	MigrateBlobDidFailWithError(BlobEvent)
+	MigrateBlobDidFinish(BlobEvent)
+	MigrateBlobAlreadyFinished(BlobEvent)
+	MigrateBlobWasFiltered(BlobEvent)
 }
 
 //go:generate counterfeiter . BlobstoreMigrationWatcher
 
+// NewBlobstoreMigrationWatcher prints a dot for every blob and a summary at
+// the end of the migration
 func NewBlobstoreMigrationWatcher() BlobstoreMigrationWatcher {
-	return &blobstoreMigrationWatcher{
-		stats:       &migrateStats{},
+	return newBlobstoreMigrationWatcher(os.Stdout, true)
+}
+
+// NewBlobstoreMigrationSummaryWatcher prints only the summary at the end of
+// the migration, for use alongside a ProgressWatcher
+func NewBlobstoreMigrationSummaryWatcher() BlobstoreMigrationWatcher {
+	return newBlobstoreMigrationWatcher(os.Stdout, false)
+}
+
+// NewQuietBlobstoreMigrationWatcher prints nothing, only logging the blobs
+// that failed to migrate at the end of the migration
+func NewQuietBlobstoreMigrationWatcher() BlobstoreMigrationWatcher {
+	return newBlobstoreMigrationWatcher(ioutil.Discard, false)
+}
+
+func newBlobstoreMigrationWatcher(out io.Writer, dots bool) BlobstoreMigrationWatcher {
+	return AdaptLegacyWatcher(&blobstoreMigrationWatcher{
+		out:         out,
+		stats:       &migrateStats{Filtered: map[string]int64{}},
 		errorsMutex: &sync.Mutex{},
-	}
+		dots:        dots,
+	})
 }
 
 type blobstoreMigrationWatcher struct {
+	out         io.Writer
 	stats       *migrateStats
 	errors      []error
 	errorsMutex *sync.Mutex
+	dots        bool
 }
 
 func (w *blobstoreMigrationWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
-	fmt.Printf("Migrating from %s to %s\n\n", src.Name(), dst.Name())
+	fmt.Fprintf(w.out, "Migrating from %s to %s\n\n", src.Name(), dst.Name())
 	w.stats.Start()
 }
 
 func (w *blobstoreMigrationWatcher) MigrationDidFinish() {
 	w.stats.Finish()
-	fmt.Println(w.stats)
+	fmt.Fprintln(w.out, w.stats)
 	for i := range w.errors {
-		fmt.Fprintln(os.Stderr, w.errors[i])
+		logging.Error("failed to migrate blob", "error", w.errors[i])
 	}
 }
 
 func (w *blobstoreMigrationWatcher) MigrateBucketDidStart(bucket string) {
-	fmt.Printf("%s ", bucket)
+	if w.dots {
+		fmt.Fprintf(w.out, "%s ", bucket)
+	}
 }
 
 func (w *blobstoreMigrationWatcher) MigrateBucketDidFinish() {
-	fmt.Println(" done.")
+	if w.dots {
+		fmt.Fprintln(w.out, " done.")
+	}
 }
 
 func (w *blobstoreMigrationWatcher) MigrateBlobDidFailWithError(err error) {
@@ -84,25 +142,37 @@ func (w *blobstoreMigrationWatcher) MigrateBlobDidFailWithError(err error) {
 	defer w.errorsMutex.Unlock()
 	w.stats.AddFailed()
 	w.errors = append(w.errors, err)
-	fmt.Print(red("."))
+	w.dot(red)
 }
 
 func (w *blobstoreMigrationWatcher) MigrateBlobDidFinish() {
 	w.stats.AddSuccess()
-	fmt.Print(green("."))
+	w.dot(green)
 }
 
 func (w *blobstoreMigrationWatcher) MigrateBlobAlreadyFinished() {
 	w.stats.AddSkipped()
-	fmt.Print(yellow("."))
+	w.dot(yellow)
+}
+
+func (w *blobstoreMigrationWatcher) MigrateBlobWasFiltered(reason string) {
+	w.stats.AddFiltered(reason)
+}
+
+func (w *blobstoreMigrationWatcher) dot(color func(string) string) {
+	if w.dots {
+		fmt.Fprint(w.out, color("."))
+	}
 }
 
 type migrateStats struct {
-	startTime time.Time
-	Duration  time.Duration
-	Migrated  int64
-	Skipped   int64
-	Failed    int64
+	startTime     time.Time
+	Duration      time.Duration
+	Migrated      int64
+	Skipped       int64
+	Failed        int64
+	filteredMutex sync.Mutex
+	Filtered      map[string]int64
 }
 
 func (m *migrateStats) Start() {
@@ -125,6 +195,12 @@ func (m *migrateStats) AddFailed() {
 	atomic.AddInt64(&m.Failed, 1)
 }
 
+func (m *migrateStats) AddFiltered(reason string) {
+	m.filteredMutex.Lock()
+	defer m.filteredMutex.Unlock()
+	m.Filtered[reason]++
+}
+
 func (m *migrateStats) String() string {
 	t := template.Must(template.New("stats").Parse(`
 Took {{.Duration}}
@@ -132,6 +208,13 @@ Took {{.Duration}}
 Migrated files:    {{.Migrated}}
 Already migrated:  {{.Skipped}}
 Failed to migrate: {{.Failed}}
+{{- if .Filtered}}
+
+Filtered out:
+{{- range $reason, $count := .Filtered}}
+  {{$reason}}: {{$count}}
+{{- end}}
+{{- end}}
 `))
 
 	buf := new(bytes.Buffer)
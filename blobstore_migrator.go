@@ -17,27 +17,112 @@ package goblob
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/workpool"
 
 	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/logging"
 )
 
 var (
 	buckets = []string{"cc-buildpacks", "cc-droplets", "cc-packages", "cc-resources"}
+
+	// blobChangedRetryDelay is how long to wait before retrying a blob that
+	// changed while it was being migrated
+	blobChangedRetryDelay = time.Second
 )
 
+// maxBlobChangedAttempts is how many times a blob that keeps changing is
+// tried before it is reported as failed
+const maxBlobChangedAttempts = 3
+
 // BlobstoreMigrator moves blobs from one blobstore to another
 type BlobstoreMigrator interface {
 	Migrate(dst blobstore.Blobstore, src blobstore.Blobstore) error
 }
 
+// BucketError is why a bucket could not be migrated, or not completely
+type BucketError struct {
+	Bucket string
+	Err    error
+}
+
+func (e BucketError) Error() string {
+	return fmt.Sprintf("error migrating bucket %s: %s", e.Bucket, e.Err)
+}
+
+// MigrationError is returned by Migrate when buckets could not be migrated
+// or a failure threshold was crossed
+type MigrationError struct {
+	Buckets []BucketError
+	// Threshold is why the migration was stopped early, if it was
+	Threshold *FailureThresholdError
+}
+
+func (e *MigrationError) Error() string {
+	var errs []string
+	if e.Threshold != nil {
+		errs = append(errs, e.Threshold.Error())
+	}
+	for _, bucketErr := range e.Buckets {
+		errs = append(errs, bucketErr.Error())
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Sprintf("%d errors: %s", len(errs), strings.Join(errs, "; "))
+}
+
 type blobstoreMigrator struct {
 	pool         *workpool.WorkPool
 	blobMigrator BlobMigrator
 	skip         map[string]struct{}
 	watcher      BlobstoreMigrationWatcher
+	filter       *BlobFilter
+	timer        PhaseTimer
+	listed       func(bucket string, last bool)
+	failures     *failureTracker
+	failFast     bool
+
+	thresholdHandlers []func(*FailureThresholdError)
+}
+
+// BlobstoreMigratorOption configures optional behaviour of a
+// BlobstoreMigrator
+type BlobstoreMigratorOption func(*blobstoreMigrator)
+
+// WithBlobFilter migrates only the blobs filter does not skip
+func WithBlobFilter(filter *BlobFilter) BlobstoreMigratorOption {
+	return func(m *blobstoreMigrator) {
+		m.filter = filter
+	}
+}
+
+// WithFailFast stops the migration at the first bucket that cannot be
+// listed, instead of going on to migrate the rest
+func WithFailFast() BlobstoreMigratorOption {
+	return func(m *blobstoreMigrator) {
+		m.failFast = true
+	}
+}
+
+// WithChecksumTimer tells timer how long checksumming each source blob took
+func WithChecksumTimer(timer PhaseTimer) BlobstoreMigratorOption {
+	return func(m *blobstoreMigrator) {
+		m.timer = timer
+	}
+}
+
+// WithListedHandler tells handler each time a bucket has been listed in
+// full, so that every blob in it has been queued, and whether it was the
+// last bucket to list
+func WithListedHandler(handler func(bucket string, last bool)) BlobstoreMigratorOption {
+	return func(m *blobstoreMigrator) {
+		m.listed = handler
+	}
 }
 
 func NewBlobstoreMigrator(
@@ -45,20 +130,29 @@ func NewBlobstoreMigrator(
 	blobMigrator BlobMigrator,
 	exclusions []string,
 	watcher BlobstoreMigrationWatcher,
+	opts ...BlobstoreMigratorOption,
 ) BlobstoreMigrator {
 	skip := make(map[string]struct{})
 	for i := range exclusions {
 		skip[exclusions[i]] = struct{}{}
 	}
 
-	return &blobstoreMigrator{
+	migrator := &blobstoreMigrator{
 		pool:         pool,
 		blobMigrator: blobMigrator,
 		skip:         skip,
 		watcher:      watcher,
 	}
+	for _, opt := range opts {
+		opt(migrator)
+	}
+	return migrator
 }
 
+// Migrate migrates each bucket in turn. A bucket that cannot be listed,
+// completely or at all, does not stop the rest from being migrated unless
+// the migrator fails fast. Migrate stops the pool once the blobs it
+// submitted have been migrated.
 func (m *blobstoreMigrator) Migrate(dst blobstore.Blobstore, src blobstore.Blobstore) error {
 	if src == nil {
 		return errors.New("src is an empty store")
@@ -68,68 +162,181 @@ func (m *blobstoreMigrator) Migrate(dst blobstore.Blobstore, src blobstore.Blobs
 		return errors.New("dst is an empty store")
 	}
 
-	m.watcher.MigrationDidStart(dst, src)
+	defer m.pool.Stop()
 
-	migrateWG := &sync.WaitGroup{}
+	var toMigrate []string
 	for _, bucket := range buckets {
-		if _, ok := m.skip[bucket]; ok {
-			continue
+		if _, ok := m.skip[bucket]; !ok {
+			toMigrate = append(toMigrate, bucket)
 		}
+	}
 
-		iterator, err := src.NewBucketIterator(bucket)
-		if err != nil {
-			return fmt.Errorf("could not create bucket iterator for bucket %s: %s", bucket, err)
+	if preparer, ok := dst.(blobstore.BucketPreparer); ok {
+		if err := preparer.PrepareBuckets(toMigrate); err != nil {
+			return fmt.Errorf("error preparing destination buckets: %s", err)
 		}
+	}
 
-		m.watcher.MigrateBucketDidStart(bucket)
+	m.watcher.MigrationDidStart(dst, src)
 
-		bucketWG := &sync.WaitGroup{}
-		for {
-			blob, err := iterator.Next()
-			if err == blobstore.ErrIteratorDone {
+	var migrationErr MigrationError
+	for i, bucket := range toMigrate {
+		if err := m.migrateBucket(dst, src, bucket, i == len(toMigrate)-1); err != nil {
+			logging.Error("error migrating bucket", "bucket", bucket, "error", err)
+			migrationErr.Buckets = append(migrationErr.Buckets, BucketError{Bucket: bucket, Err: err})
+			if m.failFast {
 				break
 			}
+		}
+
+		if m.failures.err() != nil {
+			break
+		}
+	}
+
+	m.watcher.MigrationDidFinish()
+
+	migrationErr.Threshold = m.failures.err()
+	if len(migrationErr.Buckets) == 0 && migrationErr.Threshold == nil {
+		return nil
+	}
+	return &migrationErr
+}
+
+// migrateBucket submits each blob in bucket to the pool and waits for them
+// to be migrated, even when the bucket cannot be listed completely. last
+// says whether it is the last bucket to migrate.
+func (m *blobstoreMigrator) migrateBucket(dst, src blobstore.Blobstore, bucket string, last bool) error {
+	iterator, err := src.NewBucketIterator(bucket)
+	if err != nil {
+		return fmt.Errorf("could not create bucket iterator: %s", err)
+	}
+	defer iterator.Done()
+
+	m.watcher.MigrateBucketDidStart(bucket)
+	bucketStart := time.Now()
+
+	bucketWG := &sync.WaitGroup{}
+	defer func() {
+		bucketWG.Wait()
+		m.watcher.MigrateBucketDidFinish(BucketEvent{Bucket: bucket, Duration: time.Since(bucketStart)})
+	}()
 
-			if err != nil {
-				return err
+	for m.failures.err() == nil {
+		blob, err := iterator.Next()
+		if err == blobstore.ErrIteratorDone {
+			if m.listed != nil {
+				m.listed(bucket, last)
 			}
+			return nil
+		}
 
-			migrateWG.Add(1)
-			bucketWG.Add(1)
-			m.pool.Submit(func() {
-				defer bucketWG.Done()
-				defer migrateWG.Done()
-
-				checksum, err := src.Checksum(blob)
-				if err != nil {
-					checksumErr := fmt.Errorf("could not checksum blob: %s", err)
-					m.watcher.MigrateBlobDidFailWithError(checksumErr)
-					return
-				}
-
-				blob.Checksum = checksum
-
-				if dst.Exists(blob) {
-					m.watcher.MigrateBlobAlreadyFinished()
-					return
-				}
-
-				err = m.blobMigrator.Migrate(blob)
-				if err != nil {
-					m.watcher.MigrateBlobDidFailWithError(err)
-					return
-				}
-
-				m.watcher.MigrateBlobDidFinish()
-			})
+		if err != nil {
+			return fmt.Errorf("error listing blobs: %s", err)
 		}
 
-		bucketWG.Wait()
-		m.watcher.MigrateBucketDidFinish()
-	}
+		if m.filter != nil {
+			if reason, skip := m.filter.Skip(blob); skip {
+				m.watcher.MigrateBlobWasFiltered(BlobEvent{Bucket: bucket, Blob: blob, Reason: reason})
+				continue
+			}
+		}
 
-	migrateWG.Wait()
-	m.watcher.MigrationDidFinish()
+		m.watcher.MigrateBlobWasQueued(BlobEvent{Bucket: bucket, Blob: blob})
+
+		bucketWG.Add(1)
+		m.pool.Submit(func() {
+			defer bucketWG.Done()
 
+			m.migrateBlob(dst, src, bucket, blob)
+		})
+	}
 	return nil
 }
+
+// record counts a blob that finished towards the failure threshold, telling
+// the threshold handlers when it is crossed
+func (m *blobstoreMigrator) record(blob *blobstore.Blob, err error) {
+	if !m.failures.record(blob, err) {
+		return
+	}
+	thresholdErr := m.failures.err()
+	for _, handler := range m.thresholdHandlers {
+		handler(thresholdErr)
+	}
+}
+
+// migrateBlob checksums and migrates blob, starting again when the blob
+// changes part way through, e.g. because Cloud Controller was still
+// writing it. Blobs still queued once the failure threshold has been
+// crossed are reported as filtered, without being attempted.
+func (m *blobstoreMigrator) migrateBlob(dst, src blobstore.Blobstore, bucket string, blob *blobstore.Blob) {
+	if thresholdErr := m.failures.err(); thresholdErr != nil {
+		m.watcher.MigrateBlobWasFiltered(BlobEvent{
+			Bucket: bucket,
+			Blob:   blob,
+			Reason: fmt.Sprintf("not attempted, as the migration stopped because %s", thresholdErr.Reason),
+		})
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry := attempt < maxBlobChangedAttempts
+		start := time.Now()
+		event := func() BlobEvent {
+			return BlobEvent{
+				Bucket:   bucket,
+				Blob:     blob,
+				Duration: time.Since(start),
+				Attempt:  attempt,
+			}
+		}
+		m.watcher.MigrateBlobDidStart(event())
+
+		checksum, err := src.Checksum(blob)
+		if m.timer != nil {
+			m.timer(blob, PhaseChecksum, time.Since(start))
+		}
+		if err == blobstore.ErrBlobChanged && retry {
+			time.Sleep(blobChangedRetryDelay)
+			continue
+		}
+		if err != nil {
+			failed := event()
+			failed.Err = fmt.Errorf("could not checksum blob: %s", err)
+			m.record(blob, failed.Err)
+			m.watcher.MigrateBlobDidFailWithError(failed)
+			return
+		}
+
+		blob.Checksum = checksum
+
+		if dst.Exists(blob) {
+			m.record(blob, nil)
+			m.watcher.MigrateBlobAlreadyFinished(event())
+			return
+		}
+
+		err = m.blobMigrator.Migrate(blob)
+		if err == blobstore.ErrBlobChanged && retry {
+			time.Sleep(blobChangedRetryDelay)
+			continue
+		}
+		if err == blobstore.ErrBlobChanged {
+			err = fmt.Errorf("error migrating blob at %s: %s", blob.Path, err)
+		}
+		if err != nil {
+			failed := event()
+			failed.Err = err
+			m.record(blob, err)
+			m.watcher.MigrateBlobDidFailWithError(failed)
+			return
+		}
+
+		m.record(blob, nil)
+		migrated := event()
+		migrated.Bytes = blob.Size
+		m.watcher.MigrateBlobDidFinish(migrated)
+		return
+	}
+}
@@ -16,6 +16,8 @@ package goblob_test
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"code.cloudfoundry.org/workpool"
 
@@ -28,6 +30,13 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// preparingBlobstore is a blobstore that checks its buckets before they are
+// written to
+type preparingBlobstore struct {
+	*blobstorefakes.FakeBlobstore
+	*blobstorefakes.FakeBucketPreparer
+}
+
 var _ = Describe("BlobstoreMigrator", func() {
 	var (
 		migrator     goblob.BlobstoreMigrator
@@ -100,6 +109,36 @@ var _ = Describe("BlobstoreMigrator", func() {
 			Expect(blobMigrator.MigrateArgsForCall(2)).To(Equal(thirdBlob))
 		})
 
+		It("tells the watcher which blob and bucket each event is for", func() {
+			srcStore.NewBucketIteratorStub = func(bucket string) (blobstore.BucketIterator, error) {
+				if bucket == "cc-packages" {
+					return iterator, nil
+				}
+				return &blobstorefakes.FakeBucketIterator{NextStub: func() (*blobstore.Blob, error) {
+					return nil, blobstore.ErrIteratorDone
+				}}, nil
+			}
+			firstBlob.Size = 1024
+
+			err := migrator.Migrate(dstStore, srcStore)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(watcher.MigrateBlobWasQueuedCallCount()).To(Equal(3))
+			Expect(watcher.MigrateBlobWasQueuedArgsForCall(0).Blob).To(Equal(firstBlob))
+			Expect(watcher.MigrateBlobDidStartCallCount()).To(Equal(3))
+
+			Expect(watcher.MigrateBlobDidFinishCallCount()).To(Equal(3))
+			event := watcher.MigrateBlobDidFinishArgsForCall(0)
+			Expect(event.Bucket).To(Equal("cc-packages"))
+			Expect(event.Blob).To(Equal(firstBlob))
+			Expect(event.Bytes).To(Equal(int64(1024)))
+			Expect(event.Attempt).To(Equal(1))
+			Expect(event.Err).NotTo(HaveOccurred())
+
+			Expect(watcher.MigrateBucketDidFinishCallCount()).To(Equal(4))
+			Expect(watcher.MigrateBucketDidFinishArgsForCall(2).Bucket).To(Equal("cc-packages"))
+		})
+
 		Context("when an exclusion list is given", func() {
 			BeforeEach(func() {
 				exclusions := []string{"cc-resources", "cc-buildpacks"}
@@ -120,6 +159,140 @@ var _ = Describe("BlobstoreMigrator", func() {
 			})
 		})
 
+		Context("when a blob filter is given", func() {
+			BeforeEach(func() {
+				filter, err := goblob.NewBlobFilter(goblob.BlobFilterConfig{
+					Exclude: []string{"some-other-path/**"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher, goblob.WithBlobFilter(filter))
+			})
+
+			It("migrates only the blobs it does not skip", func() {
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(2))
+				Expect(blobMigrator.MigrateArgsForCall(0)).To(Equal(firstBlob))
+				Expect(blobMigrator.MigrateArgsForCall(1)).To(Equal(thirdBlob))
+				Expect(srcStore.ChecksumCallCount()).To(Equal(2))
+			})
+
+			It("tells the watcher why blobs were skipped", func() {
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(watcher.MigrateBlobWasFilteredCallCount()).To(Equal(1))
+				event := watcher.MigrateBlobWasFilteredArgsForCall(0)
+				Expect(event.Reason).To(Equal("excluded by some-other-path/**"))
+				Expect(event.Blob).To(Equal(secondBlob))
+			})
+		})
+
+		Context("when checksums are timed", func() {
+			var timed []*blobstore.Blob
+
+			BeforeEach(func() {
+				timed = nil
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher, goblob.WithChecksumTimer(func(blob *blobstore.Blob, phase goblob.Phase, duration time.Duration) {
+					Expect(phase).To(Equal(goblob.PhaseChecksum))
+					timed = append(timed, blob)
+				}))
+			})
+
+			It("times checksumming each source blob", func() {
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(timed).To(Equal([]*blobstore.Blob{firstBlob, secondBlob, thirdBlob}))
+			})
+		})
+
+		Context("when told about listing", func() {
+			type listing struct {
+				bucket string
+				last   bool
+			}
+			var listed []listing
+
+			BeforeEach(func() {
+				listed = nil
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher, goblob.WithListedHandler(func(bucket string, last bool) {
+					listed = append(listed, listing{bucket, last})
+				}))
+			})
+
+			It("says when each bucket has been listed and which was the last", func() {
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(listed).To(Equal([]listing{
+					{"cc-buildpacks", false},
+					{"cc-droplets", false},
+					{"cc-packages", false},
+					{"cc-resources", true},
+				}))
+			})
+
+			It("does not say a bucket was listed when listing it failed", func() {
+				srcStore.NewBucketIteratorStub = func(bucket string) (blobstore.BucketIterator, error) {
+					if bucket == "cc-resources" {
+						return &blobstorefakes.FakeBucketIterator{NextStub: func() (*blobstore.Blob, error) {
+							return nil, errors.New("listing-error")
+						}}, nil
+					}
+					return iterator, nil
+				}
+
+				migrator.Migrate(dstStore, srcStore)
+				Expect(listed).To(HaveLen(3))
+				Expect(listed[2].last).To(BeFalse())
+			})
+		})
+
+		Context("when a blob changes while it is migrated", func() {
+			It("checksums and migrates it again", func() {
+				changes := 1
+				blobMigrator.MigrateStub = func(blob *blobstore.Blob) error {
+					if blob.Path == "some-other-path/some-other-file" && changes > 0 {
+						changes--
+						return blobstore.ErrBlobChanged
+					}
+					return nil
+				}
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(4))
+				Expect(srcStore.ChecksumCallCount()).To(Equal(4))
+				Expect(watcher.MigrateBlobDidFailWithErrorCallCount()).To(Equal(0))
+				Expect(watcher.MigrateBlobDidFinishCallCount()).To(Equal(3))
+
+				var attempts []int
+				for i := 0; i < watcher.MigrateBlobDidFinishCallCount(); i++ {
+					attempts = append(attempts, watcher.MigrateBlobDidFinishArgsForCall(i).Attempt)
+				}
+				Expect(attempts).To(Equal([]int{1, 2, 1}))
+				Expect(watcher.MigrateBlobDidStartCallCount()).To(Equal(4))
+			})
+
+			It("fails the blob when it keeps changing", func() {
+				blobMigrator.MigrateStub = func(blob *blobstore.Blob) error {
+					if blob.Path == "some-other-path/some-other-file" {
+						return blobstore.ErrBlobChanged
+					}
+					return nil
+				}
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(5))
+				Expect(watcher.MigrateBlobDidFailWithErrorCallCount()).To(Equal(1))
+				event := watcher.MigrateBlobDidFailWithErrorArgsForCall(0)
+				Expect(event.Err).To(MatchError(
+					"error migrating blob at some-other-path/some-other-file: blob changed while it was being migrated",
+				))
+				Expect(event.Blob).To(Equal(secondBlob))
+				Expect(event.Attempt).To(Equal(3))
+			})
+		})
+
 		Context("when a file already exists", func() {
 			BeforeEach(func() {
 				dstStore.ExistsStub = func(blob *blobstore.Blob) bool {
@@ -134,6 +307,15 @@ var _ = Describe("BlobstoreMigrator", func() {
 				Expect(blobMigrator.MigrateArgsForCall(0)).To(Equal(firstBlob))
 				Expect(blobMigrator.MigrateArgsForCall(1)).To(Equal(thirdBlob))
 			})
+
+			It("tells the watcher which blobs were already migrated", func() {
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(watcher.MigrateBlobAlreadyFinishedCallCount()).To(Equal(1))
+				event := watcher.MigrateBlobAlreadyFinishedArgsForCall(0)
+				Expect(event.Blob).To(Equal(secondBlob))
+				Expect(event.Bytes).To(BeZero())
+			})
 		})
 
 		Context("when there is an error uploading one blob", func() {
@@ -157,6 +339,123 @@ var _ = Describe("BlobstoreMigrator", func() {
 			})
 		})
 
+		Context("when a failure threshold is given", func() {
+			var endless *blobstorefakes.FakeBucketIterator
+
+			BeforeEach(func() {
+				endless = &blobstorefakes.FakeBucketIterator{}
+				endless.NextStub = func() (*blobstore.Blob, error) {
+					if n := endless.NextCallCount(); n <= 1000 {
+						return &blobstore.Blob{Path: fmt.Sprintf("cc-buildpacks/%d", n)}, nil
+					}
+					return nil, blobstore.ErrIteratorDone
+				}
+				srcStore.NewBucketIteratorReturns(endless, nil)
+			})
+
+			failAfter := func(succeeded int) {
+				blobMigrator.MigrateStub = func(blob *blobstore.Blob) error {
+					if blobMigrator.MigrateCallCount() <= succeeded {
+						return nil
+					}
+					// S3 gives every request its own ids
+					return fmt.Errorf("error writing blob at %s: AccessDenied: Access Denied\n\tstatus code: 403, request id: %d, host id: host-%d",
+						blob.Path, blobMigrator.MigrateCallCount(), blobMigrator.MigrateCallCount())
+				}
+			}
+
+			It("stops once more blobs than the maximum have failed", func() {
+				failAfter(0)
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher,
+					goblob.WithFailureThreshold(goblob.FailureThreshold{MaxFailures: 5}),
+				)
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).To(BeAssignableToTypeOf(&goblob.MigrationError{}))
+				thresholdErr := err.(*goblob.MigrationError).Threshold
+				Expect(thresholdErr.Reason).To(Equal("more than 5 blobs failed"))
+				Expect(thresholdErr.Cause).To(Equal("error writing blob at <blob>: AccessDenied: Access Denied\n\tstatus code: 403"))
+				Expect(thresholdErr.Count).To(Equal(thresholdErr.Failed))
+				Expect(err.Error()).To(HavePrefix("migration stopped because more than 5 blobs failed; "))
+
+				// blobs already submitted are not attempted
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(6))
+				Expect(srcStore.ChecksumCallCount()).To(Equal(6))
+				Expect(watcher.MigrateBlobDidFailWithErrorCallCount()).To(Equal(6))
+				queued := watcher.MigrateBlobWasQueuedCallCount()
+				Expect(watcher.MigrateBlobWasFilteredCallCount()).To(Equal(queued - 6))
+				for i := 0; i < watcher.MigrateBlobWasFilteredCallCount(); i++ {
+					Expect(watcher.MigrateBlobWasFilteredArgsForCall(i).Reason).To(Equal("not attempted, as the migration stopped because more than 5 blobs failed"))
+				}
+
+				Expect(srcStore.NewBucketIteratorCallCount()).To(Equal(1))
+				Expect(endless.DoneCallCount()).To(Equal(1))
+				Expect(err.(*goblob.MigrationError).Buckets).To(BeEmpty())
+				Expect(watcher.MigrateBucketDidFinishCallCount()).To(Equal(1))
+				Expect(watcher.MigrationDidFinishCallCount()).To(Equal(1))
+			})
+
+			It("tells the threshold handlers once, with the reason the migration stopped", func() {
+				failAfter(0)
+				var crossed []*goblob.FailureThresholdError
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher,
+					goblob.WithFailureThreshold(goblob.FailureThreshold{MaxFailures: 5}),
+					goblob.WithFailureThresholdHandler(func(err *goblob.FailureThresholdError) {
+						crossed = append(crossed, err)
+					}),
+				)
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).To(HaveOccurred())
+				Expect(crossed).To(HaveLen(1))
+				Expect(crossed[0].Reason).To(Equal("more than 5 blobs failed"))
+				Expect(crossed[0].Failed).To(Equal(int64(6)))
+			})
+
+			It("stops once the failure rate over the window is more than the maximum", func() {
+				failAfter(20)
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher,
+					goblob.WithFailureThreshold(goblob.FailureThreshold{MaxFailureRate: 0.5, Window: 10}),
+				)
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).To(BeAssignableToTypeOf(&goblob.MigrationError{}))
+				Expect(err.(*goblob.MigrationError).Threshold.Reason).To(Equal("6 of the last 10 blobs failed, more than 50%"))
+				Expect(blobMigrator.MigrateCallCount()).To(BeNumerically(">=", 26))
+				Expect(blobMigrator.MigrateCallCount()).To(BeNumerically("<", 30))
+			})
+
+			It("does not check the failure rate until the window is full", func() {
+				blobMigrator.MigrateStub = func(blob *blobstore.Blob) error {
+					if blobMigrator.MigrateCallCount() <= 5 {
+						return errors.New("AccessDenied")
+					}
+					return nil
+				}
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher,
+					goblob.WithFailureThreshold(goblob.FailureThreshold{MaxFailureRate: 0.5, Window: 10}),
+				)
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(1000))
+			})
+
+			It("counts blobs that were already migrated as successes", func() {
+				dstStore.ExistsStub = func(blob *blobstore.Blob) bool {
+					return blob.Path != "cc-buildpacks/3"
+				}
+				failAfter(0)
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher,
+					goblob.WithFailureThreshold(goblob.FailureThreshold{MaxFailures: 1, MaxFailureRate: 0.5, Window: 10}),
+				)
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(watcher.MigrateBlobAlreadyFinishedCallCount()).To(Equal(999))
+			})
+		})
+
 		It("returns an error when the source store is nil", func() {
 			err := migrator.Migrate(dstStore, nil)
 			Expect(err).To(HaveOccurred())
@@ -169,17 +468,131 @@ var _ = Describe("BlobstoreMigrator", func() {
 			Expect(err.Error()).To(Equal("dst is an empty store"))
 		})
 
-		Context("when the source store has no files", func() {
+		Context("when the destination prepares its buckets", func() {
+			var preparer *blobstorefakes.FakeBucketPreparer
+
+			BeforeEach(func() {
+				preparer = &blobstorefakes.FakeBucketPreparer{}
+				exclusions := []string{"cc-resources"}
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, exclusions, watcher)
+			})
+
+			It("prepares the buckets that are not excluded once, before migrating", func() {
+				err := migrator.Migrate(preparingBlobstore{dstStore, preparer}, srcStore)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(preparer.PrepareBucketsCallCount()).To(Equal(1))
+				Expect(preparer.PrepareBucketsArgsForCall(0)).To(Equal([]string{"cc-buildpacks", "cc-droplets", "cc-packages"}))
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(3))
+			})
+
+			It("returns a single error without migrating when a bucket is not ready", func() {
+				preparer.PrepareBucketsReturns(errors.New("buckets some-droplets, some-packages do not exist and bucket creation is disabled"))
+
+				err := migrator.Migrate(preparingBlobstore{dstStore, preparer}, srcStore)
+				Expect(err).To(MatchError("error preparing destination buckets: buckets some-droplets, some-packages do not exist and bucket creation is disabled"))
+
+				Expect(srcStore.NewBucketIteratorCallCount()).To(Equal(0))
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(0))
+				Expect(watcher.MigrationDidStartCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when listing the buckets fails", func() {
 			BeforeEach(func() {
 				iterator.NextStub = func() (*blobstore.Blob, error) {
-					return nil, errors.New("no more files!") // <-- this needs to be an exported err
+					return nil, errors.New("no more files!")
 				}
 			})
 
-			It("returns an error", func() {
+			It("returns an error for each bucket", func() {
 				err := migrator.Migrate(dstStore, srcStore)
-				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(Equal("no more files!"))
+				Expect(err).To(BeAssignableToTypeOf(&goblob.MigrationError{}))
+
+				migrationErr := err.(*goblob.MigrationError)
+				Expect(migrationErr.Buckets).To(HaveLen(4))
+				Expect(migrationErr.Buckets[0].Bucket).To(Equal("cc-buildpacks"))
+				Expect(migrationErr.Buckets[0].Err).To(MatchError("error listing blobs: no more files!"))
+				Expect(migrationErr.Threshold).To(BeNil())
+				Expect(err.Error()).To(HavePrefix("4 errors: error migrating bucket cc-buildpacks: error listing blobs: no more files!; error migrating bucket cc-droplets: "))
+			})
+
+			It("finishes each bucket and the migration", func() {
+				migrator.Migrate(dstStore, srcStore)
+
+				Expect(iterator.DoneCallCount()).To(Equal(4))
+				Expect(watcher.MigrateBucketDidFinishCallCount()).To(Equal(4))
+				Expect(watcher.MigrationDidFinishCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when listing a bucket fails part way through", func() {
+			BeforeEach(func() {
+				iterator.NextStub = func() (*blobstore.Blob, error) {
+					if iterator.NextCallCount() == 1 {
+						return firstBlob, nil
+					}
+					return nil, errors.New("connection reset")
+				}
+				srcStore.NewBucketIteratorStub = func(bucket string) (blobstore.BucketIterator, error) {
+					if bucket == "cc-buildpacks" {
+						return iterator, nil
+					}
+					empty := &blobstorefakes.FakeBucketIterator{}
+					empty.NextReturns(nil, blobstore.ErrIteratorDone)
+					return empty, nil
+				}
+			})
+
+			It("waits for the blobs already submitted before finishing the bucket", func() {
+				migrated := make(chan struct{})
+				blobMigrator.MigrateStub = func(blob *blobstore.Blob) error {
+					time.Sleep(10 * time.Millisecond)
+					close(migrated)
+					return nil
+				}
+				watcher.MigrateBucketDidFinishStub = func(goblob.BucketEvent) {
+					Expect(migrated).To(BeClosed())
+				}
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).To(MatchError("error migrating bucket cc-buildpacks: error listing blobs: connection reset"))
+				Expect(blobMigrator.MigrateCallCount()).To(Equal(1))
+				Expect(watcher.MigrateBlobDidFinishCallCount()).To(Equal(1))
+				Expect(iterator.DoneCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when a bucket iterator cannot be created", func() {
+			BeforeEach(func() {
+				srcStore.NewBucketIteratorStub = func(bucket string) (blobstore.BucketIterator, error) {
+					if bucket == "cc-droplets" {
+						return nil, errors.New("AccessDenied")
+					}
+					empty := &blobstorefakes.FakeBucketIterator{}
+					empty.NextReturns(nil, blobstore.ErrIteratorDone)
+					return empty, nil
+				}
+			})
+
+			It("migrates the remaining buckets", func() {
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).To(MatchError("error migrating bucket cc-droplets: could not create bucket iterator: AccessDenied"))
+
+				Expect(srcStore.NewBucketIteratorCallCount()).To(Equal(4))
+				Expect(watcher.MigrateBucketDidStartCallCount()).To(Equal(3))
+				Expect(watcher.MigrateBucketDidFinishCallCount()).To(Equal(3))
+				Expect(watcher.MigrationDidFinishCallCount()).To(Equal(1))
+			})
+
+			It("stops at that bucket when failing fast", func() {
+				migrator = goblob.NewBlobstoreMigrator(pool, blobMigrator, nil, watcher, goblob.WithFailFast())
+
+				err := migrator.Migrate(dstStore, srcStore)
+				Expect(err).To(MatchError("error migrating bucket cc-droplets: could not create bucket iterator: AccessDenied"))
+
+				Expect(srcStore.NewBucketIteratorCallCount()).To(Equal(2))
+				Expect(watcher.MigrationDidFinishCallCount()).To(Equal(1))
 			})
 		})
 
@@ -0,0 +1,73 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+)
+
+// bandwidthCheckInterval is how often schedule windows and the control file
+// are checked between signals
+const bandwidthCheckInterval = 10 * time.Second
+
+type BandwidthOptions struct {
+	MaxBandwidth string   `long:"max-bandwidth" env:"MAX_BANDWIDTH" description:"maximum rate blobs are uploaded, and read from NFS to checksum them, across all blobs, e.g. 200MB/s (default: unlimited)"`
+	Schedule     []string `long:"bandwidth-schedule" description:"rate during a time of day, e.g. 08:00-18:00=50MB/s; overrides max-bandwidth (may be given more than once)"`
+	ControlFile  string   `long:"bandwidth-control-file" env:"BANDWIDTH_CONTROL_FILE" description:"file whose contents, e.g. 20MB/s, override the schedule while it is not empty; re-read every 10s and on SIGHUP"`
+}
+
+// limiter returns a limiter kept up to date by a controller, and a function
+// that stops the controller. The limiter is nil when no limit is configured.
+func (o BandwidthOptions) limiter() (*bandwidth.Limiter, func(), error) {
+	if o.MaxBandwidth == "" && len(o.Schedule) == 0 && o.ControlFile == "" {
+		return nil, func() {}, nil
+	}
+
+	var defaultRate int64
+	if o.MaxBandwidth != "" {
+		var err error
+		defaultRate, err = bandwidth.ParseRate(o.MaxBandwidth)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid max bandwidth: %s", err)
+		}
+	}
+
+	schedule, err := bandwidth.ParseSchedule(o.Schedule)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid bandwidth schedule: %s", err)
+	}
+
+	limiter := bandwidth.NewLimiter(0)
+	controller := bandwidth.NewController(limiter, defaultRate, schedule, o.ControlFile)
+	if err := controller.Update(); err != nil {
+		return nil, nil, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+	go controller.Run(bandwidthCheckInterval, signals, done)
+
+	return limiter, func() {
+		signal.Stop(signals)
+		close(done)
+	}, nil
+}
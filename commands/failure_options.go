@@ -0,0 +1,65 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/goblob"
+)
+
+type FailureOptions struct {
+	MaxFailures       int64  `long:"max-failures" env:"MAX_FAILURES" description:"stop the migration once more than this many blobs have failed (default: no limit)"`
+	MaxFailureRate    string `long:"max-failure-rate" env:"MAX_FAILURE_RATE" description:"stop the migration once more than this percentage of the most recent blobs have failed, e.g. 20% (default: no limit)"`
+	FailureRateWindow int    `long:"failure-rate-window" default:"100" description:"how many of the most recent blobs max-failure-rate applies to"`
+	FailFast          bool   `long:"fail-fast" description:"stop at the first bucket that cannot be listed instead of migrating the rest"`
+}
+
+// migratorOpts returns the options for the blobstore migrator that apply
+// the failure threshold and fail fast
+func (o FailureOptions) migratorOpts() ([]goblob.BlobstoreMigratorOption, error) {
+	threshold, err := o.threshold()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []goblob.BlobstoreMigratorOption{goblob.WithFailureThreshold(threshold)}
+	if o.FailFast {
+		opts = append(opts, goblob.WithFailFast())
+	}
+	return opts, nil
+}
+
+func (o FailureOptions) threshold() (goblob.FailureThreshold, error) {
+	threshold := goblob.FailureThreshold{
+		MaxFailures: o.MaxFailures,
+		Window:      o.FailureRateWindow,
+	}
+
+	if o.MaxFailureRate != "" {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(o.MaxFailureRate), "%"), 64)
+		if err != nil {
+			return goblob.FailureThreshold{}, fmt.Errorf("invalid maximum failure rate %q: expected a percentage, e.g. 20%%", o.MaxFailureRate)
+		}
+		threshold.MaxFailureRate = percent / 100
+	}
+
+	if err := threshold.Validate(); err != nil {
+		return goblob.FailureThreshold{}, err
+	}
+	return threshold, nil
+}
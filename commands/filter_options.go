@@ -0,0 +1,81 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/bandwidth"
+)
+
+type FilterOptions struct {
+	Include        []string `long:"include" description:"blob path glob, or regular expression prefixed with re:, to migrate, e.g. cc-packages/** (may be given more than once)"`
+	MinSize        string   `long:"min-size" description:"skip blobs smaller than this, e.g. 1KB"`
+	MaxSize        string   `long:"max-size" description:"skip blobs larger than this, e.g. 2GB"`
+	ModifiedBefore string   `long:"modified-before" description:"only migrate blobs modified before this time: RFC 3339, a date such as 2018-09-01, or a duration ago such as 720h"`
+	ModifiedAfter  string   `long:"modified-after" description:"only migrate blobs modified after this time: RFC 3339, a date such as 2018-09-01, or a duration ago such as 720h"`
+}
+
+// filter returns the filter for these options and the --exclude values,
+// which may be blob path patterns as well as bucket names
+func (o FilterOptions) filter(exclusions []string) (*goblob.BlobFilter, error) {
+	config := goblob.BlobFilterConfig{
+		Include: o.Include,
+		Exclude: exclusions,
+	}
+
+	var err error
+	if o.MinSize != "" {
+		if config.MinSize, err = bandwidth.ParseBytes(o.MinSize); err != nil {
+			return nil, fmt.Errorf("invalid minimum size: %s", err)
+		}
+	}
+	if o.MaxSize != "" {
+		if config.MaxSize, err = bandwidth.ParseBytes(o.MaxSize); err != nil {
+			return nil, fmt.Errorf("invalid maximum size: %s", err)
+		}
+	}
+	if o.ModifiedBefore != "" {
+		if config.ModifiedBefore, err = parseTime(o.ModifiedBefore); err != nil {
+			return nil, fmt.Errorf("invalid modified-before time: %s", err)
+		}
+	}
+	if o.ModifiedAfter != "" {
+		if config.ModifiedAfter, err = parseTime(o.ModifiedAfter); err != nil {
+			return nil, fmt.Errorf("invalid modified-after time: %s", err)
+		}
+	}
+
+	filter, err := goblob.NewBlobFilter(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %s", err)
+	}
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, a date or a duration", value)
+}
@@ -17,8 +17,9 @@ package commands
 type GoblobCommand struct {
 	Version func() `command:"version" description:"Print version information and exit"`
 
-	Migrate MigrateCommand `command:"migrate" description:"Migrate blobs from one blobstore to another"`
+	Migrate        MigrateCommand            `command:"migrate" description:"Migrate blobs from one blobstore to another"`
 	MigrateToAzure MigrateToAzureBlobCommand `command:"migrate2azure" description:"Migrate blobs from NFS blobstore to Azure blobstore"`
+	S3CompatCheck  S3CompatCheckCommand      `command:"s3-compat-check" description:"Probe an S3-compatible endpoint and recommend addressing and signing settings"`
 }
 
 var Goblob GoblobCommand
@@ -0,0 +1,47 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"net/http"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+type HTTPOptions struct {
+	CACert        string `long:"ca-cert" env:"CA_CERT" description:"path to a PEM bundle of CA certificates to trust in addition to the system ones"`
+	ClientCert    string `long:"client-cert" env:"CLIENT_CERT" description:"path to a PEM client certificate for endpoints that require mutual TLS"`
+	ClientKey     string `long:"client-key" env:"CLIENT_KEY" description:"path to the PEM private key for the client certificate"`
+	ProxyURL      string `long:"proxy-url" env:"PROXY_URL" description:"proxy to send all requests through (default: HTTP_PROXY, HTTPS_PROXY and NO_PROXY)"`
+	ProxyUsername string `long:"proxy-username" env:"PROXY_USERNAME" description:"username for the proxy"`
+	ProxyPassword string `long:"proxy-password" env:"PROXY_PASSWORD" description:"password for the proxy"`
+
+	MaxConnections int `long:"max-connections" env:"MAX_CONNECTIONS" description:"maximum requests in flight to the blobstore across all uploads (default: no limit)"`
+}
+
+func (o HTTPOptions) client(insecureSkipVerify bool, limiter *bandwidth.Limiter) (*http.Client, error) {
+	return blobstore.NewHTTPClient(blobstore.HTTPClientConfig{
+		InsecureSkipVerify: insecureSkipVerify,
+		CACertFile:         o.CACert,
+		ClientCertFile:     o.ClientCert,
+		ClientKeyFile:      o.ClientKey,
+		ProxyURL:           o.ProxyURL,
+		ProxyUsername:      o.ProxyUsername,
+		ProxyPassword:      o.ProxyPassword,
+		MaxConnections:     o.MaxConnections,
+		Limiter:            limiter,
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pivotal-cf/goblob/logging"
+)
+
+type LoggingOptions struct {
+	Level  string `long:"log-level" env:"LOG_LEVEL" default:"info" description:"least important messages to log: debug, info, warn or error"`
+	Format string `long:"log-format" env:"LOG_FORMAT" default:"text" description:"how to write log messages: text or json, a JSON object per line"`
+	File   string `long:"log-file" env:"LOG_FILE" description:"file to append log messages to instead of writing them to stderr"`
+	Quiet  bool   `long:"quiet" description:"print no progress or summary and only log errors"`
+}
+
+// setup makes the logger configured the default one, and returns a
+// function that closes the log file
+func (o LoggingOptions) setup() (func(), error) {
+	level, err := logging.ParseLevel(o.Level)
+	if err != nil {
+		return nil, err
+	}
+	if o.Quiet && level < logging.LevelError {
+		level = logging.LevelError
+	}
+
+	format, err := logging.ParseFormat(o.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	closeFile := func() {}
+	if o.File != "" {
+		file, err := os.OpenFile(o.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening log file: %s", err)
+		}
+		out = file
+		closeFile = func() { file.Close() }
+	}
+
+	logging.SetDefault(logging.New(out, format, level))
+	return closeFile, nil
+}
@@ -16,6 +16,7 @@ package commands
 
 import (
 	"fmt"
+	"time"
 
 	"code.cloudfoundry.org/workpool"
 	"github.com/pivotal-cf/goblob"
@@ -24,29 +25,102 @@ import (
 
 type MigrateCommand struct {
 	ConcurrentUploads int      `long:"concurrent-uploads" env:"CONCURRENT_UPLOADS" default:"20"`
-	Exclusions        []string `long:"exclude" description:"blobstore directories to exclude, e.g. cc-resources"`
+	Exclusions        []string `long:"exclude" description:"bucket, or blob path glob or regular expression prefixed with re:, to exclude, e.g. cc-resources or cc-droplets/buildpack_cache/** (may be given more than once)"`
+
+	Filter FilterOptions `group:"Filter"`
+
+	Failures FailureOptions `group:"Failures"`
 
 	NFS struct {
-		Path string `long:"blobstore-path" env:"BLOBSTORE_PATH" description:"path to root of blobstore" default:"/var/vcap/store/shared"`
+		Path       string        `long:"blobstore-path" env:"BLOBSTORE_PATH" description:"path to root of blobstore" default:"/var/vcap/store/shared"`
+		Ignore     []string      `long:"nfs-ignore" description:"file name pattern to skip in addition to .nfs*, *.tmp, *.part, *~ and .*.swp (may be given more than once)"`
+		SettleTime time.Duration `long:"nfs-settle-time" env:"NFS_SETTLE_TIME" default:"30s" description:"defer files modified more recently than this until the end of their bucket"`
+		Symlinks   string        `long:"nfs-symlinks" default:"follow" description:"what to do with symbolic links: follow, skip or error"`
 	} `group:"NFS"`
 
-	S3 struct {
-		AccessKey            string `long:"s3-accesskey" env:"S3_ACCESSKEY" description:"S3 access key"`
-		SecretKey            string `long:"s3-secretkey" env:"S3_SECRETKEY" description:"S3 secret access key"`
-		Region               string `long:"region" default:"us-east-1" env:"S3_REGION" description:"S3 region"`
-		Endpoint             string `long:"s3-endpoint" default:"https://s3.amazonaws.com" env:"S3_ENDPOINT"`
-		UseMultipartUploads  bool   `long:"use-multipart-uploads" env:"USE_MULTIPART_UPLOADS"`
-		DisableSSL           bool   `long:"disable-ssl" description:"disable SSL connections to S3 endpoint"`
-		InsecureSkipVerify   bool   `long:"insecure-skip-verify" description:"disable verification of server certificate chain"`
-		BuildpacksBucketName string `long:"buildpacks-bucket-name" default:"cc-buildpacks" description:"name of bucket to store buildpacks in"`
-		DropletsBucketName   string `long:"droplets-bucket-name" default:"cc-droplets" description:"name of bucket to store droplets in"`
-		PackagesBucketName   string `long:"packages-bucket-name" default:"cc-packages" description:"name of bucket to store packages in"`
-		ResourcesBucketName  string `long:"resources-bucket-name" default:"cc-resources" description:"name of bucket to store resources in"`
-	} `group:"S3"`
+	S3 S3Options `group:"S3"`
+
+	HTTP HTTPOptions `group:"HTTP"`
+
+	Bandwidth BandwidthOptions `group:"Bandwidth"`
+
+	Watcher WatcherOptions `group:"Output"`
+
+	Logging LoggingOptions `group:"Logging"`
 }
 
 func (c *MigrateCommand) Execute([]string) error {
-	nfsStore := blobstore.NewNFS(c.NFS.Path)
+	closeLog, err := c.Logging.setup()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if c.S3.PartSizeMB < 5 {
+		return fmt.Errorf("invalid S3 part size %dMiB: the minimum is 5MiB", c.S3.PartSizeMB)
+	}
+	if c.S3.UploadConcurrency < 1 {
+		return fmt.Errorf("invalid S3 upload concurrency %d: at least 1 is required", c.S3.UploadConcurrency)
+	}
+
+	encryption, err := c.S3.encryption()
+	if err != nil {
+		return err
+	}
+
+	compatibility, err := c.S3.compatibility()
+	if err != nil {
+		return err
+	}
+
+	objectSettings, err := c.S3.objectSettings()
+	if err != nil {
+		return err
+	}
+
+	provisioning, err := c.S3.bucketProvisioning()
+	if err != nil {
+		return err
+	}
+
+	filter, err := c.Filter.filter(c.Exclusions)
+	if err != nil {
+		return err
+	}
+
+	failureOpts, err := c.Failures.migratorOpts()
+	if err != nil {
+		return err
+	}
+
+	limiter, stopLimiter, err := c.Bandwidth.limiter()
+	if err != nil {
+		return err
+	}
+	defer stopLimiter()
+
+	httpClient, err := c.HTTP.client(c.S3.InsecureSkipVerify, limiter)
+	if err != nil {
+		return fmt.Errorf("error configuring HTTP client: %s", err)
+	}
+
+	credentials, err := c.S3.credentials(httpClient)
+	if err != nil {
+		return err
+	}
+
+	symlinkPolicy := blobstore.NFSSymlinkPolicy(c.NFS.Symlinks)
+	if err := symlinkPolicy.Validate(); err != nil {
+		return err
+	}
+
+	nfsStore := blobstore.NewNFS(
+		c.NFS.Path,
+		blobstore.WithNFSBandwidthLimiter(limiter),
+		blobstore.WithNFSIgnore(c.NFS.Ignore),
+		blobstore.WithNFSSettleTime(c.NFS.SettleTime),
+		blobstore.WithNFSSymlinkPolicy(symlinkPolicy),
+	)
 	s3Store := blobstore.NewS3(
 		c.S3.AccessKey,
 		c.S3.SecretKey,
@@ -59,17 +133,31 @@ func (c *MigrateCommand) Execute([]string) error {
 		c.S3.DropletsBucketName,
 		c.S3.PackagesBucketName,
 		c.S3.ResourcesBucketName,
+		blobstore.WithS3HTTPClient(httpClient),
+		blobstore.WithS3Credentials(credentials),
+		blobstore.WithS3Encryption(encryption),
+		blobstore.WithS3Compatibility(compatibility),
+		blobstore.WithS3ObjectSettings(objectSettings),
+		blobstore.WithS3BucketProvisioning(provisioning),
+		blobstore.WithS3PartSize(int64(c.S3.PartSizeMB)*blobstore.MiB),
+		blobstore.WithS3UploadConcurrency(c.S3.UploadConcurrency),
 	)
 
-	blobMigrator := goblob.NewBlobMigrator(s3Store, nfsStore)
+	watchers, err := c.Watcher.watchers(reportSettings(c), c.Logging.Quiet)
+	if err != nil {
+		return err
+	}
+	defer watchers.close()
+
+	blobMigrator := goblob.NewBlobMigrator(s3Store, nfsStore, watchers.blobMigratorOpts...)
 	pool, err := workpool.NewWorkPool(c.ConcurrentUploads)
 	if err != nil {
 		return fmt.Errorf("error creating workpool: %s", err)
 	}
 
-	watcher := goblob.NewBlobstoreMigrationWatcher()
-
-	blobStoreMigrator := goblob.NewBlobstoreMigrator(pool, blobMigrator, c.Exclusions, watcher)
+	migratorOpts := append([]goblob.BlobstoreMigratorOption{goblob.WithBlobFilter(filter)}, failureOpts...)
+	migratorOpts = append(migratorOpts, watchers.migratorOpts...)
+	blobStoreMigrator := goblob.NewBlobstoreMigrator(pool, blobMigrator, c.Exclusions, watchers.watcher, migratorOpts...)
 
-	return blobStoreMigrator.Migrate(s3Store, nfsStore)
+	return watchers.finish(blobStoreMigrator.Migrate(s3Store, nfsStore))
 }
@@ -16,6 +16,7 @@ package commands
 
 import (
 	"fmt"
+	"time"
 
 	"code.cloudfoundry.org/workpool"
 	"github.com/pivotal-cf/goblob"
@@ -24,26 +25,131 @@ import (
 
 type MigrateToAzureBlobCommand struct {
 	ConcurrentUploads int      `long:"concurrent-uploads" env:"CONCURRENT_UPLOADS" default:"20"`
-	Exclusions        []string `long:"exclude" description:"blobstore directories to exclude, e.g. cc-resources"`
+	Exclusions        []string `long:"exclude" description:"bucket, or blob path glob or regular expression prefixed with re:, to exclude, e.g. cc-resources or cc-droplets/buildpack_cache/** (may be given more than once)"`
+
+	Filter FilterOptions `group:"Filter"`
+
+	Failures FailureOptions `group:"Failures"`
 
 	NFS struct {
-		Path string `long:"blobstore-path" env:"BLOBSTORE_PATH" description:"path to root of blobstore" default:"/var/vcap/store/shared"`
+		Path       string        `long:"blobstore-path" env:"BLOBSTORE_PATH" description:"path to root of blobstore" default:"/var/vcap/store/shared"`
+		Ignore     []string      `long:"nfs-ignore" description:"file name pattern to skip in addition to .nfs*, *.tmp, *.part, *~ and .*.swp (may be given more than once)"`
+		SettleTime time.Duration `long:"nfs-settle-time" env:"NFS_SETTLE_TIME" default:"30s" description:"defer files modified more recently than this until the end of their bucket"`
+		Symlinks   string        `long:"nfs-symlinks" default:"follow" description:"what to do with symbolic links: follow, skip or error"`
 	} `group:"NFS"`
 
 	AzStore struct {
-		AccountName          string `long:"azure-storage-account" env:"AZURE_STORAGE_ACCOUNT" description:"Azure storage account name"`
-		AccountKey           string `long:"azure-storage-account-key" env:"AZURE_STORAGE_ACCOUNT_KEY" description:"Azure storage account key"`
-		CloudName            string `long:"cloud-name" default:"AzureCloud" env:"AZURE_CLOUD" description:"cloud name, available names are: AzureCloud, AzureChinaCloud, AzureGermanCloud, AzureUSGovernment"`
-		BuildpacksBucketName string `long:"buildpacks-bucket-name" default:"cc-buildpacks" description:"name of bucket to store buildpacks in"`
-		DropletsBucketName   string `long:"droplets-bucket-name" default:"cc-droplets" description:"name of bucket to store droplets in"`
-		PackagesBucketName   string `long:"packages-bucket-name" default:"cc-packages" description:"name of bucket to store packages in"`
-		ResourcesBucketName  string `long:"resources-bucket-name" default:"cc-resources" description:"name of bucket to store resources in"`
+		AccountName          string            `long:"azure-storage-account" env:"AZURE_STORAGE_ACCOUNT" description:"Azure storage account name"`
+		AccountKey           string            `long:"azure-storage-account-key" env:"AZURE_STORAGE_ACCOUNT_KEY" description:"Azure storage account key"`
+		SASToken             string            `long:"azure-sas-token" env:"AZURE_STORAGE_SAS_TOKEN" description:"account or container SAS token to use instead of the account key"`
+		TenantID             string            `long:"azure-tenant-id" env:"AZURE_TENANT_ID" description:"Azure AD tenant of the service principal to use instead of the account key"`
+		ClientID             string            `long:"azure-client-id" env:"AZURE_CLIENT_ID" description:"application (client) ID of the service principal"`
+		ClientSecret         string            `long:"azure-client-secret" env:"AZURE_CLIENT_SECRET" description:"client secret of the service principal"`
+		ADEndpoint           string            `long:"azure-active-directory-endpoint" env:"AZURE_ACTIVE_DIRECTORY_ENDPOINT" description:"Azure AD endpoint to request tokens from (default: the one for the cloud)"`
+		CloudName            string            `long:"cloud-name" default:"AzureCloud" env:"AZURE_CLOUD" description:"cloud name, available names are: AzureCloud, AzureChinaCloud, AzureGermanCloud, AzureUSGovernment"`
+		Endpoint             string            `long:"azure-endpoint" env:"AZURE_STORAGE_ENDPOINT" description:"blob service URL to use instead of the cloud's, e.g. http://127.0.0.1:10000/devstoreaccount1 for Azurite"`
+		EndpointSuffix       string            `long:"azure-endpoint-suffix" env:"AZURE_STORAGE_ENDPOINT_SUFFIX" description:"storage endpoint suffix to use instead of the cloud's, e.g. local.azurestack.external for Azure Stack Hub"`
+		BuildpacksBucketName string            `long:"buildpacks-bucket-name" default:"cc-buildpacks" description:"name of bucket to store buildpacks in"`
+		DropletsBucketName   string            `long:"droplets-bucket-name" default:"cc-droplets" description:"name of bucket to store droplets in"`
+		PackagesBucketName   string            `long:"packages-bucket-name" default:"cc-packages" description:"name of bucket to store packages in"`
+		ResourcesBucketName  string            `long:"resources-bucket-name" default:"cc-resources" description:"name of bucket to store resources in"`
+		BlockSizeMB          int               `long:"azure-block-size-mb" env:"AZURE_BLOCK_SIZE_MB" default:"10" description:"minimum block size in MiB; raised for blobs that would need more than 50,000 blocks"`
+		UploadConcurrency    int               `long:"azure-upload-concurrency" env:"AZURE_UPLOAD_CONCURRENCY" default:"20" description:"blocks of a single blob uploaded at once"`
+		AccessTier           string            `long:"azure-access-tier" env:"AZURE_ACCESS_TIER" description:"access tier for uploaded blobs: Hot, Cool or Archive"`
+		AccessTiers          map[string]string `long:"azure-bucket-access-tier" description:"access tier for the blobs of one bucket, e.g. cc-droplets:Cool (may be given more than once)"`
+		Metadata             map[string]string `long:"azure-metadata" description:"metadata entry written to every blob, e.g. foundation:prod (may be given more than once)"`
 	} `group:"AzureBlob"`
+
+	HTTP HTTPOptions `group:"HTTP"`
+
+	Bandwidth BandwidthOptions `group:"Bandwidth"`
+
+	Watcher WatcherOptions `group:"Output"`
+
+	Logging LoggingOptions `group:"Logging"`
 }
 
 func (c *MigrateToAzureBlobCommand) Execute([]string) error {
-	nfsStore := blobstore.NewNFS(c.NFS.Path)
-	azblobStore := blobstore.NewAzBlobStore(
+	closeLog, err := c.Logging.setup()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if c.AzStore.BlockSizeMB < 1 || c.AzStore.BlockSizeMB > 100 {
+		return fmt.Errorf("invalid Azure block size %dMiB: it must be between 1MiB and 100MiB", c.AzStore.BlockSizeMB)
+	}
+	if c.AzStore.UploadConcurrency < 1 {
+		return fmt.Errorf("invalid Azure upload concurrency %d: at least 1 is required", c.AzStore.UploadConcurrency)
+	}
+
+	objectSettings := blobstore.AzBlobObjectSettings{
+		AccessTier:  c.AzStore.AccessTier,
+		AccessTiers: c.AzStore.AccessTiers,
+		Metadata:    c.AzStore.Metadata,
+	}
+	if err := objectSettings.Validate(); err != nil {
+		return fmt.Errorf("invalid Azure blob settings: %s", err)
+	}
+
+	filter, err := c.Filter.filter(c.Exclusions)
+	if err != nil {
+		return err
+	}
+
+	failureOpts, err := c.Failures.migratorOpts()
+	if err != nil {
+		return err
+	}
+
+	limiter, stopLimiter, err := c.Bandwidth.limiter()
+	if err != nil {
+		return err
+	}
+	defer stopLimiter()
+
+	httpClient, err := c.HTTP.client(false, limiter)
+	if err != nil {
+		return fmt.Errorf("error configuring HTTP client: %s", err)
+	}
+
+	symlinkPolicy := blobstore.NFSSymlinkPolicy(c.NFS.Symlinks)
+	if err := symlinkPolicy.Validate(); err != nil {
+		return err
+	}
+
+	nfsStore := blobstore.NewNFS(
+		c.NFS.Path,
+		blobstore.WithNFSBandwidthLimiter(limiter),
+		blobstore.WithNFSIgnore(c.NFS.Ignore),
+		blobstore.WithNFSSettleTime(c.NFS.SettleTime),
+		blobstore.WithNFSSymlinkPolicy(symlinkPolicy),
+	)
+	opts := []blobstore.AzBlobOption{
+		blobstore.WithAzBlobHTTPClient(httpClient),
+		blobstore.WithAzBlobBlockSize(int64(c.AzStore.BlockSizeMB) * blobstore.MiB),
+		blobstore.WithAzBlobUploadConcurrency(c.AzStore.UploadConcurrency),
+		blobstore.WithAzBlobObjectSettings(objectSettings),
+	}
+	if c.AzStore.Endpoint != "" {
+		opts = append(opts, blobstore.WithAzBlobEndpoint(c.AzStore.Endpoint))
+	}
+	if c.AzStore.EndpointSuffix != "" {
+		opts = append(opts, blobstore.WithAzBlobEndpointSuffix(c.AzStore.EndpointSuffix))
+	}
+	if c.AzStore.SASToken != "" {
+		opts = append(opts, blobstore.WithAzBlobSASToken(c.AzStore.SASToken))
+	}
+	if c.AzStore.TenantID != "" || c.AzStore.ClientID != "" || c.AzStore.ClientSecret != "" {
+		opts = append(opts, blobstore.WithAzBlobServicePrincipal(blobstore.AzServicePrincipal{
+			TenantID:                c.AzStore.TenantID,
+			ClientID:                c.AzStore.ClientID,
+			ClientSecret:            c.AzStore.ClientSecret,
+			ActiveDirectoryEndpoint: c.AzStore.ADEndpoint,
+		}))
+	}
+
+	azblobStore, err := blobstore.NewAzBlobStore(
 		c.AzStore.AccountName,
 		c.AzStore.AccountKey,
 		c.AzStore.CloudName,
@@ -51,17 +157,27 @@ func (c *MigrateToAzureBlobCommand) Execute([]string) error {
 		c.AzStore.DropletsBucketName,
 		c.AzStore.PackagesBucketName,
 		c.AzStore.ResourcesBucketName,
+		opts...,
 	)
+	if err != nil {
+		return fmt.Errorf("error configuring Azure blob storage: %s", err)
+	}
 
-	blobMigrator := goblob.NewBlobMigrator(azblobStore, nfsStore)
+	watchers, err := c.Watcher.watchers(reportSettings(c), c.Logging.Quiet)
+	if err != nil {
+		return err
+	}
+	defer watchers.close()
+
+	blobMigrator := goblob.NewBlobMigrator(azblobStore, nfsStore, watchers.blobMigratorOpts...)
 	pool, err := workpool.NewWorkPool(c.ConcurrentUploads)
 	if err != nil {
 		return fmt.Errorf("error creating workpool: %s", err)
 	}
 
-	watcher := goblob.NewBlobstoreMigrationWatcher()
-
-	blobStoreMigrator := goblob.NewBlobstoreMigrator(pool, blobMigrator, c.Exclusions, watcher)
+	migratorOpts := append([]goblob.BlobstoreMigratorOption{goblob.WithBlobFilter(filter)}, failureOpts...)
+	migratorOpts = append(migratorOpts, watchers.migratorOpts...)
+	blobStoreMigrator := goblob.NewBlobstoreMigrator(pool, blobMigrator, c.Exclusions, watchers.watcher, migratorOpts...)
 
-	return blobStoreMigrator.Migrate(azblobStore, nfsStore)
+	return watchers.finish(blobStoreMigrator.Migrate(azblobStore, nfsStore))
 }
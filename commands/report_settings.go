@@ -0,0 +1,82 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/pivotal-cf/goblob"
+)
+
+const redacted = "<redacted>"
+
+// secretOptionSuffixes end the names of options whose values are secrets.
+// Webhook URLs, e.g. Slack's, carry their credentials in the path, and hook
+// commands often carry them in their arguments.
+var secretOptionSuffixes = []string{"key", "secret", "password", "token", "external-id", "webhook", "hook-command"}
+
+// reportSettings lists the options command was given, by their long names,
+// with the values of secrets redacted and options left unset omitted
+func reportSettings(command interface{}) []goblob.ReportSetting {
+	var settings []goblob.ReportSetting
+	addReportSettings(reflect.Indirect(reflect.ValueOf(command)), &settings)
+	return settings
+}
+
+func addReportSettings(value reflect.Value, settings *[]goblob.ReportSetting) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Tag.Get("long")
+		if name == "" {
+			if field.Type.Kind() == reflect.Struct {
+				addReportSettings(value.Field(i), settings)
+			}
+			continue
+		}
+
+		option := value.Field(i).Interface()
+		if reflect.DeepEqual(option, reflect.Zero(field.Type).Interface()) {
+			continue
+		}
+		*settings = append(*settings, goblob.ReportSetting{
+			Name:  name,
+			Value: redact(name, fmt.Sprint(option)),
+		})
+	}
+}
+
+func redact(name, value string) string {
+	for _, suffix := range secretOptionSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return redacted
+		}
+	}
+
+	// e.g. a proxy URL with a password in it
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+			return u.String()
+		}
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+type S3CompatCheckCommand struct {
+	Bucket string `long:"bucket" description:"existing bucket to write, read and delete a probe object in"`
+
+	S3 S3Options `group:"S3"`
+
+	HTTP HTTPOptions `group:"HTTP"`
+}
+
+func (c *S3CompatCheckCommand) Execute([]string) error {
+	httpClient, err := c.HTTP.client(c.S3.InsecureSkipVerify, nil)
+	if err != nil {
+		return fmt.Errorf("error configuring HTTP client: %s", err)
+	}
+
+	credentials, err := c.S3.credentials(httpClient)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Probing %s\n\n", c.S3.Endpoint)
+
+	results := blobstore.CheckS3Compatibility(
+		c.S3.Endpoint,
+		c.S3.Region,
+		c.S3.DisableSSL,
+		credentials,
+		httpClient,
+		c.Bucket,
+	)
+
+	var recommended *blobstore.S3Compatibility
+	for i := range results {
+		if results[i].Err != nil {
+			fmt.Printf("%s\n  failed: %s\n", results[i].Compatibility, results[i].Err)
+			continue
+		}
+
+		fmt.Printf("%s\n  ok\n", results[i].Compatibility)
+		if recommended == nil {
+			recommended = &results[i].Compatibility
+		}
+	}
+
+	if recommended == nil {
+		return errors.New("no combination of settings worked with the endpoint")
+	}
+
+	fmt.Printf("\nRecommended settings: %s\n", *recommended)
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+type S3Options struct {
+	AccessKey            string `long:"s3-accesskey" env:"S3_ACCESSKEY" description:"S3 access key"`
+	SecretKey            string `long:"s3-secretkey" env:"S3_SECRETKEY" description:"S3 secret access key"`
+	CredentialSource     string `long:"s3-credential-source" env:"S3_CREDENTIAL_SOURCE" description:"where to load S3 credentials from: static, env, shared, instance or default (static when an access key is given, otherwise default)"`
+	Profile              string `long:"s3-profile" env:"AWS_PROFILE" description:"profile to read from the shared credentials file"`
+	CredentialsFile      string `long:"s3-shared-credentials-file" env:"AWS_SHARED_CREDENTIALS_FILE" description:"path to the shared credentials file (default: ~/.aws/credentials)"`
+	RoleARN              string `long:"s3-role-arn" env:"S3_ROLE_ARN" description:"ARN of a role to assume with the loaded credentials"`
+	RoleExternalID       string `long:"s3-role-external-id" env:"S3_ROLE_EXTERNAL_ID" description:"external ID to pass when assuming the role"`
+	RoleSessionName      string `long:"s3-role-session-name" description:"session name to use when assuming the role"`
+	STSEndpoint          string `long:"s3-sts-endpoint" env:"S3_STS_ENDPOINT" description:"STS endpoint to assume the role with"`
+	Region               string `long:"region" default:"us-east-1" env:"S3_REGION" description:"S3 region"`
+	Endpoint             string `long:"s3-endpoint" default:"https://s3.amazonaws.com" env:"S3_ENDPOINT"`
+	UseMultipartUploads  bool   `long:"use-multipart-uploads" env:"USE_MULTIPART_UPLOADS"`
+	PartSizeMB           int    `long:"s3-part-size-mb" env:"S3_PART_SIZE_MB" default:"10" description:"minimum multipart upload part size in MiB; raised for blobs that would need more than 10,000 parts"`
+	UploadConcurrency    int    `long:"s3-upload-concurrency" env:"S3_UPLOAD_CONCURRENCY" default:"20" description:"parts of a single blob uploaded at once"`
+	DisableSSL           bool   `long:"disable-ssl" description:"disable SSL connections to S3 endpoint"`
+	InsecureSkipVerify   bool   `long:"insecure-skip-verify" description:"disable verification of server certificate chain"`
+	BuildpacksBucketName string `long:"buildpacks-bucket-name" default:"cc-buildpacks" description:"name of bucket to store buildpacks in"`
+	DropletsBucketName   string `long:"droplets-bucket-name" default:"cc-droplets" description:"name of bucket to store droplets in"`
+	PackagesBucketName   string `long:"packages-bucket-name" default:"cc-packages" description:"name of bucket to store packages in"`
+	ResourcesBucketName  string `long:"resources-bucket-name" default:"cc-resources" description:"name of bucket to store resources in"`
+
+	SSE                string            `long:"s3-sse" env:"S3_SSE" description:"server-side encryption for uploaded objects: AES256, aws:kms or SSE-C"`
+	SSEKMSKeyID        string            `long:"s3-sse-kms-key-id" env:"S3_SSE_KMS_KEY_ID" description:"KMS key ID used with aws:kms encryption"`
+	SSEKMSContext      map[string]string `long:"s3-sse-kms-context" description:"KMS encryption context entry used with aws:kms encryption, e.g. foundation:prod (may be given more than once)"`
+	SSECustomerKeyFile string            `long:"s3-sse-c-key-file" env:"S3_SSE_C_KEY_FILE" description:"path to a file containing the 256-bit key used with SSE-C encryption"`
+
+	StorageClass   string            `long:"s3-storage-class" env:"S3_STORAGE_CLASS" description:"storage class for uploaded objects, e.g. STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING or GLACIER_IR"`
+	StorageClasses map[string]string `long:"s3-bucket-storage-class" description:"storage class for the objects of one bucket, e.g. cc-droplets:STANDARD_IA (may be given more than once)"`
+	Tags           string            `long:"s3-tags" env:"S3_TAGS" description:"tags for uploaded objects as key=value pairs separated by commas; values may use {{.Foundation}}, {{.Bucket}} and {{.BucketName}}"`
+	Foundation     string            `long:"foundation" env:"FOUNDATION" description:"name of the foundation, available to tags as {{.Foundation}}"`
+
+	NoCreateBuckets                    bool   `long:"no-create-buckets" description:"fail instead of creating buckets that do not exist"`
+	LocationConstraint                 string `long:"s3-location-constraint" env:"S3_LOCATION_CONSTRAINT" description:"region to create buckets in (default: the S3 region)"`
+	BucketVersioning                   bool   `long:"s3-bucket-versioning" description:"enable versioning on created buckets"`
+	BucketEncryption                   string `long:"s3-bucket-encryption" env:"S3_BUCKET_ENCRYPTION" description:"default encryption for created buckets: AES256 or aws:kms"`
+	BucketEncryptionKMSKeyID           string `long:"s3-bucket-encryption-kms-key-id" env:"S3_BUCKET_ENCRYPTION_KMS_KEY_ID" description:"KMS key ID used with aws:kms default encryption"`
+	BlockPublicAccess                  bool   `long:"s3-block-public-access" description:"block all public access to created buckets"`
+	NoncurrentVersionExpirationDays    int64  `long:"s3-noncurrent-version-expiration-days" description:"expire noncurrent object versions in created buckets after this many days"`
+	AbortIncompleteMultipartUploadDays int64  `long:"s3-abort-incomplete-multipart-upload-days" description:"abort incomplete multipart uploads in created buckets after this many days"`
+
+	AddressingStyle   string `long:"s3-addressing-style" env:"S3_ADDRESSING_STYLE" default:"path" description:"how to address buckets: path or virtual (virtual-hosted)"`
+	SignatureVersion  string `long:"s3-signature-version" env:"S3_SIGNATURE_VERSION" default:"v4" description:"request signature version: v4 or v2"`
+	UnsignedPayload   bool   `long:"s3-unsigned-payload" description:"do not sign request bodies (signature version v4 only)"`
+	DisableContentMD5 bool   `long:"s3-disable-content-md5" description:"do not send Content-MD5 headers"`
+}
+
+func (o S3Options) credentials(httpClient *http.Client) (*credentials.Credentials, error) {
+	creds, err := blobstore.NewS3Credentials(blobstore.S3Credentials{
+		Source:                o.CredentialSource,
+		AccessKey:             o.AccessKey,
+		SecretKey:             o.SecretKey,
+		Profile:               o.Profile,
+		SharedCredentialsFile: o.CredentialsFile,
+		RoleARN:               o.RoleARN,
+		ExternalID:            o.RoleExternalID,
+		RoleSessionName:       o.RoleSessionName,
+		STSEndpoint:           o.STSEndpoint,
+		Region:                o.Region,
+		HTTPClient:            httpClient,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading S3 credentials: %s", err)
+	}
+	return creds, nil
+}
+
+func (o S3Options) encryption() (blobstore.S3Encryption, error) {
+	encryption := blobstore.S3Encryption{
+		Mode:       o.SSE,
+		KMSKeyID:   o.SSEKMSKeyID,
+		KMSContext: o.SSEKMSContext,
+	}
+
+	if o.SSECustomerKeyFile != "" {
+		key, err := blobstore.ReadS3CustomerKey(o.SSECustomerKeyFile)
+		if err != nil {
+			return blobstore.S3Encryption{}, fmt.Errorf("error reading SSE-C key: %s", err)
+		}
+		encryption.CustomerKey = key
+	}
+
+	if err := encryption.Validate(); err != nil {
+		return blobstore.S3Encryption{}, fmt.Errorf("invalid S3 encryption settings: %s", err)
+	}
+	return encryption, nil
+}
+
+func (o S3Options) compatibility() (blobstore.S3Compatibility, error) {
+	compatibility := blobstore.S3Compatibility{
+		AddressingStyle:   o.AddressingStyle,
+		SignatureVersion:  o.SignatureVersion,
+		UnsignedPayload:   o.UnsignedPayload,
+		DisableContentMD5: o.DisableContentMD5,
+	}
+
+	if err := compatibility.Validate(); err != nil {
+		return blobstore.S3Compatibility{}, fmt.Errorf("invalid S3 compatibility settings: %s", err)
+	}
+	return compatibility, nil
+}
+
+func (o S3Options) objectSettings() (blobstore.S3ObjectSettings, error) {
+	settings := blobstore.S3ObjectSettings{
+		StorageClass:   o.StorageClass,
+		StorageClasses: o.StorageClasses,
+		Tags:           o.Tags,
+		Foundation:     o.Foundation,
+	}
+
+	if err := settings.Validate(); err != nil {
+		return blobstore.S3ObjectSettings{}, fmt.Errorf("invalid S3 object settings: %s", err)
+	}
+	return settings, nil
+}
+
+func (o S3Options) bucketProvisioning() (blobstore.S3BucketProvisioning, error) {
+	provisioning := blobstore.S3BucketProvisioning{
+		NoCreate:                           o.NoCreateBuckets,
+		LocationConstraint:                 o.LocationConstraint,
+		Versioning:                         o.BucketVersioning,
+		DefaultEncryption:                  o.BucketEncryption,
+		DefaultEncryptionKMSKeyID:          o.BucketEncryptionKMSKeyID,
+		BlockPublicAccess:                  o.BlockPublicAccess,
+		NoncurrentVersionExpirationDays:    o.NoncurrentVersionExpirationDays,
+		AbortIncompleteMultipartUploadDays: o.AbortIncompleteMultipartUploadDays,
+	}
+
+	if err := provisioning.Validate(); err != nil {
+		return blobstore.S3BucketProvisioning{}, fmt.Errorf("invalid S3 bucket settings: %s", err)
+	}
+	return provisioning, nil
+}
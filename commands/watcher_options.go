@@ -0,0 +1,194 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/logging"
+)
+
+type WatcherOptions struct {
+	EventLog         string        `long:"event-log" env:"EVENT_LOG" description:"file to append a line of JSON to for every blob migrated, skipped or failed"`
+	Progress         string        `long:"progress" default:"dots" description:"how to show progress: dots, one per blob, or bytes, with the rate, an estimate of the time left and the blobs being migrated"`
+	ProgressInterval time.Duration `long:"progress-interval" default:"30s" description:"how often to write a line of progress with --progress bytes when the output is not a terminal"`
+	MetricsAddr      string        `long:"metrics-addr" env:"METRICS_ADDR" description:"address to serve Prometheus metrics on at /metrics while migrating, e.g. :9090"`
+	ReportHTML       string        `long:"report-html" description:"file to write a report of the migration to as a web page"`
+	ReportCSV        string        `long:"report-csv" description:"file to write a table of what was migrated from each bucket to as CSV"`
+	ReportJUnit      string        `long:"report-junit" description:"file to write a report of the migration to as JUnit XML, with a failed test for each failed blob"`
+
+	Webhooks             []string `long:"webhook" description:"URL to post JSON to when the migration starts, as each bucket and the migration finish and when a failure threshold is reached (may be given more than once)"`
+	WebhookSecret        string   `long:"webhook-secret" env:"WEBHOOK_SECRET" description:"secret to sign webhooks with, as an HMAC-SHA256 of the body in the X-Goblob-Signature header"`
+	WebhookRetries       int      `long:"webhook-retries" default:"3" description:"how many times to retry a webhook that fails with a network or server error"`
+	HookCommands         []string `long:"hook-command" description:"command to run with sh -c for the same events as webhooks, with the event as JSON on stdin and its type in GOBLOB_EVENT (may be given more than once)"`
+	HookFailureThreshold int64    `long:"hook-failure-threshold" description:"number of failed blobs at which to send a failure_threshold_breached event to webhooks and hook commands"`
+}
+
+// watchers is the watcher for a migration, which may be several combined,
+// and what the migrators need to report to them
+type watchers struct {
+	watcher          goblob.BlobstoreMigrationWatcher
+	blobMigratorOpts []goblob.BlobMigratorOption
+	migratorOpts     []goblob.BlobstoreMigratorOption
+	// close stops serving metrics and closes the event log once the
+	// migration has finished
+	close func()
+
+	report  *goblob.ReportWatcher
+	options WatcherOptions
+}
+
+// watchers returns the console watcher combined with any others configured.
+// Reports list settings as the configuration of the migration. When quiet,
+// the console watcher prints nothing.
+func (o WatcherOptions) watchers(settings []goblob.ReportSetting, quiet bool) (*watchers, error) {
+	w := &watchers{close: func() {}, options: o}
+
+	all := []goblob.BlobstoreMigrationWatcher{goblob.NewLoggingMigrationWatcher()}
+	switch {
+	case quiet:
+		all = append(all, goblob.NewQuietBlobstoreMigrationWatcher())
+	case o.Progress == "dots":
+		all = append(all, goblob.NewBlobstoreMigrationWatcher())
+	case o.Progress == "bytes":
+		if o.ProgressInterval <= 0 {
+			return nil, fmt.Errorf("invalid progress interval %s: it must be positive", o.ProgressInterval)
+		}
+		progress := goblob.NewProgressWatcher(os.Stdout, isTerminal(os.Stdout), o.ProgressInterval)
+		// progress is drawn before the summary at the end of the migration
+		all = append(all, progress, goblob.NewBlobstoreMigrationSummaryWatcher())
+		w.blobMigratorOpts = append(w.blobMigratorOpts, goblob.WithTransferProgress(progress.Transferred))
+		w.migratorOpts = append(w.migratorOpts, goblob.WithListedHandler(progress.BucketWasListed))
+	default:
+		return nil, fmt.Errorf("unknown progress %q, expected dots or bytes", o.Progress)
+	}
+
+	var closers []func()
+	w.close = func() {
+		for _, closer := range closers {
+			closer()
+		}
+	}
+
+	if o.MetricsAddr != "" {
+		listener, err := net.Listen("tcp", o.MetricsAddr)
+		if err != nil {
+			return nil, fmt.Errorf("error serving metrics: %s", err)
+		}
+		metrics := goblob.NewMetricsWatcher()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		go http.Serve(listener, mux)
+		closers = append(closers, func() { listener.Close() })
+
+		all = append(all, metrics)
+		w.blobMigratorOpts = append(w.blobMigratorOpts, goblob.WithPhaseTimer(metrics.ObservePhase))
+		w.migratorOpts = append(w.migratorOpts, goblob.WithChecksumTimer(metrics.ObservePhase))
+	}
+
+	if o.EventLog != "" {
+		eventLog, err := os.OpenFile(o.EventLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			w.close()
+			return nil, fmt.Errorf("error opening event log: %s", err)
+		}
+		closers = append(closers, func() { eventLog.Close() })
+		all = append(all, goblob.NewJSONMigrationWatcher(eventLog))
+	}
+
+	if len(o.Webhooks) > 0 || len(o.HookCommands) > 0 {
+		if o.WebhookRetries < 0 {
+			w.close()
+			return nil, fmt.Errorf("invalid webhook retries %d: it must not be negative", o.WebhookRetries)
+		}
+		hookOpts := []goblob.HookOption{
+			goblob.WithWebhookRetries(o.WebhookRetries, time.Second),
+			goblob.WithHookFailureThreshold(o.HookFailureThreshold),
+		}
+		for _, url := range o.Webhooks {
+			hookOpts = append(hookOpts, goblob.WithWebhook(url, o.WebhookSecret))
+		}
+		for _, command := range o.HookCommands {
+			hookOpts = append(hookOpts, goblob.WithHookCommand(command))
+		}
+		hooks := goblob.NewHookWatcher(hookOpts...)
+		all = append(all, hooks)
+		w.migratorOpts = append(w.migratorOpts, goblob.WithFailureThresholdHandler(hooks.FailureThresholdCrossed))
+	}
+
+	if o.ReportHTML != "" || o.ReportCSV != "" || o.ReportJUnit != "" {
+		w.report = goblob.NewReportWatcher(settings)
+		all = append(all, w.report)
+	}
+
+	w.watcher = goblob.NewFanOutMigrationWatcher(all...)
+	return w, nil
+}
+
+// finish writes the reports for a migration that ended with migrateErr,
+// which is returned in preference to any error writing them
+func (w *watchers) finish(migrateErr error) error {
+	if w.report == nil {
+		return migrateErr
+	}
+
+	report := w.report.Report()
+	var reportErr error
+	for _, output := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{w.options.ReportHTML, report.WriteHTML},
+		{w.options.ReportCSV, report.WriteCSV},
+		{w.options.ReportJUnit, report.WriteJUnit},
+	} {
+		if output.path == "" {
+			continue
+		}
+		if err := writeReport(output.path, output.write); err != nil {
+			reportErr = err
+			logging.Error("error writing report", "error", err)
+		}
+	}
+
+	if migrateErr != nil {
+		return migrateErr
+	}
+	return reportErr
+}
+
+func writeReport(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating report: %s", err)
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return fmt.Errorf("error writing report %s: %s", path, err)
+	}
+	return file.Close()
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
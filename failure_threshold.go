@@ -0,0 +1,196 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+// DefaultFailureRateWindow is how many of the most recently finished blobs
+// a maximum failure rate applies to when no window is given
+const DefaultFailureRateWindow = 100
+
+// failureCauses is how many different causes of failure are counted to
+// find the most common one. Failures with other causes are still counted
+// towards the threshold.
+const failureCauses = 1000
+
+// FailureThreshold stops a migration early once so many blobs are failing
+// that carrying on would only record the same error again and again, e.g.
+// because credentials expired or the destination became read-only
+type FailureThreshold struct {
+	// MaxFailures is how many blobs may fail before the migration is
+	// stopped; zero means no limit
+	MaxFailures int64
+	// MaxFailureRate is the fraction, between zero and one, of the last
+	// Window blobs that may fail before the migration is stopped; zero
+	// means no limit
+	MaxFailureRate float64
+	// Window is how many of the most recently finished blobs the failure
+	// rate is measured over. The rate is not checked until that many
+	// blobs have finished.
+	Window int
+}
+
+// Validate checks that the limits are in range
+func (t FailureThreshold) Validate() error {
+	if t.MaxFailures < 0 {
+		return fmt.Errorf("invalid maximum failures %d: it must not be negative", t.MaxFailures)
+	}
+	if t.MaxFailureRate < 0 || t.MaxFailureRate >= 1 {
+		return fmt.Errorf("invalid maximum failure rate %g%%: it must be at least 0%% and less than 100%%", t.MaxFailureRate*100)
+	}
+	if t.Window < 0 {
+		return fmt.Errorf("invalid failure rate window %d: it must not be negative", t.Window)
+	}
+	return nil
+}
+
+// FailureThresholdError is why Migrate stopped when a FailureThreshold was
+// crossed
+type FailureThresholdError struct {
+	// Reason is which limit was crossed
+	Reason string
+	Failed int64
+	// Cause is the most common error, with blob paths replaced by <blob>,
+	// and Count how many blobs failed with it
+	Cause string
+	Count int64
+}
+
+func (e *FailureThresholdError) Error() string {
+	return fmt.Sprintf("migration stopped because %s; %d of the %d failed blobs failed with: %s", e.Reason, e.Count, e.Failed, e.Cause)
+}
+
+// WithFailureThreshold stops the migration once threshold is crossed. No
+// more blobs are migrated, those already being migrated are finished, and
+// Migrate returns a *MigrationError with the reason in its Threshold.
+func WithFailureThreshold(threshold FailureThreshold) BlobstoreMigratorOption {
+	return func(m *blobstoreMigrator) {
+		if threshold.MaxFailures == 0 && threshold.MaxFailureRate == 0 {
+			return
+		}
+		if threshold.Window == 0 {
+			threshold.Window = DefaultFailureRateWindow
+		}
+		m.failures = &failureTracker{
+			threshold: threshold,
+			window:    make([]bool, threshold.Window),
+			causes:    map[string]int64{},
+		}
+	}
+}
+
+// WithFailureThresholdHandler calls handler once, from the worker that
+// migrated the blob that crossed the threshold given with
+// WithFailureThreshold, before the migration stops
+func WithFailureThresholdHandler(handler func(*FailureThresholdError)) BlobstoreMigratorOption {
+	return func(m *blobstoreMigrator) {
+		m.thresholdHandlers = append(m.thresholdHandlers, handler)
+	}
+}
+
+// failureTracker counts failures towards a FailureThreshold
+type failureTracker struct {
+	threshold FailureThreshold
+
+	mutex  sync.Mutex
+	failed int64
+	causes map[string]int64
+	// window records whether each of the most recently finished blobs
+	// failed, oldest first from next once it is full
+	window         []bool
+	next           int
+	finished       int
+	windowFailures int
+	// crossed is why the threshold was crossed, once it has been
+	crossed string
+}
+
+// record counts a blob that finished, failing with err if it is not nil,
+// and reports whether it was the blob that crossed the threshold
+func (t *failureTracker) record(blob *blobstore.Blob, err error) bool {
+	if t == nil {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	failed := err != nil
+	if t.window[t.next] {
+		t.windowFailures--
+	}
+	t.window[t.next] = failed
+	t.next = (t.next + 1) % len(t.window)
+	if t.finished < len(t.window) {
+		t.finished++
+	}
+
+	if !failed {
+		return false
+	}
+
+	t.failed++
+	t.windowFailures++
+	var path string
+	if blob != nil {
+		path = blob.Path
+	}
+	cause := failureCause(err.Error(), path)
+	if _, ok := t.causes[cause]; ok || len(t.causes) < failureCauses {
+		t.causes[cause]++
+	}
+
+	if t.crossed != "" {
+		return false
+	}
+	if max := t.threshold.MaxFailures; max > 0 && t.failed > max {
+		t.crossed = fmt.Sprintf("more than %d blobs failed", max)
+		return true
+	}
+	rate := float64(t.windowFailures) / float64(len(t.window))
+	if max := t.threshold.MaxFailureRate; max > 0 && t.finished == len(t.window) && rate > max {
+		t.crossed = fmt.Sprintf("%d of the last %d blobs failed, more than %g%%", t.windowFailures, len(t.window), max*100)
+		return true
+	}
+	return false
+}
+
+// err counts every failure so far once the threshold has been crossed, and
+// is nil until then
+func (t *failureTracker) err() *FailureThresholdError {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.crossed == "" {
+		return nil
+	}
+
+	err := &FailureThresholdError{Reason: t.crossed, Failed: t.failed}
+	for cause, count := range t.causes {
+		if count > err.Count || (count == err.Count && cause < err.Cause) {
+			err.Cause = cause
+			err.Count = count
+		}
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"github.com/pivotal-cf/goblob"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FailureThreshold", func() {
+	Describe("Validate", func() {
+		It("accepts limits in range", func() {
+			Expect(goblob.FailureThreshold{}.Validate()).To(Succeed())
+			Expect(goblob.FailureThreshold{MaxFailures: 100, MaxFailureRate: 0.2, Window: 500}.Validate()).To(Succeed())
+		})
+
+		It("rejects a negative maximum", func() {
+			err := goblob.FailureThreshold{MaxFailures: -1}.Validate()
+			Expect(err).To(MatchError("invalid maximum failures -1: it must not be negative"))
+		})
+
+		It("rejects a rate of 100% or more", func() {
+			err := goblob.FailureThreshold{MaxFailureRate: 1}.Validate()
+			Expect(err).To(MatchError("invalid maximum failure rate 100%: it must be at least 0% and less than 100%"))
+		})
+
+		It("rejects a negative window", func() {
+			err := goblob.FailureThreshold{MaxFailureRate: 0.1, Window: -10}.Validate()
+			Expect(err).To(MatchError("invalid failure rate window -10: it must not be negative"))
+		})
+	})
+
+	It("describes the most common error", func() {
+		err := &goblob.FailureThresholdError{
+			Reason: "more than 5 blobs failed",
+			Failed: 8,
+			Cause:  "error writing blob at <blob>: AccessDenied",
+			Count:  7,
+		}
+		Expect(err.Error()).To(Equal("migration stopped because more than 5 blobs failed; 7 of the 8 failed blobs failed with: error writing blob at <blob>: AccessDenied"))
+	})
+})
@@ -15,6 +15,8 @@
 package goblob_test
 
 import (
+	"github.com/pivotal-cf/goblob/logging"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -25,3 +27,8 @@ func TestGoblob(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Goblob Suite")
 }
+
+var _ = BeforeSuite(func() {
+	// errors the specs expect are only shown for specs that fail
+	logging.SetDefault(logging.New(GinkgoWriter, logging.FormatText, logging.LevelInfo))
+})
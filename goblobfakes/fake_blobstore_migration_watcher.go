@@ -37,22 +37,43 @@ type FakeBlobstoreMigrationWatcher struct {
 	migrateBucketDidStartArgsForCall []struct {
 		arg1 string
 	}
-	MigrateBucketDidFinishStub             func()
-	migrateBucketDidFinishMutex            sync.RWMutex
-	migrateBucketDidFinishArgsForCall      []struct{}
-	MigrateBlobDidFailWithErrorStub        func(error)
+	MigrateBucketDidFinishStub        func(goblob.BucketEvent)
+	migrateBucketDidFinishMutex       sync.RWMutex
+	migrateBucketDidFinishArgsForCall []struct {
+		arg1 goblob.BucketEvent
+	}
+	MigrateBlobWasQueuedStub        func(goblob.BlobEvent)
+	migrateBlobWasQueuedMutex       sync.RWMutex
+	migrateBlobWasQueuedArgsForCall []struct {
+		arg1 goblob.BlobEvent
+	}
+	MigrateBlobDidStartStub        func(goblob.BlobEvent)
+	migrateBlobDidStartMutex       sync.RWMutex
+	migrateBlobDidStartArgsForCall []struct {
+		arg1 goblob.BlobEvent
+	}
+	MigrateBlobDidFailWithErrorStub        func(goblob.BlobEvent)
 	migrateBlobDidFailWithErrorMutex       sync.RWMutex
 	migrateBlobDidFailWithErrorArgsForCall []struct {
-		arg1 error
+		arg1 goblob.BlobEvent
+	}
+	MigrateBlobDidFinishStub        func(goblob.BlobEvent)
+	migrateBlobDidFinishMutex       sync.RWMutex
+	migrateBlobDidFinishArgsForCall []struct {
+		arg1 goblob.BlobEvent
+	}
+	MigrateBlobAlreadyFinishedStub        func(goblob.BlobEvent)
+	migrateBlobAlreadyFinishedMutex       sync.RWMutex
+	migrateBlobAlreadyFinishedArgsForCall []struct {
+		arg1 goblob.BlobEvent
+	}
+	MigrateBlobWasFilteredStub        func(goblob.BlobEvent)
+	migrateBlobWasFilteredMutex       sync.RWMutex
+	migrateBlobWasFilteredArgsForCall []struct {
+		arg1 goblob.BlobEvent
 	}
-	MigrateBlobDidFinishStub                  func()
-	migrateBlobDidFinishMutex                 sync.RWMutex
-	migrateBlobDidFinishArgsForCall           []struct{}
-	MigrateBlobDidFinishPreviouslyStub        func()
-	migrateBlobDidFinishPreviouslyMutex       sync.RWMutex
-	migrateBlobDidFinishPreviouslyArgsForCall []struct{}
-	invocations                               map[string][][]interface{}
-	invocationsMutex                          sync.RWMutex
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
 }
 
 func (fake *FakeBlobstoreMigrationWatcher) MigrationDidStart(arg1 blobstore.Blobstore, arg2 blobstore.Blobstore) {
@@ -120,13 +141,15 @@ func (fake *FakeBlobstoreMigrationWatcher) MigrateBucketDidStartArgsForCall(i in
 	return fake.migrateBucketDidStartArgsForCall[i].arg1
 }
 
-func (fake *FakeBlobstoreMigrationWatcher) MigrateBucketDidFinish() {
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBucketDidFinish(arg1 goblob.BucketEvent) {
 	fake.migrateBucketDidFinishMutex.Lock()
-	fake.migrateBucketDidFinishArgsForCall = append(fake.migrateBucketDidFinishArgsForCall, struct{}{})
-	fake.recordInvocation("MigrateBucketDidFinish", []interface{}{})
+	fake.migrateBucketDidFinishArgsForCall = append(fake.migrateBucketDidFinishArgsForCall, struct {
+		arg1 goblob.BucketEvent
+	}{arg1})
+	fake.recordInvocation("MigrateBucketDidFinish", []interface{}{arg1})
 	fake.migrateBucketDidFinishMutex.Unlock()
 	if fake.MigrateBucketDidFinishStub != nil {
-		fake.MigrateBucketDidFinishStub()
+		fake.MigrateBucketDidFinishStub(arg1)
 	}
 }
 
@@ -136,10 +159,64 @@ func (fake *FakeBlobstoreMigrationWatcher) MigrateBucketDidFinishCallCount() int
 	return len(fake.migrateBucketDidFinishArgsForCall)
 }
 
-func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFailWithError(arg1 error) {
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBucketDidFinishArgsForCall(i int) goblob.BucketEvent {
+	fake.migrateBucketDidFinishMutex.RLock()
+	defer fake.migrateBucketDidFinishMutex.RUnlock()
+	return fake.migrateBucketDidFinishArgsForCall[i].arg1
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobWasQueued(arg1 goblob.BlobEvent) {
+	fake.migrateBlobWasQueuedMutex.Lock()
+	fake.migrateBlobWasQueuedArgsForCall = append(fake.migrateBlobWasQueuedArgsForCall, struct {
+		arg1 goblob.BlobEvent
+	}{arg1})
+	fake.recordInvocation("MigrateBlobWasQueued", []interface{}{arg1})
+	fake.migrateBlobWasQueuedMutex.Unlock()
+	if fake.MigrateBlobWasQueuedStub != nil {
+		fake.MigrateBlobWasQueuedStub(arg1)
+	}
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobWasQueuedCallCount() int {
+	fake.migrateBlobWasQueuedMutex.RLock()
+	defer fake.migrateBlobWasQueuedMutex.RUnlock()
+	return len(fake.migrateBlobWasQueuedArgsForCall)
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobWasQueuedArgsForCall(i int) goblob.BlobEvent {
+	fake.migrateBlobWasQueuedMutex.RLock()
+	defer fake.migrateBlobWasQueuedMutex.RUnlock()
+	return fake.migrateBlobWasQueuedArgsForCall[i].arg1
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidStart(arg1 goblob.BlobEvent) {
+	fake.migrateBlobDidStartMutex.Lock()
+	fake.migrateBlobDidStartArgsForCall = append(fake.migrateBlobDidStartArgsForCall, struct {
+		arg1 goblob.BlobEvent
+	}{arg1})
+	fake.recordInvocation("MigrateBlobDidStart", []interface{}{arg1})
+	fake.migrateBlobDidStartMutex.Unlock()
+	if fake.MigrateBlobDidStartStub != nil {
+		fake.MigrateBlobDidStartStub(arg1)
+	}
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidStartCallCount() int {
+	fake.migrateBlobDidStartMutex.RLock()
+	defer fake.migrateBlobDidStartMutex.RUnlock()
+	return len(fake.migrateBlobDidStartArgsForCall)
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidStartArgsForCall(i int) goblob.BlobEvent {
+	fake.migrateBlobDidStartMutex.RLock()
+	defer fake.migrateBlobDidStartMutex.RUnlock()
+	return fake.migrateBlobDidStartArgsForCall[i].arg1
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFailWithError(arg1 goblob.BlobEvent) {
 	fake.migrateBlobDidFailWithErrorMutex.Lock()
 	fake.migrateBlobDidFailWithErrorArgsForCall = append(fake.migrateBlobDidFailWithErrorArgsForCall, struct {
-		arg1 error
+		arg1 goblob.BlobEvent
 	}{arg1})
 	fake.recordInvocation("MigrateBlobDidFailWithError", []interface{}{arg1})
 	fake.migrateBlobDidFailWithErrorMutex.Unlock()
@@ -154,19 +231,21 @@ func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFailWithErrorCallCount(
 	return len(fake.migrateBlobDidFailWithErrorArgsForCall)
 }
 
-func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFailWithErrorArgsForCall(i int) error {
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFailWithErrorArgsForCall(i int) goblob.BlobEvent {
 	fake.migrateBlobDidFailWithErrorMutex.RLock()
 	defer fake.migrateBlobDidFailWithErrorMutex.RUnlock()
 	return fake.migrateBlobDidFailWithErrorArgsForCall[i].arg1
 }
 
-func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFinish() {
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFinish(arg1 goblob.BlobEvent) {
 	fake.migrateBlobDidFinishMutex.Lock()
-	fake.migrateBlobDidFinishArgsForCall = append(fake.migrateBlobDidFinishArgsForCall, struct{}{})
-	fake.recordInvocation("MigrateBlobDidFinish", []interface{}{})
+	fake.migrateBlobDidFinishArgsForCall = append(fake.migrateBlobDidFinishArgsForCall, struct {
+		arg1 goblob.BlobEvent
+	}{arg1})
+	fake.recordInvocation("MigrateBlobDidFinish", []interface{}{arg1})
 	fake.migrateBlobDidFinishMutex.Unlock()
 	if fake.MigrateBlobDidFinishStub != nil {
-		fake.MigrateBlobDidFinishStub()
+		fake.MigrateBlobDidFinishStub(arg1)
 	}
 }
 
@@ -176,20 +255,58 @@ func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFinishCallCount() int {
 	return len(fake.migrateBlobDidFinishArgsForCall)
 }
 
-func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobAlreadyFinished() {
-	fake.migrateBlobDidFinishPreviouslyMutex.Lock()
-	fake.migrateBlobDidFinishPreviouslyArgsForCall = append(fake.migrateBlobDidFinishPreviouslyArgsForCall, struct{}{})
-	fake.recordInvocation("MigrateBlobDidFinishPreviously", []interface{}{})
-	fake.migrateBlobDidFinishPreviouslyMutex.Unlock()
-	if fake.MigrateBlobDidFinishPreviouslyStub != nil {
-		fake.MigrateBlobDidFinishPreviouslyStub()
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFinishArgsForCall(i int) goblob.BlobEvent {
+	fake.migrateBlobDidFinishMutex.RLock()
+	defer fake.migrateBlobDidFinishMutex.RUnlock()
+	return fake.migrateBlobDidFinishArgsForCall[i].arg1
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobAlreadyFinished(arg1 goblob.BlobEvent) {
+	fake.migrateBlobAlreadyFinishedMutex.Lock()
+	fake.migrateBlobAlreadyFinishedArgsForCall = append(fake.migrateBlobAlreadyFinishedArgsForCall, struct {
+		arg1 goblob.BlobEvent
+	}{arg1})
+	fake.recordInvocation("MigrateBlobAlreadyFinished", []interface{}{arg1})
+	fake.migrateBlobAlreadyFinishedMutex.Unlock()
+	if fake.MigrateBlobAlreadyFinishedStub != nil {
+		fake.MigrateBlobAlreadyFinishedStub(arg1)
 	}
 }
 
-func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobDidFinishPreviouslyCallCount() int {
-	fake.migrateBlobDidFinishPreviouslyMutex.RLock()
-	defer fake.migrateBlobDidFinishPreviouslyMutex.RUnlock()
-	return len(fake.migrateBlobDidFinishPreviouslyArgsForCall)
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobAlreadyFinishedCallCount() int {
+	fake.migrateBlobAlreadyFinishedMutex.RLock()
+	defer fake.migrateBlobAlreadyFinishedMutex.RUnlock()
+	return len(fake.migrateBlobAlreadyFinishedArgsForCall)
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobAlreadyFinishedArgsForCall(i int) goblob.BlobEvent {
+	fake.migrateBlobAlreadyFinishedMutex.RLock()
+	defer fake.migrateBlobAlreadyFinishedMutex.RUnlock()
+	return fake.migrateBlobAlreadyFinishedArgsForCall[i].arg1
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobWasFiltered(arg1 goblob.BlobEvent) {
+	fake.migrateBlobWasFilteredMutex.Lock()
+	fake.migrateBlobWasFilteredArgsForCall = append(fake.migrateBlobWasFilteredArgsForCall, struct {
+		arg1 goblob.BlobEvent
+	}{arg1})
+	fake.recordInvocation("MigrateBlobWasFiltered", []interface{}{arg1})
+	fake.migrateBlobWasFilteredMutex.Unlock()
+	if fake.MigrateBlobWasFilteredStub != nil {
+		fake.MigrateBlobWasFilteredStub(arg1)
+	}
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobWasFilteredCallCount() int {
+	fake.migrateBlobWasFilteredMutex.RLock()
+	defer fake.migrateBlobWasFilteredMutex.RUnlock()
+	return len(fake.migrateBlobWasFilteredArgsForCall)
+}
+
+func (fake *FakeBlobstoreMigrationWatcher) MigrateBlobWasFilteredArgsForCall(i int) goblob.BlobEvent {
+	fake.migrateBlobWasFilteredMutex.RLock()
+	defer fake.migrateBlobWasFilteredMutex.RUnlock()
+	return fake.migrateBlobWasFilteredArgsForCall[i].arg1
 }
 
 func (fake *FakeBlobstoreMigrationWatcher) Invocations() map[string][][]interface{} {
@@ -203,12 +320,18 @@ func (fake *FakeBlobstoreMigrationWatcher) Invocations() map[string][][]interfac
 	defer fake.migrateBucketDidStartMutex.RUnlock()
 	fake.migrateBucketDidFinishMutex.RLock()
 	defer fake.migrateBucketDidFinishMutex.RUnlock()
+	fake.migrateBlobWasQueuedMutex.RLock()
+	defer fake.migrateBlobWasQueuedMutex.RUnlock()
+	fake.migrateBlobDidStartMutex.RLock()
+	defer fake.migrateBlobDidStartMutex.RUnlock()
 	fake.migrateBlobDidFailWithErrorMutex.RLock()
 	defer fake.migrateBlobDidFailWithErrorMutex.RUnlock()
 	fake.migrateBlobDidFinishMutex.RLock()
 	defer fake.migrateBlobDidFinishMutex.RUnlock()
-	fake.migrateBlobDidFinishPreviouslyMutex.RLock()
-	defer fake.migrateBlobDidFinishPreviouslyMutex.RUnlock()
+	fake.migrateBlobAlreadyFinishedMutex.RLock()
+	defer fake.migrateBlobAlreadyFinishedMutex.RUnlock()
+	fake.migrateBlobWasFilteredMutex.RLock()
+	defer fake.migrateBlobWasFilteredMutex.RUnlock()
 	return fake.invocations
 }
 
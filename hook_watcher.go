@@ -0,0 +1,383 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/logging"
+)
+
+// EventFailureThresholdBreached is sent to hooks once as many blobs have
+// failed as the threshold given with WithHookFailureThreshold
+const EventFailureThresholdBreached = "failure_threshold_breached"
+
+// HookSignatureHeader carries the HMAC-SHA256 of a webhook's body, keyed
+// with the secret given to WithWebhook, as "sha256=<hex>"
+const HookSignatureHeader = "X-Goblob-Signature"
+
+const (
+	defaultWebhookRetries = 3
+	defaultWebhookBackoff = time.Second
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// HookEvent is the JSON payload posted to webhooks and passed to hook
+// commands on stdin. The counts are for the bucket in bucket_finished
+// events and for the whole migration otherwise.
+type HookEvent struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Bucket      string    `json:"bucket,omitempty"`
+	// Duration is in seconds
+	Duration        float64 `json:"duration,omitempty"`
+	Migrated        int64   `json:"migrated"`
+	AlreadyMigrated int64   `json:"already_migrated"`
+	Failed          int64   `json:"failed"`
+	Filtered        int64   `json:"filtered"`
+	// Threshold is the number of failures that was reached, in
+	// failure_threshold_breached events sent for WithHookFailureThreshold
+	Threshold int64 `json:"threshold,omitempty"`
+	// Error is the error of the failure that reached the threshold, or why
+	// the migration's FailureThreshold stopped it
+	Error string `json:"error,omitempty"`
+}
+
+// HookOption configures a HookWatcher
+type HookOption func(*HookWatcher)
+
+// WithWebhook posts every event to url. When secret is not empty each
+// request is signed with it in the HookSignatureHeader header.
+func WithWebhook(url, secret string) HookOption {
+	return func(w *HookWatcher) {
+		w.webhooks = append(w.webhooks, webhook{url: url, secret: secret})
+	}
+}
+
+// WithHookCommand runs command with sh -c for every event, with the event
+// as JSON on stdin and its type in the GOBLOB_EVENT environment variable
+func WithHookCommand(command string) HookOption {
+	return func(w *HookWatcher) {
+		w.commands = append(w.commands, command)
+	}
+}
+
+// WithHookFailureThreshold sends a failure_threshold_breached event when
+// the threshold-th blob fails to migrate
+func WithHookFailureThreshold(threshold int64) HookOption {
+	return func(w *HookWatcher) {
+		w.threshold = threshold
+	}
+}
+
+// WithWebhookRetries sets how many times a webhook that fails is tried
+// again, and how long to wait before the first retry. The wait doubles
+// with each retry.
+func WithWebhookRetries(retries int, backoff time.Duration) HookOption {
+	return func(w *HookWatcher) {
+		w.retries = retries
+		w.backoff = backoff
+	}
+}
+
+// WithWebhookHTTPClient sets the client webhooks are posted with
+func WithWebhookHTTPClient(client *http.Client) HookOption {
+	return func(w *HookWatcher) {
+		w.client = client
+	}
+}
+
+// HookWatcher notifies webhooks and runs hook commands when a migration
+// starts, when each bucket and the migration finish, and when the failure
+// threshold given with WithHookFailureThreshold, or the migration's own
+// FailureThreshold, is breached.
+//
+// Hooks are run one at a time, in order, before the migration carries on.
+// A hook that fails is logged and does not fail the migration.
+type HookWatcher struct {
+	webhooks  []webhook
+	commands  []string
+	threshold int64
+	retries   int
+	backoff   time.Duration
+	client    *http.Client
+	now       func() time.Time
+
+	// hookMutex keeps hooks in order, even for events from different
+	// workers
+	hookMutex sync.Mutex
+
+	mutex          sync.Mutex
+	source         string
+	destination    string
+	migrationStart time.Time
+	total          hookCounts
+	buckets        map[string]*hookCounts
+}
+
+type webhook struct {
+	url    string
+	secret string
+}
+
+type hookCounts struct {
+	migrated        int64
+	alreadyMigrated int64
+	failed          int64
+	filtered        int64
+}
+
+// NewHookWatcher creates a HookWatcher. It does nothing without at least
+// one webhook or hook command.
+func NewHookWatcher(opts ...HookOption) *HookWatcher {
+	w := &HookWatcher{
+		retries: defaultWebhookRetries,
+		backoff: defaultWebhookBackoff,
+		client:  &http.Client{Timeout: defaultWebhookTimeout},
+		now:     time.Now,
+		buckets: map[string]*hookCounts{},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+func (w *HookWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
+	w.mutex.Lock()
+	w.source = src.Name()
+	w.destination = dst.Name()
+	w.migrationStart = w.now()
+	event := w.event(EventMigrationStarted, w.total)
+	w.mutex.Unlock()
+
+	w.send(event)
+}
+
+func (w *HookWatcher) MigrationDidFinish() {
+	w.mutex.Lock()
+	event := w.event(EventMigrationFinished, w.total)
+	event.Duration = event.Time.Sub(w.migrationStart).Seconds()
+	w.mutex.Unlock()
+
+	w.send(event)
+}
+
+func (w *HookWatcher) MigrateBucketDidStart(bucket string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buckets[bucket] = &hookCounts{}
+}
+
+func (w *HookWatcher) MigrateBucketDidFinish(bucket BucketEvent) {
+	w.mutex.Lock()
+	var counts hookCounts
+	if c, ok := w.buckets[bucket.Bucket]; ok {
+		counts = *c
+	}
+	event := w.event(EventBucketFinished, counts)
+	event.Bucket = bucket.Bucket
+	event.Duration = bucket.Duration.Seconds()
+	w.mutex.Unlock()
+
+	w.send(event)
+}
+
+func (w *HookWatcher) MigrateBlobWasQueued(BlobEvent) {}
+
+func (w *HookWatcher) MigrateBlobDidStart(BlobEvent) {}
+
+func (w *HookWatcher) MigrateBlobDidFailWithError(blob BlobEvent) {
+	w.mutex.Lock()
+	w.count(blob.Bucket, func(c *hookCounts) { c.failed++ })
+	breached := w.threshold > 0 && w.total.failed == w.threshold
+	var event HookEvent
+	if breached {
+		event = w.event(EventFailureThresholdBreached, w.total)
+		event.Bucket = blob.Bucket
+		event.Threshold = w.threshold
+		if blob.Err != nil {
+			event.Error = blob.Err.Error()
+		}
+	}
+	w.mutex.Unlock()
+
+	if breached {
+		w.send(event)
+	}
+}
+
+// FailureThresholdCrossed sends a failure_threshold_breached event for a
+// migration stopped by its FailureThreshold. Pass it to the migrator with
+// WithFailureThresholdHandler.
+func (w *HookWatcher) FailureThresholdCrossed(err *FailureThresholdError) {
+	w.mutex.Lock()
+	event := w.event(EventFailureThresholdBreached, w.total)
+	event.Error = err.Error()
+	w.mutex.Unlock()
+
+	w.send(event)
+}
+
+func (w *HookWatcher) MigrateBlobDidFinish(blob BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.count(blob.Bucket, func(c *hookCounts) { c.migrated++ })
+}
+
+func (w *HookWatcher) MigrateBlobAlreadyFinished(blob BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.count(blob.Bucket, func(c *hookCounts) { c.alreadyMigrated++ })
+}
+
+func (w *HookWatcher) MigrateBlobWasFiltered(blob BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.count(blob.Bucket, func(c *hookCounts) { c.filtered++ })
+}
+
+// count applies add to the totals and to those of bucket; the caller
+// holds the mutex
+func (w *HookWatcher) count(bucket string, add func(*hookCounts)) {
+	add(&w.total)
+	if c, ok := w.buckets[bucket]; ok {
+		add(c)
+	}
+}
+
+// event creates an event of eventType with counts; the caller holds the
+// mutex
+func (w *HookWatcher) event(eventType string, counts hookCounts) HookEvent {
+	return HookEvent{
+		Time:            w.now().UTC(),
+		Event:           eventType,
+		Source:          w.source,
+		Destination:     w.destination,
+		Migrated:        counts.migrated,
+		AlreadyMigrated: counts.alreadyMigrated,
+		Failed:          counts.failed,
+		Filtered:        counts.filtered,
+	}
+}
+
+func (w *HookWatcher) send(event HookEvent) {
+	w.hookMutex.Lock()
+	defer w.hookMutex.Unlock()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		logging.Error("error encoding hook event", "event", event.Event, "error", err)
+		return
+	}
+
+	// Webhook URLs and hook commands may contain credentials, so hooks are
+	// logged by their position among the hooks given
+	for i, hook := range w.webhooks {
+		if err := w.post(hook, body); err != nil {
+			logging.Error("error sending webhook", "event", event.Event, "webhook", i+1, "error", err)
+		}
+	}
+	for i, command := range w.commands {
+		if err := runHookCommand(command, event.Event, body); err != nil {
+			logging.Error("error running hook command", "event", event.Event, "hook", i+1, "error", err)
+		}
+	}
+}
+
+// post sends body to hook, trying again after network errors, server
+// errors and rate limiting
+func (w *HookWatcher) post(hook webhook, body []byte) error {
+	backoff := w.backoff
+	var err error
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = w.postOnce(hook, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (w *HookWatcher) postOnce(hook webhook, body []byte) (bool, error) {
+	request, err := http.NewRequest("POST", hook.url, bytes.NewReader(body))
+	if err != nil {
+		return false, withoutURL(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if hook.secret != "" {
+		request.Header.Set(HookSignatureHeader, SignHookPayload(hook.secret, body))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return true, withoutURL(err)
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned %s", response.Status)
+}
+
+// withoutURL strips the webhook URL from errors the HTTP client returns
+func withoutURL(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
+// SignHookPayload returns the value of the HookSignatureHeader header for
+// body, for receivers to compare with the one they were sent
+func SignHookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func runHookCommand(command, eventType string, body []byte) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "GOBLOB_EVENT="+eventType)
+	return cmd.Run()
+}
@@ -0,0 +1,324 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
+	"github.com/pivotal-cf/goblob/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type hookRequest struct {
+	signature string
+	body      []byte
+	event     goblob.HookEvent
+}
+
+// hookReceiver records the webhooks it is sent, responding to each with
+// the next of statuses and then with 200 OK
+type hookReceiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []hookRequest
+}
+
+func (r *hookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	Expect(err).NotTo(HaveOccurred())
+
+	var event goblob.HookEvent
+	Expect(json.Unmarshal(body, &event)).To(Succeed())
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, hookRequest{
+		signature: req.Header.Get(goblob.HookSignatureHeader),
+		body:      body,
+		event:     event,
+	})
+	if len(r.statuses) > 0 {
+		w.WriteHeader(r.statuses[0])
+		r.statuses = r.statuses[1:]
+	}
+}
+
+func (r *hookReceiver) events() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var events []string
+	for _, request := range r.requests {
+		events = append(events, request.event.Event)
+	}
+	return events
+}
+
+var _ = Describe("HookWatcher", func() {
+	var (
+		receiver *hookReceiver
+		server   *httptest.Server
+		dstStore *blobstorefakes.FakeBlobstore
+		srcStore *blobstorefakes.FakeBlobstore
+	)
+
+	blobEvent := func(bucket string) goblob.BlobEvent {
+		return goblob.BlobEvent{Bucket: bucket, Blob: &blobstore.Blob{Path: "some-path"}}
+	}
+
+	migrate := func(watcher goblob.BlobstoreMigrationWatcher) {
+		watcher.MigrationDidStart(dstStore, srcStore)
+		watcher.MigrateBucketDidStart("cc-droplets")
+		watcher.MigrateBlobDidFinish(blobEvent("cc-droplets"))
+		watcher.MigrateBlobDidFinish(blobEvent("cc-droplets"))
+		watcher.MigrateBlobAlreadyFinished(blobEvent("cc-droplets"))
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-droplets", Duration: 2 * time.Second})
+		watcher.MigrateBucketDidStart("cc-packages")
+		watcher.MigrateBlobWasFiltered(blobEvent("cc-packages"))
+		failed := blobEvent("cc-packages")
+		failed.Err = errors.New("AccessDenied")
+		watcher.MigrateBlobDidFailWithError(failed)
+		watcher.MigrateBlobDidFailWithError(failed)
+		watcher.MigrateBlobDidFailWithError(failed)
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-packages", Duration: time.Second})
+		watcher.MigrationDidFinish()
+	}
+
+	BeforeEach(func() {
+		receiver = &hookReceiver{}
+		server = httptest.NewServer(receiver)
+
+		dstStore = &blobstorefakes.FakeBlobstore{}
+		dstStore.NameReturns("S3")
+		srcStore = &blobstorefakes.FakeBlobstore{}
+		srcStore.NameReturns("NFS")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("posts lifecycle events to the webhook", func() {
+		migrate(goblob.NewHookWatcher(goblob.WithWebhook(server.URL, "")))
+
+		Expect(receiver.events()).To(Equal([]string{
+			goblob.EventMigrationStarted,
+			goblob.EventBucketFinished,
+			goblob.EventBucketFinished,
+			goblob.EventMigrationFinished,
+		}))
+
+		started := receiver.requests[0].event
+		Expect(started.Source).To(Equal("NFS"))
+		Expect(started.Destination).To(Equal("S3"))
+
+		droplets := receiver.requests[1].event
+		Expect(droplets.Bucket).To(Equal("cc-droplets"))
+		Expect(droplets.Duration).To(Equal(2.0))
+		Expect(droplets.Migrated).To(Equal(int64(2)))
+		Expect(droplets.AlreadyMigrated).To(Equal(int64(1)))
+		Expect(droplets.Failed).To(BeZero())
+
+		packages := receiver.requests[2].event
+		Expect(packages.Bucket).To(Equal("cc-packages"))
+		Expect(packages.Migrated).To(BeZero())
+		Expect(packages.Filtered).To(Equal(int64(1)))
+		Expect(packages.Failed).To(Equal(int64(3)))
+
+		finished := receiver.requests[3].event
+		Expect(finished.Migrated).To(Equal(int64(2)))
+		Expect(finished.AlreadyMigrated).To(Equal(int64(1)))
+		Expect(finished.Filtered).To(Equal(int64(1)))
+		Expect(finished.Failed).To(Equal(int64(3)))
+
+		for _, request := range receiver.requests {
+			Expect(request.signature).To(BeEmpty())
+		}
+	})
+
+	It("signs webhooks with the secret", func() {
+		migrate(goblob.NewHookWatcher(goblob.WithWebhook(server.URL, "some-secret")))
+
+		Expect(receiver.requests).NotTo(BeEmpty())
+		for _, request := range receiver.requests {
+			Expect(request.signature).To(HavePrefix("sha256="))
+			Expect(request.signature).To(Equal(goblob.SignHookPayload("some-secret", request.body)))
+			Expect(request.signature).NotTo(Equal(goblob.SignHookPayload("other-secret", request.body)))
+		}
+	})
+
+	It("sends an event when the failure threshold is breached, once", func() {
+		migrate(goblob.NewHookWatcher(
+			goblob.WithWebhook(server.URL, ""),
+			goblob.WithHookFailureThreshold(2),
+		))
+
+		Expect(receiver.events()).To(Equal([]string{
+			goblob.EventMigrationStarted,
+			goblob.EventBucketFinished,
+			goblob.EventFailureThresholdBreached,
+			goblob.EventBucketFinished,
+			goblob.EventMigrationFinished,
+		}))
+
+		breached := receiver.requests[2].event
+		Expect(breached.Threshold).To(Equal(int64(2)))
+		Expect(breached.Failed).To(Equal(int64(2)))
+		Expect(breached.Bucket).To(Equal("cc-packages"))
+		Expect(breached.Error).To(Equal("AccessDenied"))
+	})
+
+	It("sends an event when the migration's failure threshold stops it", func() {
+		watcher := goblob.NewHookWatcher(goblob.WithWebhook(server.URL, ""))
+		watcher.MigrationDidStart(dstStore, srcStore)
+		failed := blobEvent("cc-packages")
+		failed.Err = errors.New("AccessDenied")
+		watcher.MigrateBlobDidFailWithError(failed)
+		watcher.FailureThresholdCrossed(&goblob.FailureThresholdError{
+			Reason: "more than 0 blobs failed",
+			Failed: 1,
+			Cause:  "AccessDenied",
+			Count:  1,
+		})
+
+		Expect(receiver.events()).To(Equal([]string{
+			goblob.EventMigrationStarted,
+			goblob.EventFailureThresholdBreached,
+		}))
+		breached := receiver.requests[1].event
+		Expect(breached.Failed).To(Equal(int64(1)))
+		Expect(breached.Threshold).To(BeZero())
+		Expect(breached.Error).To(Equal("migration stopped because more than 0 blobs failed; 1 of the 1 failed blobs failed with: AccessDenied"))
+	})
+
+	It("retries webhooks that fail with a server error", func() {
+		receiver.statuses = []int{http.StatusBadGateway, http.StatusTooManyRequests}
+		watcher := goblob.NewHookWatcher(
+			goblob.WithWebhook(server.URL, ""),
+			goblob.WithWebhookRetries(2, time.Millisecond),
+		)
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+
+		Expect(receiver.events()).To(Equal([]string{
+			goblob.EventMigrationStarted,
+			goblob.EventMigrationStarted,
+			goblob.EventMigrationStarted,
+		}))
+	})
+
+	It("gives up on webhooks after the retries", func() {
+		receiver.statuses = []int{500, 500, 500, 500}
+		watcher := goblob.NewHookWatcher(
+			goblob.WithWebhook(server.URL, ""),
+			goblob.WithWebhookRetries(1, time.Millisecond),
+		)
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+		Expect(receiver.events()).To(HaveLen(2))
+
+		watcher.MigrationDidFinish()
+		Expect(receiver.events()).To(HaveLen(4))
+	})
+
+	It("does not retry webhooks that are rejected", func() {
+		receiver.statuses = []int{http.StatusForbidden}
+		watcher := goblob.NewHookWatcher(
+			goblob.WithWebhook(server.URL, ""),
+			goblob.WithWebhookRetries(2, time.Millisecond),
+		)
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+
+		Expect(receiver.events()).To(HaveLen(1))
+	})
+
+	Context("with a hook command", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "hook-watcher")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("runs the command with the event on stdin", func() {
+			migrate(goblob.NewHookWatcher(
+				goblob.WithHookCommand(`cat > "` + dir + `/$GOBLOB_EVENT.json"`),
+			))
+
+			files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(ConsistOf(
+				filepath.Join(dir, "migration_started.json"),
+				filepath.Join(dir, "bucket_finished.json"),
+				filepath.Join(dir, "migration_finished.json"),
+			))
+
+			contents, err := ioutil.ReadFile(filepath.Join(dir, "migration_finished.json"))
+			Expect(err).NotTo(HaveOccurred())
+			var event goblob.HookEvent
+			Expect(json.Unmarshal(contents, &event)).To(Succeed())
+			Expect(event.Event).To(Equal(goblob.EventMigrationFinished))
+			Expect(event.Migrated).To(Equal(int64(2)))
+			Expect(event.Failed).To(Equal(int64(3)))
+		})
+
+		It("carries on when the command fails", func() {
+			watcher := goblob.NewHookWatcher(
+				goblob.WithHookCommand("exit 1"),
+				goblob.WithWebhook(server.URL, ""),
+			)
+
+			watcher.MigrationDidStart(dstStore, srcStore)
+
+			Expect(receiver.events()).To(HaveLen(1))
+		})
+
+		It("logs which hook failed without logging its command", func() {
+			out := new(bytes.Buffer)
+			previous := logging.Default()
+			logging.SetDefault(logging.New(out, logging.FormatText, logging.LevelInfo))
+			defer logging.SetDefault(previous)
+
+			watcher := goblob.NewHookWatcher(
+				goblob.WithHookCommand("true"),
+				goblob.WithHookCommand("TOKEN=some-token; exit 1"),
+			)
+
+			watcher.MigrationDidStart(dstStore, srcStore)
+
+			Expect(out.String()).To(ContainSubstring("error running hook command event=migration_started hook=2 error="))
+			Expect(out.String()).NotTo(ContainSubstring("some-token"))
+		})
+	})
+})
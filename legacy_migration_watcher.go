@@ -0,0 +1,78 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import "github.com/pivotal-cf/goblob/blobstore"
+
+// LegacyBlobstoreMigrationWatcher is the BlobstoreMigrationWatcher interface
+// from before events carried the blob or bucket they refer to
+type LegacyBlobstoreMigrationWatcher interface {
+	MigrationDidStart(blobstore.Blobstore, blobstore.Blobstore)
+	MigrationDidFinish()
+
+	MigrateBucketDidStart(string)
+	MigrateBucketDidFinish()
+
+	MigrateBlobDidFailWithError(error)
+	MigrateBlobDidFinish()
+	MigrateBlobAlreadyFinished()
+	MigrateBlobWasFiltered(reason string)
+}
+
+// AdaptLegacyWatcher passes events to a watcher written against the legacy
+// interface, dropping what it has no way to receive
+func AdaptLegacyWatcher(watcher LegacyBlobstoreMigrationWatcher) BlobstoreMigrationWatcher {
+	return &legacyWatcherAdapter{watcher: watcher}
+}
+
+type legacyWatcherAdapter struct {
+	watcher LegacyBlobstoreMigrationWatcher
+}
+
+func (a *legacyWatcherAdapter) MigrationDidStart(dst, src blobstore.Blobstore) {
+	a.watcher.MigrationDidStart(dst, src)
+}
+
+func (a *legacyWatcherAdapter) MigrationDidFinish() {
+	a.watcher.MigrationDidFinish()
+}
+
+func (a *legacyWatcherAdapter) MigrateBucketDidStart(bucket string) {
+	a.watcher.MigrateBucketDidStart(bucket)
+}
+
+func (a *legacyWatcherAdapter) MigrateBucketDidFinish(BucketEvent) {
+	a.watcher.MigrateBucketDidFinish()
+}
+
+func (a *legacyWatcherAdapter) MigrateBlobWasQueued(BlobEvent) {}
+
+func (a *legacyWatcherAdapter) MigrateBlobDidStart(BlobEvent) {}
+
+func (a *legacyWatcherAdapter) MigrateBlobDidFailWithError(event BlobEvent) {
+	a.watcher.MigrateBlobDidFailWithError(event.Err)
+}
+
+func (a *legacyWatcherAdapter) MigrateBlobDidFinish(BlobEvent) {
+	a.watcher.MigrateBlobDidFinish()
+}
+
+func (a *legacyWatcherAdapter) MigrateBlobAlreadyFinished(BlobEvent) {
+	a.watcher.MigrateBlobAlreadyFinished()
+}
+
+func (a *legacyWatcherAdapter) MigrateBlobWasFiltered(event BlobEvent) {
+	a.watcher.MigrateBlobWasFiltered(event.Reason)
+}
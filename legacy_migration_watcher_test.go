@@ -0,0 +1,95 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"errors"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type legacyWatcher struct {
+	calls []string
+	err   error
+}
+
+func (w *legacyWatcher) MigrationDidStart(blobstore.Blobstore, blobstore.Blobstore) {
+	w.calls = append(w.calls, "MigrationDidStart")
+}
+
+func (w *legacyWatcher) MigrationDidFinish() {
+	w.calls = append(w.calls, "MigrationDidFinish")
+}
+
+func (w *legacyWatcher) MigrateBucketDidStart(bucket string) {
+	w.calls = append(w.calls, "MigrateBucketDidStart "+bucket)
+}
+
+func (w *legacyWatcher) MigrateBucketDidFinish() {
+	w.calls = append(w.calls, "MigrateBucketDidFinish")
+}
+
+func (w *legacyWatcher) MigrateBlobDidFailWithError(err error) {
+	w.calls = append(w.calls, "MigrateBlobDidFailWithError")
+	w.err = err
+}
+
+func (w *legacyWatcher) MigrateBlobDidFinish() {
+	w.calls = append(w.calls, "MigrateBlobDidFinish")
+}
+
+func (w *legacyWatcher) MigrateBlobAlreadyFinished() {
+	w.calls = append(w.calls, "MigrateBlobAlreadyFinished")
+}
+
+func (w *legacyWatcher) MigrateBlobWasFiltered(reason string) {
+	w.calls = append(w.calls, "MigrateBlobWasFiltered "+reason)
+}
+
+var _ = Describe("AdaptLegacyWatcher", func() {
+	It("passes events on without their context", func() {
+		legacy := &legacyWatcher{}
+		watcher := goblob.AdaptLegacyWatcher(legacy)
+
+		blob := &blobstore.Blob{Path: "some-path"}
+		err := errors.New("some-error")
+
+		watcher.MigrationDidStart(&blobstorefakes.FakeBlobstore{}, &blobstorefakes.FakeBlobstore{})
+		watcher.MigrateBucketDidStart("cc-packages")
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob})
+		watcher.MigrateBlobAlreadyFinished(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob})
+		watcher.MigrateBlobWasFiltered(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Reason: "some-reason"})
+		watcher.MigrateBlobDidFailWithError(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Err: err})
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-packages"})
+		watcher.MigrationDidFinish()
+
+		Expect(legacy.calls).To(Equal([]string{
+			"MigrationDidStart",
+			"MigrateBucketDidStart cc-packages",
+			"MigrateBlobDidFinish",
+			"MigrateBlobAlreadyFinished",
+			"MigrateBlobWasFiltered some-reason",
+			"MigrateBlobDidFailWithError",
+			"MigrateBucketDidFinish",
+			"MigrationDidFinish",
+		}))
+		Expect(legacy.err).To(Equal(err))
+	})
+})
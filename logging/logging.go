@@ -0,0 +1,242 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is how important a message is
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(level string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(level, name) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+}
+
+// Format is how messages are written
+type Format string
+
+const (
+	// FormatText writes a line of the time, level, message and key=value
+	// pairs
+	FormatText Format = "text"
+	// FormatJSON writes a JSON object per line with time, level and msg
+	// keys alongside the key-value pairs
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses text or json
+func ParseFormat(format string) (Format, error) {
+	switch Format(format) {
+	case FormatText, FormatJSON:
+		return Format(format), nil
+	}
+	return "", fmt.Errorf("unknown log format %q, expected text or json", format)
+}
+
+// Logger writes messages at or above its level to a writer. Each message
+// takes a list of alternating keys and values, e.g.
+//
+//	logger.Info("listed bucket", "bucket", "cc-droplets", "blobs", 12)
+//
+// Loggers are safe to use from many goroutines at once.
+type Logger struct {
+	mutex  sync.Mutex
+	out    io.Writer
+	format Format
+	level  Level
+	now    func() time.Time
+}
+
+// New creates a Logger
+func New(out io.Writer, format Format, level Level) *Logger {
+	return &Logger{
+		out:    out,
+		format: format,
+		level:  level,
+		now:    time.Now,
+	}
+}
+
+// Enabled reports whether messages at level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	t := l.now().UTC()
+	var line []byte
+	if l.format == FormatJSON {
+		line = jsonLine(t, level, msg, keyvals)
+	} else {
+		line = textLine(t, level, msg, keyvals)
+	}
+	l.out.Write(line)
+}
+
+func textLine(t time.Time, level Level, msg string, keyvals []interface{}) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %-5s %s", t.Format(time.RFC3339), strings.ToUpper(level.String()), msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		fmt.Fprintf(&buf, " %s=%s", key(keyvals, i), quote(fmt.Sprint(value(keyvals, i))))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// quote quotes values that would otherwise be ambiguous
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func jsonLine(t time.Time, level Level, msg string, keyvals []interface{}) []byte {
+	fields := map[string]interface{}{
+		"time":  t.Format(time.RFC3339Nano),
+		"level": level.String(),
+		"msg":   msg,
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		v := value(keyvals, i)
+		switch v := v.(type) {
+		case error:
+			fields[key(keyvals, i)] = v.Error()
+		case fmt.Stringer:
+			fields[key(keyvals, i)] = v.String()
+		default:
+			fields[key(keyvals, i)] = v
+		}
+	}
+
+	line, err := json.Marshal(fields)
+	if err != nil {
+		line, _ = json.Marshal(map[string]interface{}{
+			"time":  fields["time"],
+			"level": fields["level"],
+			"msg":   msg,
+			"error": fmt.Sprintf("error encoding log message: %s", err),
+		})
+	}
+	return append(line, '\n')
+}
+
+func key(keyvals []interface{}, i int) string {
+	return fmt.Sprint(keyvals[i])
+}
+
+// value is the value for the key at i, which is missing when keyvals has
+// an odd length
+func value(keyvals []interface{}, i int) interface{} {
+	if i+1 < len(keyvals) {
+		return keyvals[i+1]
+	}
+	return "(missing)"
+}
+
+var (
+	defaultMutex  sync.RWMutex
+	defaultLogger = New(os.Stderr, FormatText, LevelInfo)
+)
+
+// Default is the logger the package-level functions write to. Until
+// SetDefault is called it writes info and above to stderr as text.
+func Default() *Logger {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault replaces the logger the package-level functions write to
+func SetDefault(logger *Logger) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultLogger = logger
+}
+
+func Debug(msg string, keyvals ...interface{}) {
+	Default().log(LevelDebug, msg, keyvals)
+}
+
+func Info(msg string, keyvals ...interface{}) {
+	Default().log(LevelInfo, msg, keyvals)
+}
+
+func Warn(msg string, keyvals ...interface{}) {
+	Default().log(LevelWarn, msg, keyvals)
+}
+
+func Error(msg string, keyvals ...interface{}) {
+	Default().log(LevelError, msg, keyvals)
+}
@@ -0,0 +1,119 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/pivotal-cf/goblob/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		out = new(bytes.Buffer)
+	})
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	}
+
+	It("writes messages at or above its level", func() {
+		logger := logging.New(out, logging.FormatText, logging.LevelWarn)
+
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Warn("warn")
+		logger.Error("error")
+
+		Expect(lines()).To(HaveLen(2))
+		Expect(lines()[0]).To(MatchRegexp(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ WARN  warn$`))
+		Expect(lines()[1]).To(HaveSuffix(" ERROR error"))
+		Expect(logger.Enabled(logging.LevelInfo)).To(BeFalse())
+		Expect(logger.Enabled(logging.LevelError)).To(BeTrue())
+	})
+
+	It("writes key-value pairs as text", func() {
+		logger := logging.New(out, logging.FormatText, logging.LevelDebug)
+
+		logger.Info("listed bucket", "bucket", "cc-droplets", "blobs", 12, "error", errors.New("access denied"), "empty", "", "odd")
+
+		Expect(lines()).To(HaveLen(1))
+		Expect(lines()[0]).To(HaveSuffix(` INFO  listed bucket bucket=cc-droplets blobs=12 error="access denied" empty="" odd=(missing)`))
+	})
+
+	It("writes key-value pairs as JSON", func() {
+		logger := logging.New(out, logging.FormatJSON, logging.LevelDebug)
+
+		logger.Warn("skipping file", "path", "cc-droplets/ab", "size", 12, "error", errors.New("access denied"))
+
+		var message map[string]interface{}
+		Expect(json.Unmarshal(out.Bytes(), &message)).To(Succeed())
+		Expect(message).To(HaveKey("time"))
+		delete(message, "time")
+		Expect(message).To(Equal(map[string]interface{}{
+			"level": "warn",
+			"msg":   "skipping file",
+			"path":  "cc-droplets/ab",
+			"size":  12.0,
+			"error": "access denied",
+		}))
+	})
+
+	It("replaces the default logger", func() {
+		previous := logging.Default()
+		defer logging.SetDefault(previous)
+
+		logging.SetDefault(logging.New(out, logging.FormatText, logging.LevelInfo))
+		logging.Debug("debug")
+		logging.Info("info", "key", "value")
+
+		Expect(lines()).To(HaveLen(1))
+		Expect(lines()[0]).To(HaveSuffix(" INFO  info key=value"))
+	})
+})
+
+var _ = Describe("ParseLevel", func() {
+	It("parses level names", func() {
+		Expect(logging.ParseLevel("debug")).To(Equal(logging.LevelDebug))
+		Expect(logging.ParseLevel("INFO")).To(Equal(logging.LevelInfo))
+		Expect(logging.ParseLevel("warn")).To(Equal(logging.LevelWarn))
+		Expect(logging.ParseLevel("error")).To(Equal(logging.LevelError))
+	})
+
+	It("rejects unknown levels", func() {
+		_, err := logging.ParseLevel("verbose")
+		Expect(err).To(MatchError(`unknown log level "verbose", expected debug, info, warn or error`))
+	})
+})
+
+var _ = Describe("ParseFormat", func() {
+	It("parses text and json", func() {
+		Expect(logging.ParseFormat("text")).To(Equal(logging.FormatText))
+		Expect(logging.ParseFormat("json")).To(Equal(logging.FormatJSON))
+	})
+
+	It("rejects unknown formats", func() {
+		_, err := logging.ParseFormat("logfmt")
+		Expect(err).To(MatchError(`unknown log format "logfmt", expected text or json`))
+	})
+})
@@ -0,0 +1,80 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/logging"
+)
+
+// NewLoggingMigrationWatcher logs everything that happens during a
+// migration at debug level, for following a migration with --log-level
+// debug
+func NewLoggingMigrationWatcher() BlobstoreMigrationWatcher {
+	return loggingMigrationWatcher{}
+}
+
+type loggingMigrationWatcher struct{}
+
+func (loggingMigrationWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
+	logging.Debug("migration started", "source", src.Name(), "destination", dst.Name())
+}
+
+func (loggingMigrationWatcher) MigrationDidFinish() {
+	logging.Debug("migration finished")
+}
+
+func (loggingMigrationWatcher) MigrateBucketDidStart(bucket string) {
+	logging.Debug("bucket started", "bucket", bucket)
+}
+
+func (loggingMigrationWatcher) MigrateBucketDidFinish(bucket BucketEvent) {
+	logging.Debug("bucket finished", "bucket", bucket.Bucket, "duration", bucket.Duration)
+}
+
+func (loggingMigrationWatcher) MigrateBlobWasQueued(blob BlobEvent) {
+	logBlob("blob queued", blob)
+}
+
+func (loggingMigrationWatcher) MigrateBlobDidStart(blob BlobEvent) {
+	logBlob("blob started", blob, "attempt", blob.Attempt)
+}
+
+func (loggingMigrationWatcher) MigrateBlobDidFailWithError(blob BlobEvent) {
+	logBlob("blob failed", blob, "attempt", blob.Attempt, "error", blob.Err)
+}
+
+func (loggingMigrationWatcher) MigrateBlobDidFinish(blob BlobEvent) {
+	logBlob("blob migrated", blob, "bytes", blob.Bytes, "duration", blob.Duration)
+}
+
+func (loggingMigrationWatcher) MigrateBlobAlreadyFinished(blob BlobEvent) {
+	logBlob("blob already migrated", blob)
+}
+
+func (loggingMigrationWatcher) MigrateBlobWasFiltered(blob BlobEvent) {
+	logBlob("blob filtered", blob, "reason", blob.Reason)
+}
+
+func logBlob(msg string, blob BlobEvent, keyvals ...interface{}) {
+	if !logging.Default().Enabled(logging.LevelDebug) {
+		return
+	}
+	path := ""
+	if blob.Blob != nil {
+		path = blob.Blob.Path
+	}
+	logging.Debug(msg, append([]interface{}{"bucket", blob.Bucket, "path", path}, keyvals...)...)
+}
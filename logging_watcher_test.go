@@ -0,0 +1,83 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
+	"github.com/pivotal-cf/goblob/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoggingMigrationWatcher", func() {
+	var (
+		out      *bytes.Buffer
+		previous *logging.Logger
+		watcher  goblob.BlobstoreMigrationWatcher
+	)
+
+	BeforeEach(func() {
+		out = new(bytes.Buffer)
+		previous = logging.Default()
+		watcher = goblob.NewLoggingMigrationWatcher()
+	})
+
+	AfterEach(func() {
+		logging.SetDefault(previous)
+	})
+
+	migrate := func() {
+		dstStore := &blobstorefakes.FakeBlobstore{}
+		dstStore.NameReturns("S3")
+		srcStore := &blobstorefakes.FakeBlobstore{}
+		srcStore.NameReturns("NFS")
+		blob := &blobstore.Blob{Path: "cc-droplets/ab/cd/some-blob"}
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+		watcher.MigrateBucketDidStart("cc-droplets")
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{Bucket: "cc-droplets", Blob: blob, Bytes: 10, Duration: time.Second})
+		watcher.MigrateBlobDidFailWithError(goblob.BlobEvent{Bucket: "cc-droplets", Blob: blob, Attempt: 2, Err: errors.New("AccessDenied")})
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-droplets", Duration: 2 * time.Second})
+		watcher.MigrationDidFinish()
+	}
+
+	It("logs every event at debug level", func() {
+		logging.SetDefault(logging.New(out, logging.FormatText, logging.LevelDebug))
+
+		migrate()
+
+		Expect(out.String()).To(ContainSubstring("DEBUG migration started source=NFS destination=S3\n"))
+		Expect(out.String()).To(ContainSubstring("DEBUG bucket started bucket=cc-droplets\n"))
+		Expect(out.String()).To(ContainSubstring("DEBUG blob migrated bucket=cc-droplets path=cc-droplets/ab/cd/some-blob bytes=10 duration=1s\n"))
+		Expect(out.String()).To(ContainSubstring("DEBUG blob failed bucket=cc-droplets path=cc-droplets/ab/cd/some-blob attempt=2 error=AccessDenied\n"))
+		Expect(out.String()).To(ContainSubstring("DEBUG bucket finished bucket=cc-droplets duration=2s\n"))
+		Expect(out.String()).To(ContainSubstring("DEBUG migration finished\n"))
+	})
+
+	It("logs nothing above debug level", func() {
+		logging.SetDefault(logging.New(out, logging.FormatText, logging.LevelInfo))
+
+		migrate()
+
+		Expect(out.String()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,260 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+// Results a blob is counted under by the metrics watcher
+const (
+	resultMigrated        = "migrated"
+	resultAlreadyMigrated = "already_migrated"
+	resultFailed          = "failed"
+	resultFiltered        = "filtered"
+)
+
+// phaseHistogramBuckets are the upper bounds, in seconds, of the phase
+// latency histograms. Blobs range from a few bytes to gigabytes, so they
+// reach further than Prometheus's defaults.
+var phaseHistogramBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600,
+}
+
+// MetricsWatcher counts blobs and bytes by bucket and result, retries and
+// the time spent in each phase of migrating a blob, and serves them to
+// Prometheus in its text format.
+//
+// Phases are timed by passing ObservePhase to the blob migrator with
+// WithPhaseTimer and to the blobstore migrator with WithChecksumTimer.
+type MetricsWatcher struct {
+	mutex    sync.Mutex
+	running  bool
+	blobs    map[bucketResult]int64
+	bytes    map[bucketResult]int64
+	retries  map[string]int64
+	phases   map[Phase]*histogram
+	queued   int64
+	inFlight int64
+}
+
+type bucketResult struct {
+	bucket string
+	result string
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+// NewMetricsWatcher creates a MetricsWatcher with every counter at zero
+func NewMetricsWatcher() *MetricsWatcher {
+	return &MetricsWatcher{
+		blobs:   map[bucketResult]int64{},
+		bytes:   map[bucketResult]int64{},
+		retries: map[string]int64{},
+		phases:  map[Phase]*histogram{},
+	}
+}
+
+// ObservePhase records how long a phase of migrating a blob took
+func (w *MetricsWatcher) ObservePhase(blob *blobstore.Blob, phase Phase, duration time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	h, ok := w.phases[phase]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(phaseHistogramBuckets))}
+		w.phases[phase] = h
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range phaseHistogramBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (w *MetricsWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.running = true
+}
+
+func (w *MetricsWatcher) MigrationDidFinish() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.running = false
+}
+
+func (w *MetricsWatcher) MigrateBucketDidStart(string) {}
+
+func (w *MetricsWatcher) MigrateBucketDidFinish(BucketEvent) {}
+
+func (w *MetricsWatcher) MigrateBlobWasQueued(BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.queued++
+}
+
+func (w *MetricsWatcher) MigrateBlobDidStart(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if event.Attempt > 1 {
+		w.retries[event.Bucket]++
+		return
+	}
+	w.queued--
+	w.inFlight++
+}
+
+func (w *MetricsWatcher) MigrateBlobDidFinish(event BlobEvent) {
+	w.count(event, resultMigrated, event.Bytes, true)
+}
+
+func (w *MetricsWatcher) MigrateBlobAlreadyFinished(event BlobEvent) {
+	w.count(event, resultAlreadyMigrated, blobSize(event), true)
+}
+
+func (w *MetricsWatcher) MigrateBlobDidFailWithError(event BlobEvent) {
+	w.count(event, resultFailed, blobSize(event), true)
+}
+
+func (w *MetricsWatcher) MigrateBlobWasFiltered(event BlobEvent) {
+	w.count(event, resultFiltered, blobSize(event), false)
+}
+
+func (w *MetricsWatcher) count(event BlobEvent, result string, bytes int64, started bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	key := bucketResult{bucket: event.Bucket, result: result}
+	w.blobs[key]++
+	w.bytes[key] += bytes
+	if started {
+		w.inFlight--
+	}
+}
+
+func blobSize(event BlobEvent) int64 {
+	if event.Blob == nil {
+		return 0
+	}
+	return event.Blob.Size
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (w *MetricsWatcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	rw.Write(w.metrics())
+}
+
+func (w *MetricsWatcher) metrics() []byte {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	buf := new(bytes.Buffer)
+
+	running := 0
+	if w.running {
+		running = 1
+	}
+	writeMetricHeader(buf, "goblob_migration_running", "gauge", "Whether a migration is running.")
+	fmt.Fprintf(buf, "goblob_migration_running %d\n", running)
+
+	writeMetricHeader(buf, "goblob_blobs_total", "counter", "Blobs by bucket and result: migrated, already_migrated, failed or filtered.")
+	for _, key := range sortedBucketResults(w.blobs) {
+		fmt.Fprintf(buf, "goblob_blobs_total{bucket=%s,result=%s} %d\n", quoteLabel(key.bucket), quoteLabel(key.result), w.blobs[key])
+	}
+
+	writeMetricHeader(buf, "goblob_bytes_total", "counter", "Bytes of blobs by bucket and result; only migrated bytes were uploaded.")
+	for _, key := range sortedBucketResults(w.bytes) {
+		fmt.Fprintf(buf, "goblob_bytes_total{bucket=%s,result=%s} %d\n", quoteLabel(key.bucket), quoteLabel(key.result), w.bytes[key])
+	}
+
+	writeMetricHeader(buf, "goblob_blob_retries_total", "counter", "Blobs started again because they changed while they were migrated.")
+	var buckets []string
+	for bucket := range w.retries {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	for _, bucket := range buckets {
+		fmt.Fprintf(buf, "goblob_blob_retries_total{bucket=%s} %d\n", quoteLabel(bucket), w.retries[bucket])
+	}
+
+	writeMetricHeader(buf, "goblob_workers_in_flight", "gauge", "Blobs being migrated.")
+	fmt.Fprintf(buf, "goblob_workers_in_flight %d\n", w.inFlight)
+
+	writeMetricHeader(buf, "goblob_queue_depth", "gauge", "Blobs waiting for a worker.")
+	fmt.Fprintf(buf, "goblob_queue_depth %d\n", w.queued)
+
+	writeMetricHeader(buf, "goblob_blob_phase_duration_seconds", "histogram", "Time spent in each phase of migrating a blob: checksum, read, write, copy or verify.")
+	var phases []string
+	for phase := range w.phases {
+		phases = append(phases, string(phase))
+	}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		h := w.phases[Phase(phase)]
+		label := quoteLabel(phase)
+		for i, bound := range phaseHistogramBuckets {
+			fmt.Fprintf(buf, "goblob_blob_phase_duration_seconds_bucket{phase=%s,le=%q} %d\n", label, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(buf, "goblob_blob_phase_duration_seconds_bucket{phase=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(buf, "goblob_blob_phase_duration_seconds_sum{phase=%s} %s\n", label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "goblob_blob_phase_duration_seconds_count{phase=%s} %d\n", label, h.count)
+	}
+
+	return buf.Bytes()
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func sortedBucketResults(values map[bucketResult]int64) []bucketResult {
+	var keys []bucketResult
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].bucket != keys[j].bucket {
+			return keys[i].bucket < keys[j].bucket
+		}
+		return keys[i].result < keys[j].result
+	})
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,103 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetricsWatcher", func() {
+	var (
+		watcher *goblob.MetricsWatcher
+		blob    *blobstore.Blob
+	)
+
+	scrape := func() string {
+		server := httptest.NewServer(watcher)
+		defer server.Close()
+
+		response, err := server.Client().Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		Expect(response.Header.Get("Content-Type")).To(Equal("text/plain; version=0.0.4"))
+
+		body, err := ioutil.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(body)
+	}
+
+	BeforeEach(func() {
+		watcher = goblob.NewMetricsWatcher()
+		blob = &blobstore.Blob{Path: "some-path", Size: 100}
+	})
+
+	It("counts blobs and bytes by bucket and result", func() {
+		watcher.MigrationDidStart(&blobstorefakes.FakeBlobstore{}, &blobstorefakes.FakeBlobstore{})
+		for i := 0; i < 4; i++ {
+			watcher.MigrateBlobWasQueued(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob})
+			watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Attempt: 1})
+		}
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Bytes: 100})
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Bytes: 100})
+		watcher.MigrateBlobAlreadyFinished(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob})
+		watcher.MigrateBlobWasFiltered(goblob.BlobEvent{Bucket: "cc-droplets", Blob: blob, Reason: "some-reason"})
+
+		metrics := scrape()
+		Expect(metrics).To(ContainSubstring("# TYPE goblob_blobs_total counter\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blobs_total{bucket="cc-droplets",result="filtered"} 1` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blobs_total{bucket="cc-packages",result="already_migrated"} 1` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blobs_total{bucket="cc-packages",result="migrated"} 2` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_bytes_total{bucket="cc-packages",result="migrated"} 200` + "\n"))
+		Expect(metrics).To(ContainSubstring("goblob_workers_in_flight 1\n"))
+		Expect(metrics).To(ContainSubstring("goblob_queue_depth 0\n"))
+		Expect(metrics).To(ContainSubstring("goblob_migration_running 1\n"))
+	})
+
+	It("counts queued blobs and retries", func() {
+		watcher.MigrateBlobWasQueued(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob})
+		watcher.MigrateBlobWasQueued(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob})
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Attempt: 1})
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Attempt: 2})
+
+		metrics := scrape()
+		Expect(metrics).To(ContainSubstring("goblob_queue_depth 1\n"))
+		Expect(metrics).To(ContainSubstring("goblob_workers_in_flight 1\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blob_retries_total{bucket="cc-packages"} 1` + "\n"))
+	})
+
+	It("records phase latencies as histograms", func() {
+		watcher.ObservePhase(blob, goblob.PhaseRead, 20*time.Millisecond)
+		watcher.ObservePhase(blob, goblob.PhaseRead, 3*time.Second)
+		watcher.ObservePhase(blob, goblob.PhaseChecksum, time.Millisecond)
+
+		metrics := scrape()
+		Expect(metrics).To(ContainSubstring("# TYPE goblob_blob_phase_duration_seconds histogram\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blob_phase_duration_seconds_bucket{phase="read",le="0.01"} 0` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blob_phase_duration_seconds_bucket{phase="read",le="0.025"} 1` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blob_phase_duration_seconds_bucket{phase="read",le="5"} 2` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blob_phase_duration_seconds_bucket{phase="read",le="+Inf"} 2` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blob_phase_duration_seconds_sum{phase="read"} 3.02` + "\n"))
+		Expect(metrics).To(ContainSubstring(`goblob_blob_phase_duration_seconds_count{phase="checksum"} 1` + "\n"))
+	})
+})
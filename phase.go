@@ -0,0 +1,40 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+// Phase is a step in migrating a blob
+type Phase string
+
+const (
+	// PhaseChecksum is checksumming the source blob
+	PhaseChecksum Phase = "checksum"
+	// PhaseRead is the time spent reading the source blob while uploading it
+	PhaseRead Phase = "read"
+	// PhaseWrite is the rest of the upload, spent writing to the destination
+	PhaseWrite Phase = "write"
+	// PhaseCopy is a server-side copy, which replaces reading and writing
+	PhaseCopy Phase = "copy"
+	// PhaseVerify is checksumming the blob at the destination
+	PhaseVerify Phase = "verify"
+)
+
+// PhaseTimer is told how long a phase of migrating a blob took
+type PhaseTimer func(blob *blobstore.Blob, phase Phase, duration time.Duration)
@@ -0,0 +1,70 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"io"
+	"time"
+)
+
+// progressReader reports bytes read beyond the furthest point reached so
+// far, so content read again after a seek, e.g. when an upload retries a
+// part, is only counted once. It also adds up the time spent reading.
+type progressReader struct {
+	io.ReadCloser
+	report   func(int64)
+	offset   int64
+	furthest int64
+	elapsed  time.Duration
+}
+
+func newProgressReader(rc io.ReadCloser, report func(int64)) *progressReader {
+	return &progressReader{ReadCloser: rc, report: report}
+}
+
+// readCloser is the reader to read through, which can seek if the
+// underlying reader can
+func (r *progressReader) readCloser() io.ReadCloser {
+	if seeker, ok := r.ReadCloser.(io.Seeker); ok {
+		return &progressReadSeeker{progressReader: r, seeker: seeker}
+	}
+	return r
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.ReadCloser.Read(p)
+	r.elapsed += time.Since(start)
+
+	r.offset += int64(n)
+	if r.offset > r.furthest {
+		r.report(r.offset - r.furthest)
+		r.furthest = r.offset
+	}
+	return n, err
+}
+
+type progressReadSeeker struct {
+	*progressReader
+	seeker io.Seeker
+}
+
+func (r *progressReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	position, err := r.seeker.Seek(offset, whence)
+	if err == nil {
+		r.offset = position
+	}
+	return position, err
+}
@@ -0,0 +1,481 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+const (
+	// progressRateWindow is how far back the transfer rate is averaged
+	progressRateWindow = 30 * time.Second
+	// progressRedrawInterval is how often progress is redrawn on a terminal
+	progressRedrawInterval = 500 * time.Millisecond
+	// progressMaxActive is how many active transfers are listed on a
+	// terminal
+	progressMaxActive = 10
+)
+
+// BucketProgress is how far a bucket, or the whole migration, has got. The
+// blobs planned are those found so far, so they grow until every bucket has
+// been listed.
+type BucketProgress struct {
+	Bucket string
+	// Listed is whether every blob has been found, without which the
+	// percentage and the time left would only describe the blobs found so
+	// far
+	Listed bool
+
+	// Blobs is how many blobs have been found to migrate, and Done how many
+	// of them have since been migrated, found to be already migrated or
+	// failed
+	Blobs int64
+	Done  int64
+
+	// Planned is the size of the blobs found to migrate
+	Planned int64
+	// Transferred is how much of that has been uploaded
+	Transferred int64
+	// Skipped is the size of the blobs that were already migrated or failed
+	Skipped int64
+}
+
+// Remaining is the number of bytes still to be uploaded
+func (p BucketProgress) Remaining() int64 {
+	remaining := p.Planned - p.Transferred - p.Skipped
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Percent is how much of the planned bytes have been dealt with, which is
+// how much of the bucket has been once it has been listed
+func (p BucketProgress) Percent() float64 {
+	if p.Planned == 0 {
+		if p.Done == p.Blobs {
+			return 100
+		}
+		return 0
+	}
+	return 100 * float64(p.Planned-p.Remaining()) / float64(p.Planned)
+}
+
+// Transfer is a blob being migrated
+type Transfer struct {
+	Bucket      string
+	Path        string
+	Size        int64
+	Transferred int64
+	Elapsed     time.Duration
+}
+
+// Progress is a snapshot of a migration taken by a ProgressWatcher
+type Progress struct {
+	Elapsed time.Duration
+	Total   BucketProgress
+	Buckets []BucketProgress
+	// Active is the blobs being migrated, longest running first
+	Active []Transfer
+
+	// Rate is the bytes uploaded per second over the last 30 seconds
+	Rate float64
+	// ETA is how long the remaining bytes will take at that rate, or zero
+	// when there is no rate to go on or the buckets are still being listed
+	ETA time.Duration
+}
+
+// ProgressWatcher reports how many bytes have been migrated, overall and
+// for each bucket. On a terminal it redraws the progress, with the blobs
+// being migrated, twice a second; otherwise it writes a line of status
+// every interval, as suits CI and BOSH errand logs.
+//
+// Bytes are counted as they are read, so Transferred should be passed to
+// the blob migrator with WithTransferProgress, and percentages and the time
+// left are only shown once buckets have been listed, so BucketWasListed
+// should be passed to the blobstore migrator with WithListedHandler.
+type ProgressWatcher struct {
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+	now      func() time.Time
+
+	mutex   sync.Mutex
+	start   time.Time
+	total   BucketProgress
+	buckets []*BucketProgress
+	active  map[*blobstore.Blob]*activeTransfer
+	// moved counts every byte uploaded, including those of attempts that
+	// were later abandoned, for the rate
+	moved   int64
+	samples []progressSample
+	drawn   int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type activeTransfer struct {
+	bucket      *BucketProgress
+	blob        *blobstore.Blob
+	started     time.Time
+	transferred int64
+}
+
+type progressSample struct {
+	at    time.Time
+	moved int64
+}
+
+// NewProgressWatcher writes progress to out, redrawing it in place when tty
+// is true and writing a line every interval otherwise
+func NewProgressWatcher(out io.Writer, tty bool, interval time.Duration) *ProgressWatcher {
+	if tty {
+		interval = progressRedrawInterval
+	}
+	return &ProgressWatcher{
+		out:      out,
+		tty:      tty,
+		interval: interval,
+		now:      time.Now,
+		active:   map[*blobstore.Blob]*activeTransfer{},
+	}
+}
+
+// Transferred counts n more bytes of blob as uploaded
+func (w *ProgressWatcher) Transferred(blob *blobstore.Blob, n int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	transfer, ok := w.active[blob]
+	if !ok {
+		return
+	}
+	transfer.transferred += n
+	w.addTransferred(transfer.bucket, n)
+	w.moved += n
+}
+
+// Progress takes a snapshot of the migration
+func (w *ProgressWatcher) Progress() Progress {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := w.now()
+	progress := Progress{
+		Elapsed: now.Sub(w.start),
+		Total:   w.total,
+	}
+	for _, bucket := range w.buckets {
+		progress.Buckets = append(progress.Buckets, *bucket)
+	}
+	for _, transfer := range w.active {
+		progress.Active = append(progress.Active, Transfer{
+			Bucket:      transfer.bucket.Bucket,
+			Path:        transfer.blob.Path,
+			Size:        transfer.blob.Size,
+			Transferred: transfer.transferred,
+			Elapsed:     now.Sub(transfer.started),
+		})
+	}
+	sort.Slice(progress.Active, func(i, j int) bool {
+		return progress.Active[i].Elapsed > progress.Active[j].Elapsed
+	})
+
+	since := progressSample{at: w.start}
+	if len(w.samples) > 0 {
+		since = w.samples[0]
+	}
+	if elapsed := now.Sub(since.at).Seconds(); elapsed > 0 {
+		progress.Rate = float64(w.moved-since.moved) / elapsed
+	}
+	if progress.Rate > 0 && w.total.Listed {
+		progress.ETA = time.Duration(float64(w.total.Remaining()) / progress.Rate * float64(time.Second))
+	}
+	return progress
+}
+
+// BucketWasListed marks bucket as listed, and the whole migration with it
+// when it was the last bucket to list
+func (w *ProgressWatcher) BucketWasListed(bucket string, last bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.bucket(bucket).Listed = true
+	if last {
+		w.total.Listed = true
+	}
+}
+
+func (w *ProgressWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
+	w.mutex.Lock()
+	w.start = w.now()
+	w.samples = []progressSample{{at: w.start}}
+	w.mutex.Unlock()
+
+	w.stop = make(chan struct{})
+	w.stopped = make(chan struct{})
+	go w.run()
+}
+
+func (w *ProgressWatcher) MigrationDidFinish() {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.stopped
+	}
+	w.report()
+}
+
+func (w *ProgressWatcher) MigrateBucketDidStart(bucket string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.bucket(bucket)
+}
+
+func (w *ProgressWatcher) MigrateBucketDidFinish(event BucketEvent) {
+	if w.tty {
+		return
+	}
+
+	w.mutex.Lock()
+	bucket := *w.bucket(event.Bucket)
+	w.mutex.Unlock()
+
+	fmt.Fprintf(w.out, "%s done: %d blobs, %s in %s\n",
+		bucket.Bucket,
+		bucket.Done,
+		bandwidth.FormatBytes(bucket.Transferred),
+		event.Duration.Round(time.Second),
+	)
+}
+
+func (w *ProgressWatcher) MigrateBlobWasQueued(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	bucket := w.bucket(event.Bucket)
+	for _, p := range []*BucketProgress{bucket, &w.total} {
+		p.Blobs++
+		p.Planned += event.Blob.Size
+	}
+}
+
+func (w *ProgressWatcher) MigrateBlobDidStart(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// a blob that changed is started again, and its upload with it
+	if transfer, ok := w.active[event.Blob]; ok {
+		w.addTransferred(transfer.bucket, -transfer.transferred)
+		transfer.transferred = 0
+		transfer.started = w.now()
+		return
+	}
+
+	w.active[event.Blob] = &activeTransfer{
+		bucket:  w.bucket(event.Bucket),
+		blob:    event.Blob,
+		started: w.now(),
+	}
+}
+
+func (w *ProgressWatcher) MigrateBlobDidFinish(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	transfer := w.finish(event)
+	// server-side copies are only counted once they have finished
+	unreported := event.Bytes - transfer.transferred
+	w.addTransferred(transfer.bucket, unreported)
+	if unreported > 0 {
+		w.moved += unreported
+	}
+}
+
+func (w *ProgressWatcher) MigrateBlobAlreadyFinished(event BlobEvent) {
+	w.skip(event)
+}
+
+func (w *ProgressWatcher) MigrateBlobDidFailWithError(event BlobEvent) {
+	w.skip(event)
+}
+
+// MigrateBlobWasFiltered does nothing. Blobs the filter skips are never
+// planned, and queued blobs left unattempted once the failure threshold
+// has been crossed are left unfinished, as the migration did not finish.
+func (w *ProgressWatcher) MigrateBlobWasFiltered(BlobEvent) {}
+
+func (w *ProgressWatcher) skip(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	transfer := w.finish(event)
+	w.addTransferred(transfer.bucket, -transfer.transferred)
+	for _, p := range []*BucketProgress{transfer.bucket, &w.total} {
+		p.Skipped += event.Blob.Size
+	}
+}
+
+// finish stops tracking the blob in event as active and counts it as done
+func (w *ProgressWatcher) finish(event BlobEvent) *activeTransfer {
+	transfer, ok := w.active[event.Blob]
+	if !ok {
+		transfer = &activeTransfer{bucket: w.bucket(event.Bucket), blob: event.Blob}
+	}
+	delete(w.active, event.Blob)
+
+	for _, p := range []*BucketProgress{transfer.bucket, &w.total} {
+		p.Done++
+	}
+	return transfer
+}
+
+func (w *ProgressWatcher) addTransferred(bucket *BucketProgress, n int64) {
+	bucket.Transferred += n
+	w.total.Transferred += n
+}
+
+func (w *ProgressWatcher) bucket(name string) *BucketProgress {
+	for _, bucket := range w.buckets {
+		if bucket.Bucket == name {
+			return bucket
+		}
+	}
+	bucket := &BucketProgress{Bucket: name}
+	w.buckets = append(w.buckets, bucket)
+	return bucket
+}
+
+func (w *ProgressWatcher) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.sample()
+			w.report()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// sample records how many bytes had been uploaded by now, for the rate
+func (w *ProgressWatcher) sample() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := w.now()
+	w.samples = append(w.samples, progressSample{at: now, moved: w.moved})
+
+	// keep the newest sample from before the window, so the rate covers
+	// all of it
+	old := 0
+	for old+1 < len(w.samples) && now.Sub(w.samples[old+1].at) > progressRateWindow {
+		old++
+	}
+	w.samples = w.samples[old:]
+}
+
+func (w *ProgressWatcher) report() {
+	progress := w.Progress()
+	if !w.tty {
+		fmt.Fprintln(w.out, formatProgressLine("Progress", progress.Total, progress))
+		return
+	}
+
+	lines := []string{formatProgressLine("Overall", progress.Total, progress)}
+	for _, bucket := range progress.Buckets {
+		lines = append(lines, formatBucketLine(bucket))
+	}
+	for i, transfer := range progress.Active {
+		if i == progressMaxActive {
+			lines = append(lines, fmt.Sprintf("    and %d more", len(progress.Active)-i))
+			break
+		}
+		lines = append(lines, formatTransferLine(transfer))
+	}
+
+	var buf bytes.Buffer
+	if w.drawn > 0 {
+		// move back up to the start of the last drawing and clear it
+		fmt.Fprintf(&buf, "\x1b[%dA\x1b[J", w.drawn)
+	}
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	w.drawn = len(lines)
+	io.WriteString(w.out, buf.String())
+}
+
+func formatProgressLine(label string, total BucketProgress, progress Progress) string {
+	eta := "unknown"
+	if progress.ETA > 0 {
+		eta = progress.ETA.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%s: %s (%s of %s, %d of %d blobs) at %s/s, ETA %s, %d active, %s elapsed",
+		label,
+		formatPercent(total),
+		bandwidth.FormatBytes(total.Planned-total.Remaining()),
+		bandwidth.FormatBytes(total.Planned),
+		total.Done,
+		total.Blobs,
+		bandwidth.FormatBytes(int64(progress.Rate)),
+		eta,
+		len(progress.Active),
+		progress.Elapsed.Round(time.Second),
+	)
+}
+
+func formatBucketLine(bucket BucketProgress) string {
+	return fmt.Sprintf("  %-14s %7s %s of %s, %d of %d blobs",
+		bucket.Bucket,
+		formatPercent(bucket),
+		bandwidth.FormatBytes(bucket.Planned-bucket.Remaining()),
+		bandwidth.FormatBytes(bucket.Planned),
+		bucket.Done,
+		bucket.Blobs,
+	)
+}
+
+// formatPercent shows "listing" until the bucket has been listed, as the
+// blobs found so far say nothing of how much of the bucket is left
+func formatPercent(progress BucketProgress) string {
+	if !progress.Listed {
+		return "listing"
+	}
+	return fmt.Sprintf("%.1f%%", progress.Percent())
+}
+
+func formatTransferLine(transfer Transfer) string {
+	return fmt.Sprintf("    %s %s of %s, %s",
+		transfer.Path,
+		bandwidth.FormatBytes(transfer.Transferred),
+		bandwidth.FormatBytes(transfer.Size),
+		transfer.Elapsed.Round(time.Second),
+	)
+}
@@ -0,0 +1,184 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProgressWatcher", func() {
+	var (
+		buf                   *bytes.Buffer
+		watcher               *goblob.ProgressWatcher
+		firstBlob, secondBlob *blobstore.Blob
+		thirdBlob             *blobstore.Blob
+		dstStore, srcStore    *blobstorefakes.FakeBlobstore
+		queue                 func(bucket string, blob *blobstore.Blob)
+	)
+
+	BeforeEach(func() {
+		buf = new(bytes.Buffer)
+		watcher = goblob.NewProgressWatcher(buf, false, time.Hour)
+		dstStore = &blobstorefakes.FakeBlobstore{}
+		srcStore = &blobstorefakes.FakeBlobstore{}
+
+		firstBlob = &blobstore.Blob{Path: "some-path", Size: 100}
+		secondBlob = &blobstore.Blob{Path: "some-other-path", Size: 200}
+		thirdBlob = &blobstore.Blob{Path: "yet-another-path", Size: 300}
+
+		queue = func(bucket string, blob *blobstore.Blob) {
+			watcher.MigrateBlobWasQueued(goblob.BlobEvent{Bucket: bucket, Blob: blob})
+		}
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+	})
+
+	It("counts bytes planned, transferred and skipped", func() {
+		watcher.MigrateBucketDidStart("cc-packages")
+		for _, blob := range []*blobstore.Blob{firstBlob, secondBlob, thirdBlob} {
+			queue("cc-packages", blob)
+			watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Attempt: 1})
+		}
+		watcher.Transferred(firstBlob, 60)
+
+		progress := watcher.Progress()
+		Expect(progress.Total.Blobs).To(Equal(int64(3)))
+		Expect(progress.Total.Planned).To(Equal(int64(600)))
+		Expect(progress.Total.Transferred).To(Equal(int64(60)))
+		Expect(progress.Total.Remaining()).To(Equal(int64(540)))
+		Expect(progress.Total.Percent()).To(Equal(10.0))
+		Expect(progress.Active).To(HaveLen(3))
+		Expect(progress.Buckets).To(HaveLen(1))
+		Expect(progress.Buckets[0].Bucket).To(Equal("cc-packages"))
+
+		watcher.Transferred(firstBlob, 40)
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{Bucket: "cc-packages", Blob: firstBlob, Bytes: 100})
+		watcher.MigrateBlobAlreadyFinished(goblob.BlobEvent{Bucket: "cc-packages", Blob: secondBlob})
+		// server-side copies report their bytes when they finish
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{Bucket: "cc-packages", Blob: thirdBlob, Bytes: 300})
+
+		progress = watcher.Progress()
+		Expect(progress.Total).To(Equal(goblob.BucketProgress{
+			Blobs:       3,
+			Done:        3,
+			Planned:     600,
+			Transferred: 400,
+			Skipped:     200,
+		}))
+		Expect(progress.Buckets[0].Transferred).To(Equal(int64(400)))
+		Expect(progress.Total.Percent()).To(Equal(100.0))
+		Expect(progress.Active).To(BeEmpty())
+	})
+
+	It("counts a blob that is started again from the beginning", func() {
+		queue("cc-droplets", firstBlob)
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-droplets", Blob: firstBlob, Attempt: 1})
+		watcher.Transferred(firstBlob, 50)
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-droplets", Blob: firstBlob, Attempt: 2})
+		watcher.Transferred(firstBlob, 30)
+
+		progress := watcher.Progress()
+		Expect(progress.Total.Transferred).To(Equal(int64(30)))
+		Expect(progress.Active).To(HaveLen(1))
+		Expect(progress.Active[0].Transferred).To(Equal(int64(30)))
+	})
+
+	It("stops counting the bytes of a blob that failed", func() {
+		queue("cc-droplets", firstBlob)
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-droplets", Blob: firstBlob, Attempt: 1})
+		watcher.Transferred(firstBlob, 50)
+		watcher.MigrateBlobDidFailWithError(goblob.BlobEvent{Bucket: "cc-droplets", Blob: firstBlob})
+
+		progress := watcher.Progress()
+		Expect(progress.Total.Transferred).To(BeZero())
+		Expect(progress.Total.Skipped).To(Equal(int64(100)))
+		Expect(progress.Total.Done).To(Equal(int64(1)))
+	})
+
+	It("estimates the time left from the rate", func() {
+		queue("cc-droplets", firstBlob)
+		watcher.BucketWasListed("cc-droplets", true)
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-droplets", Blob: firstBlob, Attempt: 1})
+		time.Sleep(10 * time.Millisecond)
+		watcher.Transferred(firstBlob, 50)
+
+		progress := watcher.Progress()
+		Expect(progress.Rate).To(BeNumerically(">", 0))
+		Expect(progress.ETA).To(BeNumerically(">", 0))
+	})
+
+	It("shows no percentage or time left until the buckets have been listed", func() {
+		watcher.MigrateBucketDidStart("cc-droplets")
+		queue("cc-droplets", firstBlob)
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-droplets", Blob: firstBlob, Attempt: 1})
+		time.Sleep(10 * time.Millisecond)
+		watcher.Transferred(firstBlob, 100)
+
+		progress := watcher.Progress()
+		Expect(progress.Rate).To(BeNumerically(">", 0))
+		Expect(progress.ETA).To(BeZero())
+		Expect(progress.Total.Listed).To(BeFalse())
+
+		watcher.BucketWasListed("cc-droplets", false)
+		progress = watcher.Progress()
+		Expect(progress.Buckets[0].Listed).To(BeTrue())
+		Expect(progress.Total.Listed).To(BeFalse())
+
+		watcher.MigrationDidFinish()
+		Expect(buf.String()).To(ContainSubstring("Progress: listing (100B of 100B, 0 of 1 blobs)"))
+		Expect(buf.String()).To(ContainSubstring("ETA unknown"))
+	})
+
+	It("writes lines of progress when the output is not a terminal", func() {
+		watcher.MigrateBucketDidStart("cc-packages")
+		queue("cc-packages", firstBlob)
+		watcher.BucketWasListed("cc-packages", true)
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-packages", Blob: firstBlob, Attempt: 1})
+		watcher.Transferred(firstBlob, 100)
+		watcher.MigrateBlobDidFinish(goblob.BlobEvent{Bucket: "cc-packages", Blob: firstBlob, Bytes: 100})
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-packages", Duration: time.Minute})
+		watcher.MigrationDidFinish()
+
+		Expect(buf.String()).To(ContainSubstring("cc-packages done: 1 blobs, 100B in 1m0s\n"))
+		Expect(buf.String()).To(ContainSubstring("Progress: 100.0% (100B of 100B, 1 of 1 blobs)"))
+		Expect(buf.String()).NotTo(ContainSubstring("\x1b["))
+	})
+
+	It("draws the buckets and active transfers on a terminal", func() {
+		watcher = goblob.NewProgressWatcher(buf, true, time.Hour)
+		watcher.MigrationDidStart(dstStore, srcStore)
+		blob := &blobstore.Blob{Path: "cc-packages/ab/cd/some-package", Size: 100}
+		watcher.MigrateBucketDidStart("cc-packages")
+		queue("cc-packages", blob)
+		watcher.BucketWasListed("cc-packages", true)
+		watcher.MigrateBlobDidStart(goblob.BlobEvent{Bucket: "cc-packages", Blob: blob, Attempt: 1})
+		watcher.Transferred(blob, 25)
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-packages"})
+		watcher.MigrationDidFinish()
+
+		Expect(buf.String()).To(HavePrefix("Overall: 25.0% (25B of 100B, 0 of 1 blobs)"))
+		Expect(buf.String()).To(ContainSubstring("\n  cc-packages      25.0% 25B of 100B, 0 of 1 blobs\n"))
+		Expect(buf.String()).To(MatchRegexp(`\n    cc-packages/ab/cd/some-package 25B of 100B, \d+s\n`))
+		Expect(buf.String()).NotTo(ContainSubstring("done:"))
+	})
+})
@@ -0,0 +1,233 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pivotal-cf/goblob/bandwidth"
+)
+
+var reportHTMLTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": bandwidth.FormatBytes,
+	"rate": func(rate float64) string {
+		return bandwidth.FormatBytes(int64(rate)) + "/s"
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>goblob migration from {{.Source}} to {{.Destination}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.number { text-align: right; }
+tr.total { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Migration from {{.Source}} to {{.Destination}}</h1>
+<p>Started {{.Started.Format "2006-01-02 15:04:05 MST"}}, took {{duration .Duration}}.</p>
+
+<h2>Buckets</h2>
+<table>
+<tr><th>Bucket</th><th>Migrated</th><th>Already migrated</th><th>Failed</th><th>Filtered out</th><th>Bytes</th><th>Duration</th><th>Throughput</th></tr>
+{{- range .Buckets}}
+<tr><td>{{.Bucket}}</td><td class="number">{{.Migrated}}</td><td class="number">{{.AlreadyMigrated}}</td><td class="number">{{.Failed}}</td><td class="number">{{.Filtered}}</td><td class="number">{{bytes .Bytes}}</td><td class="number">{{duration .Duration}}</td><td class="number">{{rate .Throughput}}</td></tr>
+{{- end}}
+{{- with .Total}}
+<tr class="total"><td>Total</td><td class="number">{{.Migrated}}</td><td class="number">{{.AlreadyMigrated}}</td><td class="number">{{.Failed}}</td><td class="number">{{.Filtered}}</td><td class="number">{{bytes .Bytes}}</td><td class="number">{{duration .Duration}}</td><td class="number">{{rate .Throughput}}</td></tr>
+{{- end}}
+</table>
+
+{{- if .ErrorGroups}}
+
+<h2>Errors</h2>
+<table>
+<tr><th>Cause</th><th>Blobs</th><th>For example</th></tr>
+{{- range .ErrorGroups}}
+<tr><td>{{.Cause}}</td><td class="number">{{.Count}}</td><td>{{range $i, $path := .Examples}}{{if $i}}<br>{{end}}{{$path}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Slowest}}
+
+<h2>Slowest blobs</h2>
+<table>
+<tr><th>Blob</th><th>Size</th><th>Duration</th><th>Attempts</th></tr>
+{{- range .Slowest}}
+<tr><td>{{.Path}}</td><td class="number">{{bytes .Size}}</td><td class="number">{{duration .Duration}}</td><td class="number">{{.Attempt}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+<h2>Configuration</h2>
+<table>
+<tr><th>Option</th><th>Value</th></tr>
+{{- range .Settings}}
+<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a web page
+func (r *MigrationReport) WriteHTML(w io.Writer) error {
+	return reportHTMLTemplate.Execute(w, r)
+}
+
+// WriteCSV writes the bucket table, with a total row, for spreadsheets
+func (r *MigrationReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"bucket",
+		"migrated",
+		"already_migrated",
+		"failed",
+		"filtered",
+		"bytes",
+		"duration_seconds",
+		"throughput_bytes_per_second",
+	})
+
+	row := func(name string, bucket BucketReport) {
+		writer.Write([]string{
+			name,
+			strconv.FormatInt(bucket.Migrated, 10),
+			strconv.FormatInt(bucket.AlreadyMigrated, 10),
+			strconv.FormatInt(bucket.Failed, 10),
+			strconv.FormatInt(bucket.Filtered, 10),
+			strconv.FormatInt(bucket.Bytes, 10),
+			strconv.FormatFloat(bucket.Duration.Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(bucket.Throughput(), 'f', 0, 64),
+		})
+	}
+	for _, bucket := range r.Buckets {
+		row(bucket.Bucket, bucket)
+	}
+	row("total", r.Total)
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int64            `xml:"tests,attr"`
+	Failures int64            `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int64           `xml:"tests,attr"`
+	Failures int64           `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML, so CI pipelines show failed
+// blobs as failed tests. Each bucket is a test suite with a test case for
+// each blob listed in Failures and one passing test case for the rest.
+func (r *MigrationReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{
+		Name: fmt.Sprintf("migrate %s to %s", r.Source, r.Destination),
+		Time: junitSeconds(r.Duration),
+	}
+
+	failures := map[string][]BlobReport{}
+	for _, failure := range r.Failures {
+		failures[failure.Bucket] = append(failures[failure.Bucket], failure)
+	}
+
+	for _, bucket := range r.Buckets {
+		suite := junitTestSuite{
+			Name: bucket.Bucket,
+			Time: junitSeconds(bucket.Duration),
+		}
+		suite.Cases = append(suite.Cases, junitTestCase{
+			ClassName: bucket.Bucket,
+			Name:      fmt.Sprintf("%d blobs migrated, %d already migrated", bucket.Migrated, bucket.AlreadyMigrated),
+			Time:      junitSeconds(bucket.Duration),
+		})
+		for _, failure := range failures[bucket.Bucket] {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				ClassName: bucket.Bucket,
+				Name:      failure.Path,
+				Time:      junitSeconds(failure.Duration),
+				Failure: &junitFailure{
+					Message: failure.Error,
+					Text:    fmt.Sprintf("%s failed after %d attempts: %s", failure.Path, failure.Attempt, failure.Error),
+				},
+			})
+		}
+		if listed := int64(len(failures[bucket.Bucket])); listed < bucket.Failed {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				ClassName: bucket.Bucket,
+				Name:      fmt.Sprintf("%d more failed blobs", bucket.Failed-listed),
+				Failure: &junitFailure{
+					Message: "only the first failures are listed; see the error groups in the HTML report",
+				},
+			})
+		}
+		suite.Tests = int64(len(suite.Cases))
+		suite.Failures = int64(len(suite.Cases) - 1)
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
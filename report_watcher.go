@@ -0,0 +1,306 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/goblob/blobstore"
+)
+
+const (
+	// reportSlowestBlobs is how many of the slowest blobs a report lists
+	reportSlowestBlobs = 10
+	// reportFailures is how many failed blobs a report lists individually;
+	// every failure is still counted in its error group
+	reportFailures = 1000
+	// reportErrorExamples is how many blobs are listed for each error group
+	reportErrorExamples = 5
+	// reportErrorGroups is how many causes failures are grouped by; failures
+	// with any other cause share the reportOtherCauses group
+	reportErrorGroups = 1000
+	reportOtherCauses = "other causes"
+)
+
+var (
+	// requestIDs are the ids S3 gives each request, in errors such as
+	// "status code: 403, request id: ..., host id: ..."
+	requestIDs = regexp.MustCompile(`,\s*(request id|host id):\s*[^,\s]*`)
+	// azureResponseErrors are the details Azure gives of a failed request,
+	// including its request id and time, after the error's service code
+	azureResponseErrors = regexp.MustCompile(`(?s)(-> [^\n]*\n)*===== RESPONSE ERROR \(ServiceCode=([^)]*)\) =====.*`)
+)
+
+// ReportSetting is an option a migration was run with. Secrets should be
+// redacted before they are passed to a report.
+type ReportSetting struct {
+	Name  string
+	Value string
+}
+
+// MigrationReport summarizes a migration
+type MigrationReport struct {
+	Source      string
+	Destination string
+	Settings    []ReportSetting
+
+	Started  time.Time
+	Duration time.Duration
+
+	Buckets []BucketReport
+	Total   BucketReport
+
+	// Slowest is the blobs that took longest to migrate, slowest first
+	Slowest []BlobReport
+	// Failures is the blobs that failed, up to the first 1000
+	Failures []BlobReport
+	// ErrorGroups is the failures grouped by cause, most common first
+	ErrorGroups []ErrorGroup
+}
+
+// BucketReport counts what happened to a bucket's blobs
+type BucketReport struct {
+	Bucket          string
+	Migrated        int64
+	AlreadyMigrated int64
+	Failed          int64
+	Filtered        int64
+	// Bytes is the size of the blobs migrated
+	Bytes    int64
+	Duration time.Duration
+}
+
+// Throughput is the bytes migrated per second
+func (r BucketReport) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// BlobReport is a blob that was slow or failed
+type BlobReport struct {
+	Bucket   string
+	Path     string
+	Size     int64
+	Duration time.Duration
+	Attempt  int
+	Error    string
+}
+
+// ErrorGroup is failures with the same cause
+type ErrorGroup struct {
+	// Cause is the error with the blob's path taken out
+	Cause string
+	Count int64
+	// Examples is the paths of the first few blobs that failed this way
+	Examples []string
+}
+
+// ReportWatcher builds a MigrationReport from a migration's events
+type ReportWatcher struct {
+	mutex       sync.Mutex
+	report      MigrationReport
+	bucketNames []string
+	buckets     map[string]*BucketReport
+	errorGroups map[string]*ErrorGroup
+}
+
+// NewReportWatcher creates a ReportWatcher whose report lists settings
+func NewReportWatcher(settings []ReportSetting) *ReportWatcher {
+	return &ReportWatcher{
+		report:      MigrationReport{Settings: settings},
+		buckets:     map[string]*BucketReport{},
+		errorGroups: map[string]*ErrorGroup{},
+	}
+}
+
+// Report returns the report so far, which is complete once the migration
+// has finished
+func (w *ReportWatcher) Report() *MigrationReport {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	report := w.report
+	for _, name := range w.bucketNames {
+		bucket := *w.buckets[name]
+		report.Buckets = append(report.Buckets, bucket)
+
+		report.Total.Migrated += bucket.Migrated
+		report.Total.AlreadyMigrated += bucket.AlreadyMigrated
+		report.Total.Failed += bucket.Failed
+		report.Total.Filtered += bucket.Filtered
+		report.Total.Bytes += bucket.Bytes
+	}
+	report.Total.Duration = report.Duration
+	if report.Duration == 0 && !report.Started.IsZero() {
+		report.Total.Duration = time.Since(report.Started)
+	}
+
+	report.Slowest = append([]BlobReport(nil), w.report.Slowest...)
+	report.Failures = append([]BlobReport(nil), w.report.Failures...)
+
+	for _, group := range w.errorGroups {
+		group := *group
+		group.Examples = append([]string(nil), group.Examples...)
+		report.ErrorGroups = append(report.ErrorGroups, group)
+	}
+	sort.Slice(report.ErrorGroups, func(i, j int) bool {
+		if report.ErrorGroups[i].Count != report.ErrorGroups[j].Count {
+			return report.ErrorGroups[i].Count > report.ErrorGroups[j].Count
+		}
+		return report.ErrorGroups[i].Cause < report.ErrorGroups[j].Cause
+	})
+	return &report
+}
+
+func (w *ReportWatcher) MigrationDidStart(dst, src blobstore.Blobstore) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.report.Source = src.Name()
+	w.report.Destination = dst.Name()
+	w.report.Started = time.Now()
+}
+
+func (w *ReportWatcher) MigrationDidFinish() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.report.Duration = time.Since(w.report.Started)
+}
+
+func (w *ReportWatcher) MigrateBucketDidStart(bucket string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.bucket(bucket)
+}
+
+func (w *ReportWatcher) MigrateBucketDidFinish(event BucketEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.bucket(event.Bucket).Duration = event.Duration
+}
+
+func (w *ReportWatcher) MigrateBlobWasQueued(BlobEvent) {}
+
+func (w *ReportWatcher) MigrateBlobDidStart(BlobEvent) {}
+
+func (w *ReportWatcher) MigrateBlobDidFinish(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	bucket := w.bucket(event.Bucket)
+	bucket.Migrated++
+	bucket.Bytes += event.Bytes
+	w.recordSlowest(blobReport(event))
+}
+
+func (w *ReportWatcher) MigrateBlobAlreadyFinished(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.bucket(event.Bucket).AlreadyMigrated++
+}
+
+func (w *ReportWatcher) MigrateBlobDidFailWithError(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.bucket(event.Bucket).Failed++
+
+	failure := blobReport(event)
+	if len(w.report.Failures) < reportFailures {
+		w.report.Failures = append(w.report.Failures, failure)
+	}
+
+	cause := failureCause(failure.Error, failure.Path)
+	group, ok := w.errorGroups[cause]
+	if !ok && len(w.errorGroups) >= reportErrorGroups {
+		cause = reportOtherCauses
+		group, ok = w.errorGroups[cause]
+	}
+	if !ok {
+		group = &ErrorGroup{Cause: cause}
+		w.errorGroups[cause] = group
+	}
+	group.Count++
+	if len(group.Examples) < reportErrorExamples {
+		group.Examples = append(group.Examples, failure.Path)
+	}
+}
+
+// failureCause is the error of the blob at path with the path, and the
+// details of the request that failed, taken out, so that blobs that failed
+// for the same reason share a cause
+func failureCause(err, path string) string {
+	if path != "" {
+		err = strings.Replace(err, path, "<blob>", -1)
+	}
+	err = requestIDs.ReplaceAllString(err, "")
+	return azureResponseErrors.ReplaceAllString(err, "ServiceCode=$2")
+}
+
+func (w *ReportWatcher) MigrateBlobWasFiltered(event BlobEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.bucket(event.Bucket).Filtered++
+}
+
+func (w *ReportWatcher) bucket(name string) *BucketReport {
+	bucket, ok := w.buckets[name]
+	if !ok {
+		bucket = &BucketReport{Bucket: name}
+		w.buckets[name] = bucket
+		w.bucketNames = append(w.bucketNames, name)
+	}
+	return bucket
+}
+
+// recordSlowest keeps the slowest blobs in order, slowest first
+func (w *ReportWatcher) recordSlowest(blob BlobReport) {
+	slowest := w.report.Slowest
+	i := sort.Search(len(slowest), func(i int) bool {
+		return slowest[i].Duration < blob.Duration
+	})
+	if i == reportSlowestBlobs {
+		return
+	}
+	slowest = append(slowest, BlobReport{})
+	copy(slowest[i+1:], slowest[i:])
+	slowest[i] = blob
+	if len(slowest) > reportSlowestBlobs {
+		slowest = slowest[:reportSlowestBlobs]
+	}
+	w.report.Slowest = slowest
+}
+
+func blobReport(event BlobEvent) BlobReport {
+	report := BlobReport{
+		Bucket:   event.Bucket,
+		Duration: event.Duration,
+		Attempt:  event.Attempt,
+	}
+	if event.Blob != nil {
+		report.Path = event.Blob.Path
+		report.Size = event.Blob.Size
+	}
+	if event.Err != nil {
+		report.Error = event.Err.Error()
+	}
+	return report
+}
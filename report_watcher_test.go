@@ -0,0 +1,228 @@
+// Copyright 2017-Present Pivotal Software, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http:#www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goblob_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/goblob"
+	"github.com/pivotal-cf/goblob/blobstore"
+	"github.com/pivotal-cf/goblob/blobstore/blobstorefakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReportWatcher", func() {
+	var (
+		watcher *goblob.ReportWatcher
+		report  *goblob.MigrationReport
+	)
+
+	blobEvent := func(bucket, path string, duration time.Duration) goblob.BlobEvent {
+		return goblob.BlobEvent{
+			Bucket:   bucket,
+			Blob:     &blobstore.Blob{Path: path, Size: 1000},
+			Bytes:    1000,
+			Duration: duration,
+			Attempt:  1,
+		}
+	}
+
+	failedEvent := func(bucket, path, message string) goblob.BlobEvent {
+		event := blobEvent(bucket, path, time.Second)
+		event.Err = errors.New(message)
+		return event
+	}
+
+	BeforeEach(func() {
+		watcher = goblob.NewReportWatcher([]goblob.ReportSetting{
+			{Name: "s3-endpoint", Value: "https://s3.example.com"},
+			{Name: "s3-secretkey", Value: "<redacted>"},
+		})
+
+		dstStore := &blobstorefakes.FakeBlobstore{}
+		dstStore.NameReturns("S3")
+		srcStore := &blobstorefakes.FakeBlobstore{}
+		srcStore.NameReturns("NFS")
+
+		watcher.MigrationDidStart(dstStore, srcStore)
+
+		watcher.MigrateBucketDidStart("cc-droplets")
+		for i := 1; i <= 12; i++ {
+			watcher.MigrateBlobDidFinish(blobEvent("cc-droplets", "cc-droplets/droplet", time.Duration(i)*time.Second))
+		}
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-droplets", Duration: 4 * time.Second})
+
+		watcher.MigrateBucketDidStart("cc-packages")
+		watcher.MigrateBlobAlreadyFinished(blobEvent("cc-packages", "cc-packages/ab/cd/first", 0))
+		watcher.MigrateBlobWasFiltered(goblob.BlobEvent{Bucket: "cc-packages", Blob: &blobstore.Blob{Path: "cc-packages/big"}, Reason: "larger than 1GB"})
+		watcher.MigrateBlobDidFailWithError(failedEvent("cc-packages", "cc-packages/ab/cd/second", "error writing blob at cc-packages/ab/cd/second: AccessDenied"))
+		watcher.MigrateBlobDidFailWithError(failedEvent("cc-packages", "cc-packages/ab/cd/third", "error writing blob at cc-packages/ab/cd/third: AccessDenied"))
+		watcher.MigrateBlobDidFailWithError(failedEvent("cc-packages", "cc-packages/ab/cd/fourth", "could not checksum blob: EOF"))
+		watcher.MigrateBucketDidFinish(goblob.BucketEvent{Bucket: "cc-packages", Duration: time.Second})
+
+		watcher.MigrationDidFinish()
+		report = watcher.Report()
+	})
+
+	It("counts the blobs and bytes in each bucket", func() {
+		Expect(report.Source).To(Equal("NFS"))
+		Expect(report.Destination).To(Equal("S3"))
+
+		Expect(report.Buckets).To(HaveLen(2))
+		Expect(report.Buckets[0]).To(Equal(goblob.BucketReport{
+			Bucket:   "cc-droplets",
+			Migrated: 12,
+			Bytes:    12000,
+			Duration: 4 * time.Second,
+		}))
+		Expect(report.Buckets[0].Throughput()).To(Equal(3000.0))
+		Expect(report.Buckets[1]).To(Equal(goblob.BucketReport{
+			Bucket:          "cc-packages",
+			AlreadyMigrated: 1,
+			Failed:          3,
+			Filtered:        1,
+			Duration:        time.Second,
+		}))
+
+		Expect(report.Total.Migrated).To(Equal(int64(12)))
+		Expect(report.Total.Failed).To(Equal(int64(3)))
+		Expect(report.Total.Bytes).To(Equal(int64(12000)))
+	})
+
+	It("lists the ten slowest blobs, slowest first", func() {
+		Expect(report.Slowest).To(HaveLen(10))
+		Expect(report.Slowest[0].Duration).To(Equal(12 * time.Second))
+		Expect(report.Slowest[9].Duration).To(Equal(3 * time.Second))
+	})
+
+	It("groups failures by their cause", func() {
+		Expect(report.Failures).To(HaveLen(3))
+		Expect(report.ErrorGroups).To(Equal([]goblob.ErrorGroup{
+			{
+				Cause:    "error writing blob at <blob>: AccessDenied",
+				Count:    2,
+				Examples: []string{"cc-packages/ab/cd/second", "cc-packages/ab/cd/third"},
+			},
+			{
+				Cause:    "could not checksum blob: EOF",
+				Count:    1,
+				Examples: []string{"cc-packages/ab/cd/fourth"},
+			},
+		}))
+	})
+
+	It("groups failures by their error rather than the request that failed", func() {
+		watcher = goblob.NewReportWatcher(nil)
+		watcher.MigrateBlobDidFailWithError(failedEvent("cc-droplets", "cc-droplets/first",
+			"error writing blob at cc-droplets/first: AccessDenied: Access Denied\n\tstatus code: 403, request id: 1A2B, host id: c29tZQ=="))
+		watcher.MigrateBlobDidFailWithError(failedEvent("cc-droplets", "cc-droplets/second",
+			"error writing blob at cc-droplets/second: AccessDenied: Access Denied\n\tstatus code: 403, request id: 3C4D, host id: b3RoZXI="))
+		watcher.MigrateBlobDidFailWithError(failedEvent("cc-droplets", "cc-droplets/third",
+			"error writing blob: -> github.com/Azure/azure-storage-blob-go/2018-03-28/azblob.newStorageError, storage_error.go:42\n"+
+				"===== RESPONSE ERROR (ServiceCode=AuthenticationFailed) =====\nDescription=Server failed to authenticate the request.\nRequestId:0123\nTime:2018-09-01T00:00:00Z\n"))
+		watcher.MigrateBlobDidFailWithError(failedEvent("cc-droplets", "cc-droplets/fourth",
+			"error writing blob: ===== RESPONSE ERROR (ServiceCode=AuthenticationFailed) =====\nDescription=Server failed to authenticate the request.\nRequestId:4567\nTime:2018-09-01T00:00:01Z\n"))
+
+		report := watcher.Report()
+		Expect(report.ErrorGroups).To(Equal([]goblob.ErrorGroup{
+			{
+				Cause:    "error writing blob at <blob>: AccessDenied: Access Denied\n\tstatus code: 403",
+				Count:    2,
+				Examples: []string{"cc-droplets/first", "cc-droplets/second"},
+			},
+			{
+				Cause:    "error writing blob: ServiceCode=AuthenticationFailed",
+				Count:    2,
+				Examples: []string{"cc-droplets/third", "cc-droplets/fourth"},
+			},
+		}))
+	})
+
+	It("groups failures past the thousandth cause together", func() {
+		watcher = goblob.NewReportWatcher(nil)
+		for i := 0; i < 1002; i++ {
+			watcher.MigrateBlobDidFailWithError(failedEvent("cc-droplets", "cc-droplets/droplet", fmt.Sprintf("error %d", i)))
+		}
+
+		report := watcher.Report()
+		Expect(report.ErrorGroups).To(HaveLen(1001))
+		Expect(report.ErrorGroups[0].Cause).To(Equal("other causes"))
+		Expect(report.ErrorGroups[0].Count).To(Equal(int64(2)))
+	})
+
+	It("writes HTML", func() {
+		buf := new(bytes.Buffer)
+		Expect(report.WriteHTML(buf)).To(Succeed())
+
+		html := buf.String()
+		Expect(html).To(ContainSubstring("<h1>Migration from NFS to S3</h1>"))
+		Expect(html).To(ContainSubstring(`<tr><td>cc-droplets</td><td class="number">12</td>`))
+		Expect(html).To(ContainSubstring("<td>error writing blob at &lt;blob&gt;: AccessDenied</td>"))
+		Expect(html).To(ContainSubstring("<tr><td>cc-droplets/droplet</td>"))
+		Expect(html).To(ContainSubstring("<tr><td>s3-secretkey</td><td>&lt;redacted&gt;</td></tr>"))
+	})
+
+	It("writes CSV", func() {
+		buf := new(bytes.Buffer)
+		Expect(report.WriteCSV(buf)).To(Succeed())
+
+		records, err := csv.NewReader(buf).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(Equal([][]string{
+			{"bucket", "migrated", "already_migrated", "failed", "filtered", "bytes", "duration_seconds", "throughput_bytes_per_second"},
+			{"cc-droplets", "12", "0", "0", "0", "12000", "4.000", "3000"},
+			{"cc-packages", "0", "1", "3", "1", "0", "1.000", "0"},
+			{"total", "12", "1", "3", "1", "12000", records[3][6], records[3][7]},
+		}))
+	})
+
+	It("writes JUnit XML with a failed test for each failed blob", func() {
+		buf := new(bytes.Buffer)
+		Expect(report.WriteJUnit(buf)).To(Succeed())
+
+		var suites struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Suites   []struct {
+				Name     string `xml:"name,attr"`
+				Failures int    `xml:"failures,attr"`
+				Cases    []struct {
+					Name    string `xml:"name,attr"`
+					Failure *struct {
+						Message string `xml:"message,attr"`
+						Text    string `xml:",chardata"`
+					} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		Expect(xml.Unmarshal(buf.Bytes(), &suites)).To(Succeed())
+
+		Expect(suites.Tests).To(Equal(5))
+		Expect(suites.Failures).To(Equal(3))
+		Expect(suites.Suites).To(HaveLen(2))
+		Expect(suites.Suites[0].Failures).To(BeZero())
+		Expect(suites.Suites[1].Name).To(Equal("cc-packages"))
+		Expect(suites.Suites[1].Cases[1].Name).To(Equal("cc-packages/ab/cd/second"))
+		Expect(suites.Suites[1].Cases[1].Failure.Message).To(Equal("error writing blob at cc-packages/ab/cd/second: AccessDenied"))
+		Expect(suites.Suites[1].Cases[1].Failure.Text).To(Equal("cc-packages/ab/cd/second failed after 1 attempts: error writing blob at cc-packages/ab/cd/second: AccessDenied"))
+	})
+})